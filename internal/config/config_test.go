@@ -0,0 +1,155 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// clearEnv blanks every setting's env var for the test, so Load sees only
+// what the test sets
+func clearEnv(t *testing.T) {
+	t.Helper()
+	for name := range (&Config{}).fields() {
+		t.Setenv(name, "")
+	}
+}
+
+// writeConfig writes a config file into a temporary directory and returns its path
+func writeConfig(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadDefaults(t *testing.T) {
+	clearEnv(t)
+	cfg, err := Load("")
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if cfg.Port != "8080" || cfg.MaxRows != 1000 || cfg.QueryTimeout != 30*time.Second {
+		t.Errorf("defaults = port %q, max rows %d, query timeout %v", cfg.Port, cfg.MaxRows, cfg.QueryTimeout)
+	}
+	if cfg.BaseURL != "http://localhost:8080" {
+		t.Errorf("BaseURL = %q, want http://localhost:8080", cfg.BaseURL)
+	}
+}
+
+func TestLoadFile(t *testing.T) {
+	tests := []struct {
+		name  string
+		file  string
+		check func(*Config) bool
+	}{
+		{"string", `{"db_label": "primary"}`, func(c *Config) bool { return c.DBLabel == "primary" }},
+		{"number", `{"max_rows": 500}`, func(c *Config) bool { return c.MaxRows == 500 }},
+		{"float", `{"rate_limit_rps": 2.5}`, func(c *Config) bool { return c.RateLimitRPS == 2.5 }},
+		{"bool", `{"allow_maintenance": true}`, func(c *Config) bool { return c.AllowMaintenance }},
+		{"bool as a string", `{"allow_maintenance": "1"}`, func(c *Config) bool { return c.AllowMaintenance }},
+		{"duration", `{"query_timeout": "15s"}`, func(c *Config) bool { return c.QueryTimeout == 15*time.Second }},
+		{"list", `{"listen_channels": ["orders", "jobs"]}`, func(c *Config) bool { return c.ListenChannels == "orders,jobs" }},
+		{"null keeps the default", `{"max_rows": null}`, func(c *Config) bool { return c.MaxRows == 1000 }},
+		{"upper-case key", `{"MAX_ROWS": 20}`, func(c *Config) bool { return c.MaxRows == 20 }},
+		{"legacy query timeout", `{"query_timeout_seconds": 5}`, func(c *Config) bool { return c.QueryTimeout == 5*time.Second }},
+		{"query timeout over the legacy form", `{"query_timeout": "7s", "query_timeout_seconds": 5}`, func(c *Config) bool { return c.QueryTimeout == 7*time.Second }},
+		{"burst follows the rate", `{"rate_limit_rps": 2.5}`, func(c *Config) bool { return c.RateLimitBurst == 3 }},
+		{"explicit burst", `{"rate_limit_rps": 2.5, "rate_limit_burst": 10}`, func(c *Config) bool { return c.RateLimitBurst == 10 }},
+		{"https base url with tls", `{"port": "8443", "tls_cert_file": "c.pem", "tls_key_file": "k.pem"}`, func(c *Config) bool { return c.BaseURL == "https://localhost:8443" }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clearEnv(t)
+			cfg, err := Load(writeConfig(t, "config.json", tt.file))
+			if err != nil {
+				t.Fatalf("Load: %v", err)
+			}
+			if !tt.check(cfg) {
+				t.Errorf("unexpected config for %s: %+v", tt.file, cfg)
+			}
+		})
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		want    string
+	}{
+		{"unknown key", "config.json", `{"max_rowz": 5}`, `unknown setting "max_rowz"`},
+		{"invalid int", "config.json", `{"max_rows": "many"}`, "invalid MAX_ROWS"},
+		{"fractional int", "config.json", `{"max_rows": 1.5}`, "invalid MAX_ROWS"},
+		{"invalid bool", "config.json", `{"allow_maintenance": "sometimes"}`, "invalid ALLOW_MAINTENANCE"},
+		{"duration without a unit", "config.json", `{"query_timeout": 15}`, "invalid QUERY_TIMEOUT"},
+		{"nested object", "config.json", `{"db": {"dsn": "x"}}`, "nested objects are not supported"},
+		{"malformed json", "config.json", `{"max_rows": `, "failed to read config file"},
+		{"yaml file", "config.yaml", "max_rows: 5\n", "YAML config files are not supported"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clearEnv(t)
+			_, err := Load(writeConfig(t, tt.file, tt.content))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("err = %v, want one containing %q", err, tt.want)
+			}
+		})
+	}
+
+	clearEnv(t)
+	if _, err := Load(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Error("missing file: expected an error")
+	}
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	file := `{"max_rows": 500, "port": "9000", "query_timeout": "15s", "allow_maintenance": true}`
+
+	tests := []struct {
+		name  string
+		env   map[string]string
+		check func(*Config) bool
+	}{
+		{"file over defaults", nil, func(c *Config) bool {
+			return c.MaxRows == 500 && c.Port == "9000" && c.QueryTimeout == 15*time.Second
+		}},
+		{"env over file", map[string]string{"MAX_ROWS": "50", "PORT": "9100"}, func(c *Config) bool {
+			return c.MaxRows == 50 && c.Port == "9100" && c.BaseURL == "http://localhost:9100"
+		}},
+		{"empty env keeps the file", map[string]string{"MAX_ROWS": ""}, func(c *Config) bool { return c.MaxRows == 500 }},
+		{"env bool over file", map[string]string{"ALLOW_MAINTENANCE": "false"}, func(c *Config) bool { return !c.AllowMaintenance }},
+		{"env over defaults for settings not in the file", map[string]string{"DB_LABEL": "replica"}, func(c *Config) bool {
+			return c.DBLabel == "replica" && c.MaxRows == 500
+		}},
+		{"env legacy timeout does not override the file's query timeout", map[string]string{"QUERY_TIMEOUT_SECONDS": "5"}, func(c *Config) bool {
+			return c.QueryTimeout == 15*time.Second
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clearEnv(t)
+			for name, value := range tt.env {
+				t.Setenv(name, value)
+			}
+			cfg, err := Load(writeConfig(t, "config.json", file))
+			if err != nil {
+				t.Fatalf("Load: %v", err)
+			}
+			if !tt.check(cfg) {
+				t.Errorf("unexpected config: %+v", cfg)
+			}
+		})
+	}
+
+	clearEnv(t)
+	t.Setenv("MAX_ROWS", "lots")
+	if _, err := Load(writeConfig(t, "config.json", file)); err == nil || !strings.Contains(err.Error(), "invalid MAX_ROWS") {
+		t.Errorf("invalid env value: err = %v, want invalid MAX_ROWS", err)
+	}
+}
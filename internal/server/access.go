@@ -0,0 +1,111 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+	"sync"
+)
+
+// ErrAccessDenied is returned when a table is hidden by the table access rules
+var ErrAccessDenied = errors.New("access denied")
+
+var (
+	tableAccessMu sync.RWMutex
+	// tableAllowlist and tableDenylist hold schema.table glob patterns
+	tableAllowlist []string
+	tableDenylist  []string
+)
+
+// SetTableAccess installs the table access rules from comma-separated lists of
+// schema.table glob patterns such as "public.*" or "*.payment_tokens"; a pattern
+// without a schema matches the table in every schema. When the allowlist is
+// non-empty only tables matching it are accessible, and the denylist always wins.
+func SetTableAccess(allow, deny string) error {
+	allowlist, err := parseTablePatterns(allow)
+	if err != nil {
+		return fmt.Errorf("invalid table allowlist: %w", err)
+	}
+	denylist, err := parseTablePatterns(deny)
+	if err != nil {
+		return fmt.Errorf("invalid table denylist: %w", err)
+	}
+
+	tableAccessMu.Lock()
+	tableAllowlist = allowlist
+	tableDenylist = denylist
+	tableAccessMu.Unlock()
+	// Cached listings were filtered by the previous rules
+	results.reset()
+	return nil
+}
+
+// parseTablePatterns splits and validates a comma-separated pattern list
+func parseTablePatterns(spec string) ([]string, error) {
+	var patterns []string
+	for _, p := range strings.Split(spec, ",") {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		if !strings.Contains(p, ".") {
+			p = "*." + p
+		}
+		if _, err := path.Match(p, ""); err != nil {
+			return nil, fmt.Errorf("%q: %w", p, err)
+		}
+		patterns = append(patterns, p)
+	}
+	return patterns, nil
+}
+
+// tableAccessRestricted reports whether any table access rules are configured
+func tableAccessRestricted() bool {
+	tableAccessMu.RLock()
+	defer tableAccessMu.RUnlock()
+	return len(tableAllowlist) > 0 || len(tableDenylist) > 0
+}
+
+// tableAllowed reports whether the access rules permit a schema.table name
+func tableAllowed(name string) bool {
+	tableAccessMu.RLock()
+	defer tableAccessMu.RUnlock()
+
+	if matchesAny(tableDenylist, name) {
+		return false
+	}
+	return len(tableAllowlist) == 0 || matchesAny(tableAllowlist, name)
+}
+
+// matchesAny reports whether name matches one of the patterns
+func matchesAny(patterns []string, name string) bool {
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// checkTableAccess returns an ErrAccessDenied error unless the table is accessible
+func checkTableAccess(schema, table string) error {
+	if !tableAllowed(schema + "." + table) {
+		return fmt.Errorf("%w: %s.%s", ErrAccessDenied, schema, table)
+	}
+	return nil
+}
+
+// filterTables drops the tables of schema that the access rules hide
+func filterTables(schema string, tables []string) []string {
+	if !tableAccessRestricted() {
+		return tables
+	}
+	visible := tables[:0]
+	for _, table := range tables {
+		if tableAllowed(schema + "." + table) {
+			visible = append(visible, table)
+		}
+	}
+	return visible
+}
@@ -0,0 +1,252 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestTableAllowed(t *testing.T) {
+	tests := []struct {
+		name        string
+		allow, deny string
+		table       string
+		want        bool
+	}{
+		{"no rules", "", "", "public.users", true},
+		{"denied by exact name", "", "public.users", "public.users", false},
+		{"deny glob on any schema", "", "*.payment_tokens", "billing.payment_tokens", false},
+		{"bare table name matches every schema", "", "payment_tokens", "billing.payment_tokens", false},
+		{"deny does not match other tables", "", "*.payment_tokens", "public.orders", true},
+		{"schema wildcard", "", "audit.*", "audit.events", false},
+		{"question mark wildcard", "", "public.log_?", "public.log_1", false},
+		{"question mark matches one character", "", "public.log_?", "public.log_10", true},
+		{"allowlist admits matching table", "public.*", "", "public.orders", true},
+		{"allowlist hides other schemas", "public.*", "", "billing.invoices", false},
+		{"denylist wins over allowlist", "public.*", "public.users", "public.users", false},
+		{"several patterns", "public.orders, public.items", "", "public.items", true},
+		{"pattern without a dot names a table", "", "public*", "public.users", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setTestTableAccess(t, tt.allow, tt.deny)
+			if got := tableAllowed(tt.table); got != tt.want {
+				t.Errorf("tableAllowed(%q) with allow=%q deny=%q = %v, want %v", tt.table, tt.allow, tt.deny, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSetTableAccessRejectsBadPattern(t *testing.T) {
+	t.Cleanup(func() { SetTableAccess("", "") })
+	if err := SetTableAccess("", "public.[users"); err == nil {
+		t.Fatal("SetTableAccess accepted a malformed pattern")
+	}
+}
+
+func TestFilterTables(t *testing.T) {
+	setTestTableAccess(t, "", "public.secret*")
+	got := filterTables("public", []string{"orders", "secret", "secret_keys", "users"})
+	want := []string{"orders", "users"}
+	if len(got) != len(want) {
+		t.Fatalf("filterTables = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("filterTables = %v, want %v", got, want)
+		}
+	}
+}
+
+func TestExecuteQueryRejectsDeniedTable(t *testing.T) {
+	db := testDB(t)
+	schema := testSchema(t, db,
+		"CREATE TABLE secret (id int, token text)",
+		"INSERT INTO secret VALUES (1, 'hunter2')",
+		"CREATE TABLE orders (id int)",
+	)
+	setTestTableAccess(t, "", schema+".secret")
+
+	if _, err := ExecuteQueryWithOptions(context.Background(), db, schema, "SELECT * FROM orders", nil, QueryOptions{}); err != nil {
+		t.Fatalf("query on an allowed table failed: %v", err)
+	}
+	_, err := ExecuteQueryWithOptions(context.Background(), db, schema, "SELECT o.id FROM orders o JOIN secret s ON s.id = o.id", nil, QueryOptions{})
+	if !errors.Is(err, ErrAccessDenied) {
+		t.Fatalf("join with a denied table: err = %v, want ErrAccessDenied", err)
+	}
+}
+
+// TestDenylistMultipleStatementBypass covers statements appended after an
+// allowed one: they must be rejected before anything runs, neither reading the
+// denied table nor writing to it
+func TestDenylistMultipleStatementBypass(t *testing.T) {
+	db := testDB(t)
+	schema := testSchema(t, db,
+		"CREATE TABLE secret (id int, token text)",
+		"INSERT INTO secret VALUES (1, 'hunter2')",
+	)
+	setTestTableAccess(t, "", schema+".secret")
+
+	queries := []string{
+		"SELECT 1; SELECT * FROM secret",
+		"SELECT 1; UPDATE secret SET token = 'leaked'",
+		"SELECT 1; COMMIT; UPDATE secret SET token = 'leaked'",
+		"SELECT 1 /* ; */; UPDATE secret SET token = 'leaked'",
+		"SELECT E'\\''; UPDATE secret SET token = 'leaked'; SELECT ''",
+		"SELECT $$'$$; UPDATE secret SET token = 'leaked'; SELECT $$'$$",
+	}
+	for _, query := range queries {
+		result, err := ExecuteQueryWithOptions(context.Background(), db, schema, query, nil, QueryOptions{})
+		if !errors.Is(err, ErrMultipleStatements) {
+			t.Errorf("%q: err = %v (result %v), want ErrMultipleStatements", query, err, result)
+		}
+	}
+
+	var token string
+	if err := db.QueryRow("SELECT token FROM " + schema + ".secret").Scan(&token); err != nil {
+		t.Fatal(err)
+	}
+	if token != "hunter2" {
+		t.Fatalf("denied table was modified: token = %q", token)
+	}
+}
+
+func TestRequireSingleStatement(t *testing.T) {
+	db := testDB(t)
+	conn, err := db.Conn(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	tests := []struct {
+		query string
+		args  []interface{}
+		want  error
+	}{
+		{"SELECT 1", nil, nil},
+		{"SELECT 1;", nil, nil},
+		{"SELECT ';' AS semicolon", nil, nil},
+		{"SELECT 1 -- ; trailing comment", nil, nil},
+		{"SELECT 1; SELECT 2", nil, ErrMultipleStatements},
+		{"SELECT 1;; SELECT 2", nil, ErrMultipleStatements},
+		// Queries with arguments already use the extended protocol
+		{"SELECT $1::int", []interface{}{1}, nil},
+	}
+	for _, tt := range tests {
+		err := requireSingleStatement(context.Background(), conn, tt.query, tt.args)
+		if !errors.Is(err, tt.want) {
+			t.Errorf("requireSingleStatement(%q) = %v, want %v", tt.query, err, tt.want)
+		}
+	}
+
+	// Other parse errors are reported as query errors, not as multiple statements
+	err = requireSingleStatement(context.Background(), conn, "SELEC 1", nil)
+	if err == nil || errors.Is(err, ErrMultipleStatements) {
+		t.Errorf("syntax error: err = %v", err)
+	}
+}
+
+// TestMetadataHonoursTableAccess checks that catalog tools leave out tables the
+// access rules hide and refuse to describe them by name
+func TestMetadataHonoursTableAccess(t *testing.T) {
+	db := testDB(t)
+	schema := testSchema(t, db,
+		"CREATE TABLE visible (id int)",
+		"CREATE TABLE secret (id int PRIMARY KEY)",
+		"CREATE TABLE secret_child (id int, secret_id int REFERENCES secret)",
+		"CREATE TABLE visible_child (id int, secret_id int REFERENCES secret)",
+		"INSERT INTO visible VALUES (1)",
+		"INSERT INTO secret VALUES (1)",
+		"ANALYZE",
+	)
+	setTestTableAccess(t, "", schema+".secret*")
+	ctx := context.Background()
+
+	names := func(rows []map[string]interface{}, key string) map[string]bool {
+		out := map[string]bool{}
+		for _, row := range rows {
+			out[row[key].(string)] = true
+		}
+		return out
+	}
+
+	detailed, err := ListTablesDetailed(db, schema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := names(detailed, "name"); got["secret"] || got["secret_child"] || !got["visible"] {
+		t.Errorf("ListTablesDetailed = %v", got)
+	}
+
+	noPK, err := FindTablesWithoutPrimaryKey(db, schema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := names(noPK, "table"); got["secret_child"] || !got["visible"] {
+		t.Errorf("FindTablesWithoutPrimaryKey = %v", got)
+	}
+
+	bloat, err := EstimateBloat(db, schema, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := names(bloat, "table"); got["secret"] || got["secret_child"] {
+		t.Errorf("EstimateBloat = %v", got)
+	}
+
+	// visible_child references the hidden table, so its key is left out too
+	unindexed, err := FindUnindexedForeignKeys(db, schema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(unindexed) != 0 {
+		t.Errorf("FindUnindexedForeignKeys = %v, want none", unindexed)
+	}
+
+	recent, err := GetRecentlyModifiedTables(db, schema, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := names(recent["tables"].([]map[string]interface{}), "table"); got["secret"] || got["secret_child"] {
+		t.Errorf("GetRecentlyModifiedTables = %v", got)
+	}
+
+	byName := map[string]func() error{
+		"GetIndexedColumns": func() error {
+			_, err := GetIndexedColumns(db, schema, "secret")
+			return err
+		},
+		"SuggestPaginationKeys": func() error {
+			_, err := SuggestPaginationKeys(db, schema, "secret")
+			return err
+		},
+		"ListRLSPolicies": func() error {
+			_, err := ListRLSPolicies(db, schema, "secret")
+			return err
+		},
+		"TruncateTable": func() error {
+			_, err := TruncateTable(ctx, db, schema, "secret", "secret", false, false)
+			return err
+		},
+		"TruncateTable cascading to a hidden table": func() error {
+			mustExec(t, db, "CREATE TABLE "+schema+".parent (id int PRIMARY KEY)")
+			mustExec(t, db, "ALTER TABLE "+schema+".secret_child ADD COLUMN parent_id int REFERENCES "+schema+".parent")
+			_, err := TruncateTable(ctx, db, schema, "parent", "parent", false, true)
+			return err
+		},
+	}
+	for name, call := range byName {
+		if err := call(); !errors.Is(err, ErrAccessDenied) {
+			t.Errorf("%s on a hidden table: err = %v, want ErrAccessDenied", name, err)
+		}
+	}
+
+	var count int
+	if err := db.QueryRow("SELECT count(*) FROM " + schema + ".secret").Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 {
+		t.Fatalf("hidden table was truncated")
+	}
+}
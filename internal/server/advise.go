@@ -0,0 +1,137 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Advisory severities, from least to most urgent
+const (
+	SeverityInfo     = "info"
+	SeverityWarning  = "warning"
+	SeverityCritical = "critical"
+)
+
+// largeTableRows is the estimated row count above which an unfiltered scan is flagged
+const largeTableRows = 10000
+
+// largeOffset is the OFFSET above which keyset pagination is suggested
+const largeOffset = 1000
+
+var (
+	selectStarPattern    = regexp.MustCompile(`\bselect\s+(?:distinct\s+)?(?:\w+\.)?\*`)
+	leadingWildcardLike  = regexp.MustCompile(`(?i)\bi?like\s+'%`)
+	notInSubqueryPattern = regexp.MustCompile(`\bnot\s+in\s*\(\s*select\b`)
+	offsetPattern        = regexp.MustCompile(`(?i)\boffset\s+(\d+)`)
+	wherePattern         = regexp.MustCompile(`\bwhere\b`)
+)
+
+// AdviseQuery inspects a query without executing it and returns advisories,
+// each with a category, severity and message. Text rules catch patterns such as
+// SELECT * or leading-wildcard LIKE; plan rules use EXPLAIN to find unfiltered
+// scans of large tables and joins without a join condition.
+func AdviseQuery(ctx context.Context, db *sql.DB, schema, query string) ([]map[string]interface{}, error) {
+	advisories := []map[string]interface{}{}
+	add := func(category, severity, message string) {
+		advisories = append(advisories, map[string]interface{}{
+			"category": category,
+			"severity": severity,
+			"message":  message,
+		})
+	}
+
+	adviseQueryText(query, add)
+
+	planJSON, err := explainJSON(ctx, db, schema, query)
+	if errors.Is(err, ErrAccessDenied) || errors.Is(err, ErrMultipleStatements) || errors.Is(err, ErrTooManyTables) {
+		return nil, err
+	}
+	if err != nil {
+		add("validity", SeverityInfo, fmt.Sprintf("plan-based checks skipped: %v", err))
+		return advisories, nil
+	}
+	var plans []struct {
+		Plan map[string]interface{} `json:"Plan"`
+	}
+	if err := json.Unmarshal(planJSON, &plans); err != nil {
+		return nil, fmt.Errorf("failed to parse query plan: %w", err)
+	}
+	for _, p := range plans {
+		advisePlanNode(p.Plan, add)
+	}
+
+	return advisories, nil
+}
+
+// adviseQueryText applies the text rules to a query
+func adviseQueryText(query string, add func(category, severity, message string)) {
+	normalized := NormalizeQuery(query)
+	firstWord, _, _ := strings.Cut(normalized, " ")
+
+	if (firstWord == "update" || firstWord == "delete") && !wherePattern.MatchString(normalized) {
+		add("safety", SeverityCritical, strings.ToUpper(firstWord)+" without a WHERE clause affects every row of the table")
+	}
+	if selectStarPattern.MatchString(normalized) {
+		add("performance", SeverityInfo, "SELECT * used; list the columns you need to reduce transferred data and keep the query stable when columns change")
+	}
+	if leadingWildcardLike.MatchString(query) {
+		add("performance", SeverityWarning, "LIKE pattern with a leading wildcard cannot use a btree index; consider a trigram (pg_trgm) index or full-text search")
+	}
+	if notInSubqueryPattern.MatchString(normalized) {
+		add("correctness", SeverityWarning, "NOT IN (subquery) returns no rows if the subquery yields any NULL; NOT EXISTS is usually what is meant")
+	}
+	if m := offsetPattern.FindStringSubmatch(query); m != nil {
+		if offset, _ := strconv.Atoi(m[1]); offset > largeOffset {
+			add("performance", SeverityWarning, fmt.Sprintf("OFFSET %d still reads and discards every skipped row; use keyset pagination (see suggestPaginationKeys)", offset))
+		}
+	}
+}
+
+// advisePlanNode applies the plan rules to a node and its children
+func advisePlanNode(node map[string]interface{}, add func(category, severity, message string)) {
+	nodeType, _ := node["Node Type"].(string)
+	children, _ := node["Plans"].([]interface{})
+
+	switch nodeType {
+	case "Seq Scan":
+		rows, _ := node["Plan Rows"].(float64)
+		if _, filtered := node["Filter"]; !filtered && rows > largeTableRows {
+			add("performance", SeverityWarning, fmt.Sprintf("full scan of %v (about %.0f rows) with no filter; add a WHERE clause or LIMIT", node["Relation Name"], rows))
+		}
+	case "Nested Loop":
+		_, hasJoinFilter := node["Join Filter"]
+		if !hasJoinFilter && len(children) == 2 {
+			if inner, ok := children[1].(map[string]interface{}); ok && !hasCondition(inner) {
+				add("correctness", SeverityWarning, "join without a join condition produces a cross product of the joined tables; check for a missing ON clause or an implicit comma join")
+			}
+		}
+	}
+
+	for _, child := range children {
+		if childNode, ok := child.(map[string]interface{}); ok {
+			advisePlanNode(childNode, add)
+		}
+	}
+}
+
+// hasCondition reports whether a plan subtree applies any condition that could relate it to the outer side of a join
+func hasCondition(node map[string]interface{}) bool {
+	for _, key := range []string{"Filter", "Index Cond", "Recheck Cond", "Join Filter", "Hash Cond", "Merge Cond", "Cache Key"} {
+		if _, ok := node[key]; ok {
+			return true
+		}
+	}
+	children, _ := node["Plans"].([]interface{})
+	for _, child := range children {
+		if childNode, ok := child.(map[string]interface{}); ok && hasCondition(childNode) {
+			return true
+		}
+	}
+	return false
+}
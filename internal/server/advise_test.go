@@ -0,0 +1,165 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// collectAdvisories returns an add func for the rules and the categories it
+// was called with, each joined to its severity
+func collectAdvisories() (func(category, severity, message string), *[]string) {
+	var got []string
+	return func(category, severity, message string) {
+		got = append(got, category+"/"+severity)
+	}, &got
+}
+
+func TestAdviseQueryText(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		want  []string
+	}{
+		{"clean query", "SELECT id, name FROM users WHERE id = $1", nil},
+		{"update without where", "UPDATE users SET active = false", []string{"safety/critical"}},
+		{"delete without where", "DELETE FROM users", []string{"safety/critical"}},
+		{"delete with where", "DELETE FROM users WHERE id = 1", nil},
+		{"select star", "SELECT * FROM users WHERE id = 1", []string{"performance/info"}},
+		{"qualified select star", "SELECT DISTINCT u.* FROM users u WHERE id = 1", []string{"performance/info"}},
+		{"leading wildcard like", "SELECT id FROM users WHERE name LIKE '%son'", []string{"performance/warning"}},
+		{"leading wildcard ilike", "SELECT id FROM users WHERE name ILIKE '%son'", []string{"performance/warning"}},
+		{"trailing wildcard like", "SELECT id FROM users WHERE name LIKE 'jo%'", nil},
+		{"not in subquery", "SELECT id FROM users WHERE id NOT IN (SELECT user_id FROM bans)", []string{"correctness/warning"}},
+		{"large offset", "SELECT id FROM users WHERE true ORDER BY id OFFSET 5000", []string{"performance/warning"}},
+		{"small offset", "SELECT id FROM users WHERE true ORDER BY id OFFSET 20", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			add, got := collectAdvisories()
+			adviseQueryText(tt.query, add)
+			if strings.Join(*got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("adviseQueryText(%q) = %v, want %v", tt.query, *got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAdvisePlanNode(t *testing.T) {
+	tests := []struct {
+		name string
+		plan string
+		want []string
+	}{
+		{
+			"unfiltered scan of a large table",
+			`{"Node Type": "Seq Scan", "Relation Name": "events", "Plan Rows": 500000}`,
+			[]string{"performance/warning"},
+		},
+		{
+			"filtered scan of a large table",
+			`{"Node Type": "Seq Scan", "Relation Name": "events", "Plan Rows": 500000, "Filter": "(id > 10)"}`,
+			nil,
+		},
+		{
+			"unfiltered scan of a small table",
+			`{"Node Type": "Seq Scan", "Relation Name": "events", "Plan Rows": 10}`,
+			nil,
+		},
+		{
+			"cross join",
+			`{"Node Type": "Nested Loop", "Plans": [
+				{"Node Type": "Seq Scan", "Relation Name": "a", "Plan Rows": 10},
+				{"Node Type": "Materialize", "Plans": [{"Node Type": "Seq Scan", "Relation Name": "b", "Plan Rows": 10}]}
+			]}`,
+			[]string{"correctness/warning"},
+		},
+		{
+			"nested loop with an index condition",
+			`{"Node Type": "Nested Loop", "Plans": [
+				{"Node Type": "Seq Scan", "Relation Name": "a", "Plan Rows": 10},
+				{"Node Type": "Index Scan", "Relation Name": "b", "Plan Rows": 1, "Index Cond": "(id = a.b_id)"}
+			]}`,
+			nil,
+		},
+		{
+			"nested loop with a join filter",
+			`{"Node Type": "Nested Loop", "Join Filter": "(a.x < b.y)", "Plans": [
+				{"Node Type": "Seq Scan", "Relation Name": "a", "Plan Rows": 10},
+				{"Node Type": "Seq Scan", "Relation Name": "b", "Plan Rows": 10}
+			]}`,
+			nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var node map[string]interface{}
+			if err := json.Unmarshal([]byte(tt.plan), &node); err != nil {
+				t.Fatal(err)
+			}
+			add, got := collectAdvisories()
+			advisePlanNode(node, add)
+			if strings.Join(*got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("advisories = %v, want %v", *got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAdviseQuery(t *testing.T) {
+	db := testDB(t)
+	schema := testSchema(t, db,
+		"CREATE TABLE a (id int)",
+		"CREATE TABLE b (id int)",
+		"CREATE TABLE secret (id int)",
+	)
+	setTestTableAccess(t, "", schema+".secret")
+	ctx := context.Background()
+
+	advisories, err := AdviseQuery(ctx, db, schema, "SELECT * FROM a, b")
+	if err != nil {
+		t.Fatalf("AdviseQuery: %v", err)
+	}
+	var categories []string
+	for _, a := range advisories {
+		categories = append(categories, a["category"].(string))
+	}
+	if got := strings.Join(categories, ","); got != "performance,correctness" {
+		t.Errorf("categories = %s, want performance,correctness", got)
+	}
+
+	// A query that cannot be planned still gets the text rules
+	advisories, err = AdviseQuery(ctx, db, schema, "SELECT * FROM missing")
+	if err != nil {
+		t.Fatalf("AdviseQuery on a missing table: %v", err)
+	}
+	if n := len(advisories); n != 2 || advisories[1]["category"] != "validity" {
+		t.Errorf("advisories = %v, want SELECT * and a validity note", advisories)
+	}
+
+	if _, err := AdviseQuery(ctx, db, schema, "SELECT * FROM secret"); !errors.Is(err, ErrAccessDenied) {
+		t.Errorf("denied table: err = %v, want ErrAccessDenied", err)
+	}
+	if _, err := AdviseQuery(ctx, db, schema, "SELECT 1; DROP TABLE a"); !errors.Is(err, ErrMultipleStatements) {
+		t.Errorf("multiple statements: err = %v, want ErrMultipleStatements", err)
+	}
+}
+
+func TestEstimateResultSize(t *testing.T) {
+	db := testDB(t)
+	schema := testSchema(t, db, "CREATE TABLE secret (id int)")
+	setTestTableAccess(t, "", schema+".secret")
+
+	if _, err := EstimateResultSize(context.Background(), db, schema, "SELECT * FROM secret"); !errors.Is(err, ErrAccessDenied) {
+		t.Errorf("denied table: err = %v, want ErrAccessDenied", err)
+	}
+	estimate, err := EstimateResultSize(context.Background(), db, schema, "SELECT generate_series(1, 100)")
+	if err != nil {
+		t.Fatalf("EstimateResultSize: %v", err)
+	}
+	if estimate["recommendation"] != "executeQuery" {
+		t.Errorf("recommendation = %v, want executeQuery", estimate["recommendation"])
+	}
+}
@@ -0,0 +1,171 @@
+package server
+
+import (
+	"errors"
+	"strings"
+)
+
+// errBadArrayLiteral is returned for text that is not a valid Postgres array literal
+var errBadArrayLiteral = errors.New("malformed array literal")
+
+// isArrayType reports whether a lib/pq database type name is an array type,
+// which Postgres names after the element type with a leading underscore (_INT4)
+func isArrayType(dbType string) bool {
+	return len(dbType) > 1 && dbType[0] == '_'
+}
+
+// convertArray turns a Postgres array literal such as {1,NULL,3} or
+// {{a,b},{c,d}} into nested JSON arrays, converting each element as a value
+// of the array's element type. Unparseable input is returned as the raw text.
+func convertArray(literal, dbType string, opts QueryOptions) interface{} {
+	elemType := dbType[1:]
+	delim := byte(',')
+	if elemType == "BOX" {
+		delim = ';'
+	}
+
+	parsed, err := parseArrayLiteral(literal, delim)
+	if err != nil {
+		return literal
+	}
+	return convertArrayElements(parsed, elemType, opts)
+}
+
+// textElementTypes are the element types lib/pq returns as strings for a
+// scalar column, so their array elements are kept as text too rather than
+// being parsed as numbers
+var textElementTypes = map[string]bool{"TEXT": true, "VARCHAR": true, "CHAR": true}
+
+// convertArrayElements converts the leaves produced by parseArrayLiteral
+func convertArrayElements(elems []interface{}, elemType string, opts QueryOptions) []interface{} {
+	out := make([]interface{}, len(elems))
+	for i, elem := range elems {
+		switch e := elem.(type) {
+		case []interface{}:
+			out[i] = convertArrayElements(e, elemType, opts)
+		case string:
+			if textElementTypes[elemType] {
+				out[i] = e
+			} else {
+				out[i] = convertColumnValue([]byte(e), elemType, opts)
+			}
+		default:
+			out[i] = nil
+		}
+	}
+	return out
+}
+
+// parseArrayLiteral parses Postgres array output into nested slices whose
+// leaves are strings, or nil for NULL elements
+func parseArrayLiteral(s string, delim byte) ([]interface{}, error) {
+	// Arrays with non-default bounds are prefixed with their dimensions, e.g. [0:2]={1,2,3}
+	if strings.HasPrefix(s, "[") {
+		i := strings.Index(s, "=")
+		if i < 0 {
+			return nil, errBadArrayLiteral
+		}
+		s = s[i+1:]
+	}
+
+	p := arrayParser{s: s, delim: delim}
+	elems, err := p.parseArray()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos != len(p.s) {
+		return nil, errBadArrayLiteral
+	}
+	return elems, nil
+}
+
+type arrayParser struct {
+	s     string
+	pos   int
+	delim byte
+}
+
+func (p *arrayParser) parseArray() ([]interface{}, error) {
+	if p.pos >= len(p.s) || p.s[p.pos] != '{' {
+		return nil, errBadArrayLiteral
+	}
+	p.pos++
+
+	elems := []interface{}{}
+	if p.pos < len(p.s) && p.s[p.pos] == '}' {
+		p.pos++
+		return elems, nil
+	}
+	for {
+		if p.pos >= len(p.s) {
+			return nil, errBadArrayLiteral
+		}
+
+		var elem interface{}
+		var err error
+		switch p.s[p.pos] {
+		case '{':
+			elem, err = p.parseArray()
+		case '"':
+			elem, err = p.parseQuoted()
+		default:
+			elem, err = p.parseUnquoted()
+		}
+		if err != nil {
+			return nil, err
+		}
+		elems = append(elems, elem)
+
+		if p.pos >= len(p.s) {
+			return nil, errBadArrayLiteral
+		}
+		switch p.s[p.pos] {
+		case p.delim:
+			p.pos++
+		case '}':
+			p.pos++
+			return elems, nil
+		default:
+			return nil, errBadArrayLiteral
+		}
+	}
+}
+
+func (p *arrayParser) parseQuoted() (interface{}, error) {
+	p.pos++
+	var b strings.Builder
+	for p.pos < len(p.s) {
+		c := p.s[p.pos]
+		switch c {
+		case '\\':
+			p.pos++
+			if p.pos >= len(p.s) {
+				return nil, errBadArrayLiteral
+			}
+			b.WriteByte(p.s[p.pos])
+		case '"':
+			p.pos++
+			return b.String(), nil
+		default:
+			b.WriteByte(c)
+		}
+		p.pos++
+	}
+	return nil, errBadArrayLiteral
+}
+
+func (p *arrayParser) parseUnquoted() (interface{}, error) {
+	start := p.pos
+	for p.pos < len(p.s) && p.s[p.pos] != p.delim && p.s[p.pos] != '}' {
+		p.pos++
+	}
+	elem := p.s[start:p.pos]
+	if elem == "" {
+		return nil, errBadArrayLiteral
+	}
+	// Only an unquoted NULL is a null element; "NULL" in quotes is the string
+	if strings.EqualFold(elem, "NULL") {
+		return nil, nil
+	}
+	return elem, nil
+}
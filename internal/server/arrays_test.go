@@ -0,0 +1,80 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestConvertArray(t *testing.T) {
+	tests := []struct {
+		name    string
+		literal string
+		dbType  string
+		want    interface{}
+	}{
+		{"int array", "{1,2,3}", "_INT4", []interface{}{int64(1), int64(2), int64(3)}},
+		{"null elements", "{1,NULL,3}", "_INT4", []interface{}{int64(1), nil, int64(3)}},
+		{"empty", "{}", "_INT4", []interface{}{}},
+		{"text array", `{plain,"with space","quote \" and \\ slash",""}`, "_TEXT", []interface{}{"plain", "with space", `quote " and \ slash`, ""}},
+		{"quoted NULL is a string", `{"NULL",null}`, "_TEXT", []interface{}{"NULL", nil}},
+		{"numeric text stays text", "{007,42}", "_TEXT", []interface{}{"007", "42"}},
+		{"two dimensions", "{{1,2},{3,4}}", "_INT8", []interface{}{
+			[]interface{}{int64(1), int64(2)},
+			[]interface{}{int64(3), int64(4)},
+		}},
+		{"three dimensions", "{{{a}},{{b}}}", "_VARCHAR", []interface{}{
+			[]interface{}{[]interface{}{"a"}},
+			[]interface{}{[]interface{}{"b"}},
+		}},
+		{"nulls in nested arrays", "{{1,NULL},{NULL,4}}", "_INT4", []interface{}{
+			[]interface{}{int64(1), nil},
+			[]interface{}{nil, int64(4)},
+		}},
+		{"explicit bounds", "[0:2]={7,8,9}", "_INT4", []interface{}{int64(7), int64(8), int64(9)}},
+		{"numeric elements stay exact", "{1.10,12345678901234567890.5}", "_NUMERIC", []interface{}{"1.10", "12345678901234567890.5"}},
+		{"json elements", `{"{\"a\": 1}",null}`, "_JSONB", []interface{}{map[string]interface{}{"a": json.Number("1")}, nil}},
+		{"box uses semicolons", "{(1,1),(0,0);(2,2),(1,1)}", "_BOX", []interface{}{"(1,1),(0,0)", "(2,2),(1,1)"}},
+		{"malformed is returned raw", "{1,2", "_INT4", "{1,2"},
+		{"trailing text is returned raw", "{1}x", "_INT4", "{1}x"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := convertColumnValue([]byte(tt.literal), tt.dbType, QueryOptions{})
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("convertColumnValue(%q, %s) = %#v, want %#v", tt.literal, tt.dbType, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsArrayType(t *testing.T) {
+	for dbType, want := range map[string]bool{"_INT4": true, "_TEXT": true, "INT4": false, "_": false, "": false} {
+		if got := isArrayType(dbType); got != want {
+			t.Errorf("isArrayType(%q) = %v, want %v", dbType, got, want)
+		}
+	}
+}
+
+func TestQueryArrayColumns(t *testing.T) {
+	db := testDB(t)
+	result, err := ExecuteQueryWithOptions(context.Background(), db, "public", `
+		SELECT ARRAY[1, NULL, 3]::int[] AS ints,
+			ARRAY['a', 'b,c', NULL, '"q"', '007']::text[] AS texts,
+			ARRAY[[1, 2], [3, 4]]::int[] AS grid,
+			'{}'::int[] AS empty`, nil, QueryOptions{NoCache: true})
+	if err != nil {
+		t.Fatalf("ExecuteQueryWithOptions: %v", err)
+	}
+	row := result["rows"].([]map[string]interface{})[0]
+	want := map[string]interface{}{
+		"ints":  []interface{}{int64(1), nil, int64(3)},
+		"texts": []interface{}{"a", "b,c", nil, `"q"`, "007"},
+		"grid":  []interface{}{[]interface{}{int64(1), int64(2)}, []interface{}{int64(3), int64(4)}},
+		"empty": []interface{}{},
+	}
+	if !reflect.DeepEqual(row, want) {
+		t.Errorf("row = %#v, want %#v", row, want)
+	}
+}
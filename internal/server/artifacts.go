@@ -0,0 +1,122 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultArtifactThreshold is the bytea size above which values are stored as artifacts
+	defaultArtifactThreshold = 64 * 1024
+	// defaultArtifactTTL is how long an artifact can be downloaded after it was stored
+	defaultArtifactTTL = 5 * time.Minute
+)
+
+// artifact is a binary value held in memory until it expires
+type artifact struct {
+	data        []byte
+	contentType string
+	expiresAt   time.Time
+}
+
+// artifactStore is a short-lived in-memory store for large binary result values
+type artifactStore struct {
+	mu       sync.Mutex
+	ttl      time.Duration
+	minSize  int
+	baseURL  string
+	contents map[string]artifact
+}
+
+var artifacts = &artifactStore{
+	ttl:      defaultArtifactTTL,
+	minSize:  defaultArtifactThreshold,
+	contents: make(map[string]artifact),
+}
+
+// ConfigureArtifacts sets the artifact size threshold, lifetime and the base URL used in artifact links
+func ConfigureArtifacts(threshold int, ttl time.Duration, baseURL string) {
+	artifacts.mu.Lock()
+	defer artifacts.mu.Unlock()
+
+	if threshold > 0 {
+		artifacts.minSize = threshold
+	}
+	if ttl > 0 {
+		artifacts.ttl = ttl
+	}
+	artifacts.baseURL = strings.TrimSuffix(baseURL, "/")
+}
+
+func (s *artifactStore) threshold() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.minSize
+}
+
+// put stores data and returns the descriptor that replaces it in a result row
+func (s *artifactStore) put(data []byte) map[string]interface{} {
+	idBytes := make([]byte, 16)
+	rand.Read(idBytes)
+	id := hex.EncodeToString(idBytes)
+	contentType := http.DetectContentType(data)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for key, a := range s.contents {
+		if now.After(a.expiresAt) {
+			delete(s.contents, key)
+		}
+	}
+	expiresAt := now.Add(s.ttl)
+	s.contents[id] = artifact{
+		data:        data,
+		contentType: contentType,
+		expiresAt:   expiresAt,
+	}
+
+	return map[string]interface{}{
+		"artifact_url": s.baseURL + "/artifact/" + id,
+		"content_type": contentType,
+		"size":         len(data),
+		"expires_at":   expiresAt,
+	}
+}
+
+func (s *artifactStore) get(id string) (artifact, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	a, ok := s.contents[id]
+	if !ok {
+		return artifact{}, false
+	}
+	if time.Now().After(a.expiresAt) {
+		delete(s.contents, id)
+		return artifact{}, false
+	}
+	return a, true
+}
+
+// ArtifactHandler serves the raw bytes of a stored artifact at /artifact/<id>
+func ArtifactHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := strings.TrimPrefix(r.URL.Path, "/artifact/")
+		a, ok := artifacts.get(id)
+		if !ok {
+			writeJSONError(w, http.StatusNotFound, "Artifact not found or expired")
+			return
+		}
+
+		w.Header().Set("Content-Type", a.contentType)
+		w.Header().Set("Content-Length", strconv.Itoa(len(a.data)))
+		w.Write(a.data)
+	}
+}
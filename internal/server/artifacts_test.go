@@ -0,0 +1,111 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// setTestArtifacts swaps in an empty artifact store for the test
+func setTestArtifacts(t *testing.T, threshold int, ttl time.Duration) *artifactStore {
+	t.Helper()
+	saved := artifacts
+	artifacts = &artifactStore{
+		ttl:      ttl,
+		minSize:  threshold,
+		baseURL:  "http://mcp.test",
+		contents: make(map[string]artifact),
+	}
+	t.Cleanup(func() { artifacts = saved })
+	return artifacts
+}
+
+// getArtifact requests an artifact link from ArtifactHandler
+func getArtifact(url string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	ArtifactHandler()(rec, httptest.NewRequest(http.MethodGet, strings.TrimPrefix(url, "http://mcp.test"), nil))
+	return rec
+}
+
+func TestArtifactStoreRoundTrip(t *testing.T) {
+	store := setTestArtifacts(t, 4, time.Minute)
+	png := append([]byte("\x89PNG\r\n\x1a\n"), bytes.Repeat([]byte{0}, 32)...)
+
+	desc := store.put(png)
+	url, _ := desc["artifact_url"].(string)
+	if !strings.HasPrefix(url, "http://mcp.test/artifact/") {
+		t.Fatalf("artifact_url = %q", url)
+	}
+	if desc["size"] != len(png) || desc["content_type"] != "image/png" {
+		t.Errorf("descriptor = %v", desc)
+	}
+
+	rec := getArtifact(url)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", rec.Code)
+	}
+	if got := rec.Header().Get("Content-Type"); got != "image/png" {
+		t.Errorf("Content-Type = %q, want image/png", got)
+	}
+	if !bytes.Equal(rec.Body.Bytes(), png) {
+		t.Error("served bytes differ from the stored value")
+	}
+
+	if rec := getArtifact("/artifact/unknown"); rec.Code != http.StatusNotFound {
+		t.Errorf("unknown artifact: status = %d, want 404", rec.Code)
+	}
+}
+
+func TestArtifactStoreExpiry(t *testing.T) {
+	store := setTestArtifacts(t, 4, time.Minute)
+	url := store.put([]byte("old value"))["artifact_url"].(string)
+	id := strings.TrimPrefix(url, "http://mcp.test/artifact/")
+
+	store.mu.Lock()
+	a := store.contents[id]
+	a.expiresAt = time.Now().Add(-time.Second)
+	store.contents[id] = a
+	store.mu.Unlock()
+
+	if rec := getArtifact(url); rec.Code != http.StatusNotFound {
+		t.Errorf("expired artifact: status = %d, want 404", rec.Code)
+	}
+	if _, ok := store.contents[id]; ok {
+		t.Error("expired artifact was not evicted")
+	}
+}
+
+func TestExecuteQueryBinaryArtifacts(t *testing.T) {
+	db := testDB(t)
+	schema := testSchema(t, db,
+		"CREATE TABLE files (name text, body bytea)",
+		"INSERT INTO files VALUES ('small', 'abc'), ('large', convert_to(repeat('x', 100), 'UTF8'))",
+	)
+	setTestArtifacts(t, 16, time.Minute)
+
+	result, err := ExecuteQueryWithOptions(context.Background(), db, schema, "SELECT name, body FROM files ORDER BY name", nil, QueryOptions{BinaryArtifacts: true, NoCache: true})
+	if err != nil {
+		t.Fatalf("ExecuteQueryWithOptions: %v", err)
+	}
+	rows := result["rows"].([]map[string]interface{})
+	if len(rows) != 2 {
+		t.Fatalf("got %d rows, want 2", len(rows))
+	}
+
+	large, ok := rows[0]["body"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("large body = %#v, want an artifact descriptor", rows[0]["body"])
+	}
+	rec := getArtifact(large["artifact_url"].(string))
+	if rec.Code != http.StatusOK || rec.Body.String() != strings.Repeat("x", 100) {
+		t.Errorf("artifact download: status %d, %d bytes", rec.Code, rec.Body.Len())
+	}
+	// Values under the threshold stay inline
+	if _, ok := rows[1]["body"].(map[string]interface{}); ok {
+		t.Errorf("small body = %v, want it inline", rows[1]["body"])
+	}
+}
@@ -0,0 +1,78 @@
+package server
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync/atomic"
+)
+
+// autoLimit is the LIMIT appended to unbounded SELECTs; zero disables it
+var autoLimit atomic.Int64
+
+// SetAutoLimit makes queries append LIMIT n to plain top-level SELECTs without
+// a LIMIT of their own; zero, the default, disables it
+func SetAutoLimit(n int) {
+	autoLimit.Store(int64(n))
+}
+
+// autoLimitSkipPattern matches top-level clauses that rule out an automatic
+// LIMIT: an existing row limit, aggregation, locking and SELECT INTO
+var autoLimitSkipPattern = regexp.MustCompile(`\b(limit|fetch|group by|having|for|into)\b|\b(count|sum|avg|min|max|every|bool_and|bool_or|bit_and|bit_or|array_agg|string_agg|json_agg|jsonb_agg|json_object_agg|jsonb_object_agg|xmlagg|stddev\w*|variance|var_pop|var_samp|mode|percentile_cont|percentile_disc) ?\(`)
+
+// applyAutoLimit appends the configured LIMIT to a single top-level SELECT
+// lacking one, returning the query to run and the limit applied, or zero when
+// the query is left unchanged. CTEs, aggregates, queries that already limit
+// their rows and anything that is not a plain read are never rewritten.
+func applyAutoLimit(query string) (string, int) {
+	limit := int(autoLimit.Load())
+	if limit <= 0 {
+		return query, 0
+	}
+
+	trimmed := strings.TrimSuffix(strings.TrimSpace(query), ";")
+	// A semicolon left over may end a statement followed by a comment, which
+	// would swallow the LIMIT, so such queries are left alone
+	if strings.Contains(trimmed, ";") || !isReadOnlyQuery(trimmed) {
+		return query, 0
+	}
+	topLevel := topLevelText(NormalizeQuery(trimmed))
+	if !strings.HasPrefix(topLevel, "select") || autoLimitSkipPattern.MatchString(topLevel) {
+		return query, 0
+	}
+	// The newline ends a trailing line comment before the LIMIT
+	return fmt.Sprintf("%s\nLIMIT %d", trimmed, limit), limit
+}
+
+// topLevelText strips parenthesized contents from a normalized query, leaving
+// empty parentheses, so subqueries and function arguments are not matched
+func topLevelText(normalized string) string {
+	var b strings.Builder
+	depth := 0
+	quoted := false
+	for _, r := range normalized {
+		switch {
+		case r == '"':
+			quoted = !quoted
+		case quoted:
+		case r == '(':
+			if depth == 0 {
+				b.WriteRune(r)
+			}
+			depth++
+			continue
+		case r == ')':
+			if depth > 0 {
+				depth--
+			}
+			if depth == 0 {
+				b.WriteRune(r)
+			}
+			continue
+		}
+		if depth == 0 && !quoted && r != '"' {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,155 @@
+package server
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// catalogFixture covers the column types and constraints whose information_schema
+// rendering the pg_catalog queries reproduce
+var catalogFixture = []string{
+	"CREATE TYPE mood AS ENUM ('happy', 'sad')",
+	"CREATE DOMAIN positive AS int CHECK (VALUE > 0)",
+	"CREATE DOMAIN tags AS text[]",
+	`CREATE TABLE parents (
+		a int,
+		b text,
+		PRIMARY KEY (a, b)
+	)`,
+	"CREATE TABLE owners (id int PRIMARY KEY)",
+	`CREATE TABLE kitchen_sink (
+		id serial PRIMARY KEY,
+		dropped int,
+		name varchar(20) NOT NULL DEFAULT 'x',
+		amount numeric(10, 2),
+		scores int[],
+		labels tags,
+		qty positive,
+		feeling mood,
+		created timestamptz DEFAULT now(),
+		doubled int GENERATED ALWAYS AS (id * 2) STORED,
+		parent_a int,
+		parent_b text,
+		owner_id int REFERENCES owners,
+		FOREIGN KEY (parent_a, parent_b) REFERENCES parents (a, b)
+	)`,
+	"ALTER TABLE kitchen_sink DROP COLUMN dropped",
+	"CREATE VIEW sink_names AS SELECT id, name FROM kitchen_sink",
+	"CREATE TABLE events (id int, at date) PARTITION BY RANGE (at)",
+	"CREATE TABLE events_2024 PARTITION OF events FOR VALUES FROM ('2024-01-01') TO ('2025-01-01')",
+	"CREATE SEQUENCE counter",
+}
+
+// queryStrings runs a query whose columns are all text and joins each row with |
+func queryStrings(t *testing.T, db *sql.DB, query string, args ...interface{}) []string {
+	t.Helper()
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		t.Fatalf("reference query: %v", err)
+	}
+	defer rows.Close()
+	cols, _ := rows.Columns()
+	var out []string
+	for rows.Next() {
+		vals := make([]sql.NullString, len(cols))
+		ptrs := make([]interface{}, len(cols))
+		for i := range vals {
+			ptrs[i] = &vals[i]
+		}
+		if err := rows.Scan(ptrs...); err != nil {
+			t.Fatal(err)
+		}
+		parts := make([]string, len(vals))
+		for i, v := range vals {
+			parts[i] = "<null>"
+			if v.Valid {
+				parts[i] = v.String
+			}
+		}
+		out = append(out, strings.Join(parts, "|"))
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+// compareLines fails the test when the catalog and reference results differ
+func compareLines(t *testing.T, what string, got, want []string) {
+	t.Helper()
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("%s differs from information_schema:\n got: %q\nwant: %q", what, got, want)
+	}
+}
+
+func TestCatalogMatchesInformationSchema(t *testing.T) {
+	db := testDB(t)
+	schema := testSchema(t, db, catalogFixture...)
+
+	t.Run("ListTables", func(t *testing.T) {
+		tables, err := ListTables(db, schema)
+		if err != nil {
+			t.Fatalf("ListTables: %v", err)
+		}
+		want := queryStrings(t, db, `
+			SELECT table_name FROM information_schema.tables
+			WHERE table_schema = $1 ORDER BY table_name`, schema)
+		compareLines(t, "ListTables", tables, want)
+	})
+
+	for _, table := range []string{"kitchen_sink", "parents", "sink_names", "events"} {
+		t.Run("DescribeTable "+table, func(t *testing.T) {
+			cols, err := DescribeTable(db, schema, table)
+			if err != nil {
+				t.Fatalf("DescribeTable: %v", err)
+			}
+			var got []string
+			for _, col := range cols {
+				def := "<null>"
+				if d, ok := col["default"].(string); ok {
+					def = d
+				}
+				nullable := "NO"
+				if col["nullable"] == true {
+					nullable = "YES"
+				}
+				got = append(got, fmt.Sprintf("%s|%s|%s|%s|%d", col["name"], col["type"], nullable, def, col["ordinal_position"]))
+			}
+			want := queryStrings(t, db, `
+				SELECT column_name, data_type, is_nullable, column_default, ordinal_position::text
+				FROM information_schema.columns
+				WHERE table_schema = $1 AND table_name = $2
+				ORDER BY ordinal_position`, schema, table)
+			compareLines(t, "DescribeTable", got, want)
+		})
+	}
+
+	t.Run("GetForeignKeys", func(t *testing.T) {
+		fks, err := GetForeignKeys(db, schema, "kitchen_sink")
+		if err != nil {
+			t.Fatalf("GetForeignKeys: %v", err)
+		}
+		var got []string
+		for _, fk := range fks {
+			ref := fk["references"].(map[string]string)
+			got = append(got, strings.Join([]string{fk["column"].(string), ref["schema"], ref["table"], ref["column"]}, "|"))
+		}
+		want := queryStrings(t, db, `
+			SELECT kcu.column_name, fkcu.table_schema, fkcu.table_name, fkcu.column_name
+			FROM information_schema.key_column_usage kcu
+			JOIN information_schema.referential_constraints rc
+				ON rc.constraint_schema = kcu.constraint_schema AND rc.constraint_name = kcu.constraint_name
+			JOIN information_schema.key_column_usage fkcu
+				ON fkcu.constraint_schema = rc.unique_constraint_schema
+				AND fkcu.constraint_name = rc.unique_constraint_name
+				AND fkcu.ordinal_position = kcu.position_in_unique_constraint
+			WHERE kcu.table_schema = $1 AND kcu.table_name = $2
+			ORDER BY kcu.constraint_name, kcu.ordinal_position`, schema, "kitchen_sink")
+		compareLines(t, "GetForeignKeys", got, want)
+		if len(got) != 3 {
+			t.Errorf("got %d foreign key columns, want 3", len(got))
+		}
+	})
+}
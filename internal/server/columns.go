@@ -0,0 +1,187 @@
+package server
+
+import (
+	"database/sql"
+	"fmt"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// defaultColumnCacheTTL is how long a table's column list is trusted before re-querying the catalog
+const defaultColumnCacheTTL = 30 * time.Second
+
+// ddlPattern matches statements that may change a table's columns
+var ddlPattern = regexp.MustCompile(`(?i)\b(create|alter|drop)\b`)
+
+// columnCacheEntry holds a table's column names, the data type of each as
+// DescribeTable reports it, and when they were fetched
+type columnCacheEntry struct {
+	columns   []string
+	types     []string
+	fetchedAt time.Time
+}
+
+// columnCache is a concurrency-safe, short-TTL cache of table columns used by
+// the column validators so repeated calls on the same table skip the catalog query
+type columnCache struct {
+	mu      sync.RWMutex
+	ttl     time.Duration
+	entries map[string]columnCacheEntry
+}
+
+// newColumnCache creates a column cache; a ttl of zero disables caching
+func newColumnCache(ttl time.Duration) *columnCache {
+	return &columnCache{
+		ttl:     ttl,
+		entries: make(map[string]columnCacheEntry),
+	}
+}
+
+var columns = newColumnCache(defaultColumnCacheTTL)
+
+func columnCacheKey(schema, table string) string {
+	return schema + "\x00" + table
+}
+
+func (c *columnCache) get(schema, table string) ([]string, []string, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	entry, ok := c.entries[columnCacheKey(schema, table)]
+	if !ok || time.Since(entry.fetchedAt) > c.ttl {
+		return nil, nil, false
+	}
+	return entry.columns, entry.types, true
+}
+
+func (c *columnCache) set(schema, table string, cols, types []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.ttl <= 0 {
+		return
+	}
+	c.entries[columnCacheKey(schema, table)] = columnCacheEntry{
+		columns:   cols,
+		types:     types,
+		fetchedAt: time.Now(),
+	}
+}
+
+func (c *columnCache) invalidate(schema, table string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, columnCacheKey(schema, table))
+}
+
+func (c *columnCache) reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = make(map[string]columnCacheEntry)
+}
+
+func (c *columnCache) setTTL(ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.ttl = ttl
+	c.entries = make(map[string]columnCacheEntry)
+}
+
+// SetColumnCacheTTL changes how long column lists are cached; zero disables the cache
+func SetColumnCacheTTL(ttl time.Duration) {
+	columns.setTTL(ttl)
+}
+
+// InvalidateColumnCache drops the cached column list for a single table
+func InvalidateColumnCache(schema, table string) {
+	columns.invalidate(schema, table)
+}
+
+// ResetColumnCache drops every cached column list
+func ResetColumnCache() {
+	columns.reset()
+}
+
+// invalidateColumnsForQuery resets the column cache if the query may have changed any table definition
+func invalidateColumnsForQuery(query string) {
+	if ddlPattern.MatchString(query) {
+		columns.reset()
+	}
+}
+
+// TableColumns returns the column names of a table, served from the column cache when fresh
+func TableColumns(db *sql.DB, schema, table string) ([]string, error) {
+	cols, _, err := loadColumns(db, schema, table)
+	return cols, err
+}
+
+// TableColumnTypes returns the data type of each column of a table, keyed by
+// column name, served from the column cache when fresh
+func TableColumnTypes(db *sql.DB, schema, table string) (map[string]string, error) {
+	cols, types, err := loadColumns(db, schema, table)
+	if err != nil {
+		return nil, err
+	}
+	byName := make(map[string]string, len(cols))
+	for i, col := range cols {
+		byName[col] = types[i]
+	}
+	return byName, nil
+}
+
+// loadColumns returns a table's column names and data types in column order,
+// from the cache or the catalog
+func loadColumns(db *sql.DB, schema, table string) ([]string, []string, error) {
+	if cols, types, ok := columns.get(schema, table); ok {
+		return cols, types, nil
+	}
+
+	rows, err := db.Query(`
+		SELECT a.attname, `+pgDataTypeExpr+`
+		`+pgColumnsFrom+`
+		ORDER BY a.attnum;
+	`, schema, table)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	var cols, types []string
+	for rows.Next() {
+		var col, dataType string
+		if err := rows.Scan(&col, &dataType); err != nil {
+			return nil, nil, err
+		}
+		cols = append(cols, col)
+		types = append(types, dataType)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	columns.set(schema, table, cols, types)
+	return cols, types, nil
+}
+
+// ValidateColumns checks that every name is a column of the table
+func ValidateColumns(db *sql.DB, schema, table string, names []string) error {
+	cols, err := TableColumns(db, schema, table)
+	if err != nil {
+		return fmt.Errorf("failed to load columns: %w", err)
+	}
+	if len(cols) == 0 {
+		return fmt.Errorf("table %s.%s not found", schema, table)
+	}
+
+	known := make(map[string]bool, len(cols))
+	for _, col := range cols {
+		known[col] = true
+	}
+	for _, name := range names {
+		if !known[name] {
+			return fmt.Errorf("unknown column %q in table %s.%s", name, schema, table)
+		}
+	}
+	return nil
+}
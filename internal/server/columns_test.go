@@ -0,0 +1,150 @@
+package server
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestColumnCache(t *testing.T) {
+	c := newColumnCache(time.Minute)
+	if _, _, ok := c.get("public", "users"); ok {
+		t.Fatal("empty cache reported a hit")
+	}
+
+	c.set("public", "users", []string{"id", "email"}, []string{"integer", "text"})
+	cols, types, ok := c.get("public", "users")
+	if !ok || strings.Join(cols, ",") != "id,email" || strings.Join(types, ",") != "integer,text" {
+		t.Fatalf("get = %v, %v, %v; want [id email], [integer text], true", cols, types, ok)
+	}
+	// Keys do not run together across the schema and table
+	if _, _, ok := c.get("publicu", "sers"); ok {
+		t.Error("a different schema and table shared an entry")
+	}
+
+	c.set("public", "orders", []string{"id"}, nil)
+	c.invalidate("public", "users")
+	if _, _, ok := c.get("public", "users"); ok {
+		t.Error("invalidated table is still cached")
+	}
+	if _, _, ok := c.get("public", "orders"); !ok {
+		t.Error("invalidating one table dropped another")
+	}
+
+	c.reset()
+	if _, _, ok := c.get("public", "orders"); ok {
+		t.Error("reset left an entry behind")
+	}
+}
+
+func TestColumnCacheExpiry(t *testing.T) {
+	c := newColumnCache(time.Minute)
+	c.entries[columnCacheKey("public", "users")] = columnCacheEntry{
+		columns:   []string{"id"},
+		fetchedAt: time.Now().Add(-2 * time.Minute),
+	}
+	if _, _, ok := c.get("public", "users"); ok {
+		t.Error("expired entry was served")
+	}
+
+	c.setTTL(0)
+	c.set("public", "users", []string{"id"}, nil)
+	if _, _, ok := c.get("public", "users"); ok {
+		t.Error("a zero ttl still cached columns")
+	}
+}
+
+func TestInvalidateColumnsForQuery(t *testing.T) {
+	tests := []struct {
+		query string
+		reset bool
+	}{
+		{"SELECT * FROM users", false},
+		{"UPDATE users SET created = now()", false},
+		{"ALTER TABLE users ADD COLUMN age int", true},
+		{"create table t (id int)", true},
+		{"DROP TABLE users", true},
+	}
+	t.Cleanup(func() { SetColumnCacheTTL(defaultColumnCacheTTL) })
+	for _, tt := range tests {
+		SetColumnCacheTTL(time.Minute)
+		columns.set("public", "users", []string{"id"}, nil)
+		invalidateColumnsForQuery(tt.query)
+		if _, _, ok := columns.get("public", "users"); ok == tt.reset {
+			t.Errorf("%q: cache reset = %v, want %v", tt.query, !ok, tt.reset)
+		}
+	}
+}
+
+func TestTableColumnsCache(t *testing.T) {
+	db := testDB(t)
+	schema := testSchema(t, db, "CREATE TABLE users (id int, email text)")
+	SetColumnCacheTTL(time.Minute)
+	t.Cleanup(func() { SetColumnCacheTTL(defaultColumnCacheTTL) })
+
+	cols, err := TableColumns(db, schema, "users")
+	if err != nil {
+		t.Fatalf("TableColumns: %v", err)
+	}
+	if strings.Join(cols, ",") != "id,email" {
+		t.Fatalf("columns = %v, want [id email]", cols)
+	}
+
+	// A change behind the cache's back is not seen until the entry is dropped
+	mustExec(t, db, "ALTER TABLE "+schema+".users ADD COLUMN age int")
+	if cols, _ := TableColumns(db, schema, "users"); len(cols) != 2 {
+		t.Errorf("columns = %v, want the cached [id email]", cols)
+	}
+	if err := ValidateColumns(db, schema, "users", []string{"age"}); err == nil {
+		t.Error("ValidateColumns accepted a column the cache does not know yet")
+	}
+	InvalidateColumnCache(schema, "users")
+	if cols, _ := TableColumns(db, schema, "users"); len(cols) != 3 {
+		t.Errorf("columns after invalidation = %v, want [id email age]", cols)
+	}
+
+	// DDL run through the query tools drops the cache
+	if _, err := ExecuteQueryContext(context.Background(), db, schema, "ALTER TABLE users DROP COLUMN age", nil); err != nil {
+		t.Fatalf("ALTER TABLE: %v", err)
+	}
+	if err := ValidateColumns(db, schema, "users", []string{"age"}); err == nil {
+		t.Error("ValidateColumns accepted a dropped column after DDL")
+	}
+	if err := ValidateColumns(db, schema, "users", []string{"id", "email"}); err != nil {
+		t.Errorf("ValidateColumns: %v", err)
+	}
+}
+
+func TestWriteColumnTypesUseTheCache(t *testing.T) {
+	db := testDB(t)
+	schema := testSchema(t, db, "CREATE TABLE docs (id int, body jsonb, tags text[])")
+	SetColumnCacheTTL(time.Minute)
+	t.Cleanup(func() { SetColumnCacheTTL(defaultColumnCacheTTL) })
+
+	types, err := writeColumnTypes(db, schema, "docs", []string{"id", "body", "tags"})
+	if err != nil {
+		t.Fatalf("writeColumnTypes: %v", err)
+	}
+	want := map[string]string{"id": "integer", "body": "jsonb", "tags": "[]"}
+	if !reflect.DeepEqual(types, want) {
+		t.Errorf("types = %v, want %v", types, want)
+	}
+
+	// The types come from the column cache, which DDL through the query tools drops
+	mustExec(t, db, "ALTER TABLE "+schema+".docs ADD COLUMN note text")
+	if _, err := writeColumnTypes(db, schema, "docs", []string{"note"}); err == nil {
+		t.Error("writeColumnTypes accepted a column the cache does not know yet")
+	}
+	if _, err := ExecuteQueryContext(context.Background(), db, schema, "ALTER TABLE docs ALTER COLUMN note TYPE jsonb USING note::jsonb", nil); err != nil {
+		t.Fatalf("ALTER TABLE: %v", err)
+	}
+	types, err = writeColumnTypes(db, schema, "docs", []string{"note"})
+	if err != nil {
+		t.Fatalf("writeColumnTypes after DDL: %v", err)
+	}
+	if types["note"] != "jsonb" {
+		t.Errorf("note type = %q, want jsonb", types["note"])
+	}
+}
@@ -1,63 +1,514 @@
 package server
 
 import (
+	"context"
 	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"log/slog"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/lib/pq"
 )
 
+// QueryOptions controls how a query is executed and how its result is built
+type QueryOptions struct {
+	// Role, when set, runs the query on a dedicated connection after SET ROLE
+	Role string
+	// BinaryArtifacts replaces bytea values larger than the artifact threshold
+	// with a link to the artifact store instead of inlining them
+	BinaryArtifacts bool
+	// FormattedMoney returns money values as an object holding both the exact
+	// decimal amount and the server's locale-formatted text
+	FormattedMoney bool
+	// Session, when set, runs the query on the session's pinned connection so
+	// it can see session state such as temp tables
+	Session *Session
+	// ArgTypes optionally hints the Postgres type of each argument, e.g. jsonb or
+	// int[], so JSON arrays are bound as JSON or as an array as intended
+	ArgTypes []string
+	// Progress, when set, is called every ProgressEvery rows while the result is
+	// scanned and once more with the final row count
+	Progress      ProgressFunc
+	ProgressEvery int
+	// MaxRows caps the number of rows returned, clamped to MAX_ROWS; zero means
+	// the configured cap
+	MaxRows int
+	// OnRow, when set, receives each row as soon as it is scanned instead of the
+	// row being kept in the result. Streamed rows are not subject to MaxRows.
+	OnRow func(row map[string]interface{}) error
+	// TimeFormat renders date and timestamp values as rfc3339 (default), unix,
+	// unixmilli or a Go layout string such as 2006-01-02 15:04:05
+	TimeFormat string
+	// NoCache bypasses the result cache, running the query and refreshing the cached result
+	NoCache bool
+
+	// mask masks sensitive columns in the result, set from the query's plan
+	mask *queryMask
+}
+
 // ExecuteQuery executes a SQL query and returns the results
 func ExecuteQuery(db *sql.DB, schema, query string, args []interface{}) (map[string]interface{}, error) {
-	// Set the schema
-	_, err := db.Exec(fmt.Sprintf("SET search_path TO %s", pq.QuoteIdentifier(schema)))
+	return ExecuteQueryContext(context.Background(), db, schema, query, args)
+}
+
+// ExecuteQueryContext executes a SQL query and returns the results, cancelling
+// the query on the server when ctx is cancelled or times out
+func ExecuteQueryContext(ctx context.Context, db *sql.DB, schema, query string, args []interface{}) (map[string]interface{}, error) {
+	return ExecuteQueryWithOptions(ctx, db, schema, query, args, QueryOptions{})
+}
+
+// ExecuteQueryAsRole executes a SQL query on a dedicated connection after SET ROLE,
+// so row-level security and permissions apply as that role. The role is reset
+// before the connection is returned to the pool.
+func ExecuteQueryAsRole(ctx context.Context, db *sql.DB, role, schema, query string, args []interface{}) (map[string]interface{}, error) {
+	return ExecuteQueryWithOptions(ctx, db, schema, query, args, QueryOptions{Role: role})
+}
+
+// ExecuteQueryWithOptions executes a SQL query and returns the results built according to opts.
+// The query is bounded by ctx's deadline, or by the default query timeout when
+// ctx has none, and the same limit is enforced server-side with statement_timeout.
+func ExecuteQueryWithOptions(ctx context.Context, db *sql.DB, schema, query string, args []interface{}, opts QueryOptions) (map[string]interface{}, error) {
+	args, err := coerceArgs(args, opts.ArgTypes)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = WithQueryTimeout(ctx, 0)
+		defer cancel()
+	}
+
+	// Bound plain SELECTs when AUTO_LIMIT is set; streamed results are not limited
+	autoLimited := 0
+	if opts.OnRow == nil {
+		query, autoLimited = applyAutoLimit(query)
+	}
+
+	// Count streamed rows, which are not kept in the result
+	streamed := 0
+	if onRow := opts.OnRow; onRow != nil {
+		opts.OnRow = func(row map[string]interface{}) error {
+			streamed++
+			return onRow(row)
+		}
+	}
+
+	// Read-only results outside sessions are cacheable. A cached result is only
+	// served once the query passes the current table access rules.
+	var cacheKey string
+	if isCacheableQuery(query) && opts.OnRow == nil && opts.Session == nil && results.enabled() {
+		cacheKey = queryCacheKey(schema, query, args, opts)
+		if !opts.NoCache {
+			if cached, ok := results.get(cacheKey); ok {
+				if err := checkCachedQuery(ctx, db, schema, query, args); err != nil {
+					return nil, err
+				}
+				slog.Info("Query cache hit", "schema", schema)
+				return cachedQueryResult(cached.(map[string]interface{})), nil
+			}
+		}
+	}
+
+	start := time.Now()
+	result, err := runQuery(ctx, db, schema, query, args, opts)
+	elapsed := durationMillis(time.Since(start))
+	if err != nil {
+		slog.Warn("Query failed", "schema", schema, "duration_ms", elapsed, "err", err)
+		return nil, err
+	}
+	rowsReturned := streamed
+	if opts.OnRow == nil {
+		rowsReturned, _ = result["row_count"].(int)
+	}
+	slog.Info("Query executed", "schema", schema, "duration_ms", elapsed, "rows_returned", rowsReturned)
+	if autoLimited > 0 {
+		result["auto_limited"] = autoLimited
+	}
+	result["meta"] = map[string]interface{}{
+		"duration_ms":   elapsed,
+		"rows_returned": rowsReturned,
+	}
+	if cacheKey != "" {
+		// Store a copy so callers adding to the returned map do not change the cached one
+		results.set(cacheKey, cachedQueryResult(result))
+	}
+	return result, nil
+}
+
+// cachedQueryResult copies a cached result, marking its meta as served from the cache
+func cachedQueryResult(cached map[string]interface{}) map[string]interface{} {
+	result := make(map[string]interface{}, len(cached))
+	for k, v := range cached {
+		result[k] = v
+	}
+	meta := map[string]interface{}{"cached": true}
+	if m, ok := cached["meta"].(map[string]interface{}); ok {
+		meta["rows_returned"] = m["rows_returned"]
+	}
+	result["meta"] = meta
+	return result
+}
+
+// durationMillis converts d to fractional milliseconds for logs and result metadata
+func durationMillis(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+// runQuery executes a query on the session's pinned connection or on a
+// dedicated pooled connection
+func runQuery(ctx context.Context, db *sql.DB, schema, query string, args []interface{}, opts QueryOptions) (map[string]interface{}, error) {
+	if opts.Session != nil {
+		var result map[string]interface{}
+		err := opts.Session.Do(func(conn *sql.Conn) error {
+			return inSnapshot(ctx, opts.Session, conn, func() error {
+				var err error
+				result, err = executeOnConn(ctx, conn, schema, query, args, opts)
+				return err
+			})
+		})
+		return result, err
+	}
+
+	conn, err := db.Conn(ctx)
 	if err != nil {
+		return nil, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Close()
+	return executeOnConn(ctx, conn, schema, query, args, opts)
+}
+
+// executeOnConn runs a query on a single connection, applying SET ROLE first when
+// a role is requested. search_path is set on the same connection as the query;
+// pooled connections have it reset afterwards so it never leaks to other callers,
+// while a session's pinned connection keeps it like any other session state.
+func executeOnConn(ctx context.Context, conn *sql.Conn, schema, query string, args []interface{}, opts QueryOptions) (map[string]interface{}, error) {
+	if opts.Role != "" {
+		if err := ValidateRole(opts.Role); err != nil {
+			return nil, err
+		}
+		if _, err := conn.ExecContext(ctx, fmt.Sprintf("SET ROLE %s", pq.QuoteIdentifier(opts.Role))); err != nil {
+			return nil, fmt.Errorf("failed to set role: %w", err)
+		}
+		defer resetRole(conn)
+	}
+
+	if _, err := conn.ExecContext(ctx, fmt.Sprintf("SET search_path TO %s", pq.QuoteIdentifier(schema))); err != nil {
 		return nil, fmt.Errorf("failed to set schema: %w", err)
 	}
+	if opts.Session == nil {
+		defer resetSearchPath(conn)
+	}
+	relations, err := checkQueryTables(ctx, conn, query, args, false)
+	if err != nil {
+		return nil, err
+	}
+	opts.mask = newQueryMask(relations)
+
+	start := time.Now()
+	defer recordQuery(query, start)
+
+	var result map[string]interface{}
+	inTx := opts.Session != nil && opts.Session.snapshot != ""
+	err = withStatementTimeout(ctx, conn, inTx, query, func(q rowsQueryer) error {
+		rows, err := q.QueryContext(ctx, query, args...)
+		if err != nil {
+			return fmt.Errorf("query error: %w", err)
+		}
+		defer rows.Close()
+		invalidateColumnsForQuery(query)
+
+		result, err = collectRows(rows, opts)
+		return err
+	})
+	// A statement that may have written drops the whole result cache, since
+	// there is no telling which cached results it made stale
+	if !isCacheableQuery(query) {
+		results.reset()
+	}
+	return result, err
+}
 
-	// Execute the query
-	rows, err := db.Query(query, args...)
+// checkCachedQuery runs the table access checks for a query whose result is
+// about to be served from the cache, so rules changed since it was cached apply
+func checkCachedQuery(ctx context.Context, db *sql.DB, schema, query string, args []interface{}) error {
+	if !tableAccessRestricted() && maxTablesPerQuery.Load() <= 0 {
+		return nil
+	}
+	conn, err := db.Conn(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("query error: %w", err)
+		return fmt.Errorf("failed to acquire connection: %w", err)
 	}
-	defer rows.Close()
+	defer conn.Close()
+	if _, err := conn.ExecContext(ctx, fmt.Sprintf("SET search_path TO %s", pq.QuoteIdentifier(schema))); err != nil {
+		return fmt.Errorf("failed to set schema: %w", err)
+	}
+	defer resetSearchPath(conn)
+	_, err = checkQueryTables(ctx, conn, query, args, false)
+	return err
+}
+
+// resetRole restores the session role, discarding the connection if that fails
+// so a connection still running as another role never goes back to the pool
+func resetRole(conn *sql.Conn) {
+	if _, err := conn.ExecContext(context.Background(), "RESET ROLE"); err != nil {
+		conn.Raw(func(interface{}) error { return driver.ErrBadConn })
+	}
+}
 
+// resetSearchPath restores the default search_path, discarding the connection if
+// that fails so a pooled connection never carries another caller's schema
+func resetSearchPath(conn *sql.Conn) {
+	if _, err := conn.ExecContext(context.Background(), "RESET search_path"); err != nil {
+		conn.Raw(func(interface{}) error { return driver.ErrBadConn })
+	}
+}
+
+// collectRows reads rows, up to the row cap, into the columns/rows result map
+// and flags whether the cap cut the result short
+func collectRows(rows *sql.Rows, opts QueryOptions) (map[string]interface{}, error) {
+	if opts.OnRow != nil {
+		opts.MaxRows = 0
+	} else {
+		opts.MaxRows = MaxRows(opts.MaxRows)
+	}
+	colTypes, err := rows.ColumnTypes()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get column types: %w", err)
+	}
+	cols, results, err := scanRows(rows, opts)
+	if err != nil {
+		return nil, err
+	}
+	// The result is truncated if a row remains beyond the cap
+	truncated := opts.MaxRows > 0 && len(results) == opts.MaxRows && rows.Next()
+
+	result := map[string]interface{}{
+		"columns":      cols,
+		"column_types": describeColumnTypes(colTypes),
+		"rows":         results,
+		"row_count":    len(results),
+		"truncated":    truncated,
+	}
+	if masked := opts.mask.strategies(cols); masked != nil {
+		result["masked_columns"] = masked
+	}
+	return result, nil
+}
+
+// describeColumnTypes reports each result column's database type along with its
+// nullability, length and precision when the driver knows them
+func describeColumnTypes(colTypes []*sql.ColumnType) []map[string]interface{} {
+	types := make([]map[string]interface{}, len(colTypes))
+	for i, ct := range colTypes {
+		info := map[string]interface{}{
+			"name": ct.Name(),
+			"type": ct.DatabaseTypeName(),
+		}
+		if nullable, ok := ct.Nullable(); ok {
+			info["nullable"] = nullable
+		}
+		if length, ok := ct.Length(); ok {
+			info["length"] = length
+		}
+		if precision, scale, ok := ct.DecimalSize(); ok {
+			info["precision"] = precision
+			info["scale"] = scale
+		}
+		types[i] = info
+	}
+	return types
+}
+
+// scanRows reads all rows into a slice of column-name keyed maps
+func scanRows(rows *sql.Rows, opts QueryOptions) ([]string, []map[string]interface{}, error) {
 	// Get column names
 	cols, err := rows.Columns()
 	if err != nil {
-		return nil, fmt.Errorf("failed to get columns: %w", err)
+		return nil, nil, fmt.Errorf("failed to get columns: %w", err)
+	}
+	colTypes, err := rows.ColumnTypes()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get column types: %w", err)
+	}
+
+	masked := opts.mask.strategies(cols)
+
+	progressEvery := opts.ProgressEvery
+	if progressEvery <= 0 {
+		progressEvery = defaultFetchSize
 	}
 
-	// Process results
+	// Process results, stopping once opts.MaxRows rows have been read
 	var results []map[string]interface{}
-	for rows.Next() {
+	scanned := 0
+	for (opts.MaxRows <= 0 || scanned < opts.MaxRows) && rows.Next() {
 		columnVals := make([]interface{}, len(cols))
 		columnPtrs := make([]interface{}, len(cols))
 		for i := range columnVals {
 			columnPtrs[i] = &columnVals[i]
 		}
-		rows.Scan(columnPtrs...)
+		if err := rows.Scan(columnPtrs...); err != nil {
+			return nil, nil, fmt.Errorf("scan error: %w", err)
+		}
 		rowMap := make(map[string]interface{})
 		for i, col := range cols {
-			rowMap[col] = convertValue(columnVals[i])
+			if strategy, ok := masked[col]; ok {
+				rowMap[col] = applyMask(strategy, convertColumnValue(columnVals[i], colTypes[i].DatabaseTypeName(), opts))
+				continue
+			}
+			if opts.BinaryArtifacts && colTypes[i].DatabaseTypeName() == "BYTEA" {
+				if data, ok := columnVals[i].([]byte); ok && len(data) > artifacts.threshold() {
+					rowMap[col] = artifacts.put(data)
+					continue
+				}
+			}
+			rowMap[col] = convertColumnValue(columnVals[i], colTypes[i].DatabaseTypeName(), opts)
 		}
-		results = append(results, rowMap)
+		scanned++
+		if opts.OnRow != nil {
+			if err := opts.OnRow(rowMap); err != nil {
+				return nil, nil, err
+			}
+		} else {
+			results = append(results, rowMap)
+		}
+		if opts.Progress != nil && scanned%progressEvery == 0 {
+			opts.Progress(scanned)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, fmt.Errorf("rows error: %w", err)
+	}
+	if opts.Progress != nil && scanned%progressEvery != 0 {
+		opts.Progress(scanned)
 	}
 
-	return map[string]interface{}{
-		"columns": cols,
-		"rows":    results,
-	}, nil
+	return cols, results, nil
+}
+
+// Catalog queries below use pg_catalog directly rather than information_schema,
+// which is dramatically slower on databases with very large catalogs. The
+// fragments reproduce the information_schema semantics so results keep the same shape.
+const (
+	// relationVisibleCond mirrors information_schema's rule that a relation is
+	// listed only if the current user owns it or holds some privilege on it
+	relationVisibleCond = `(pg_catalog.pg_has_role(c.relowner, 'USAGE')
+			OR pg_catalog.has_table_privilege(c.oid, 'SELECT, INSERT, UPDATE, DELETE, TRUNCATE, REFERENCES, TRIGGER')
+			OR pg_catalog.has_any_column_privilege(c.oid, 'SELECT, INSERT, UPDATE, REFERENCES'))`
+
+	// pgDataTypeExpr reproduces information_schema.columns.data_type
+	pgDataTypeExpr = `CASE
+			WHEN t.typtype = 'd' THEN
+				CASE
+					WHEN bt.typelem <> 0 AND bt.typlen = -1 THEN 'ARRAY'
+					WHEN nbt.nspname = 'pg_catalog' THEN pg_catalog.format_type(t.typbasetype, NULL)
+					ELSE 'USER-DEFINED'
+				END
+			WHEN t.typelem <> 0 AND t.typlen = -1 THEN 'ARRAY'
+			WHEN nt.nspname = 'pg_catalog' THEN pg_catalog.format_type(a.atttypid, NULL)
+			ELSE 'USER-DEFINED'
+		END`
+
+	// pgColumnsFrom selects the visible, non-dropped user columns of table $2 in schema $1
+	pgColumnsFrom = `FROM pg_catalog.pg_attribute a
+		JOIN pg_catalog.pg_class c ON c.oid = a.attrelid
+		JOIN pg_catalog.pg_namespace n ON n.oid = c.relnamespace
+		JOIN pg_catalog.pg_type t ON t.oid = a.atttypid
+		JOIN pg_catalog.pg_namespace nt ON nt.oid = t.typnamespace
+		LEFT JOIN pg_catalog.pg_type bt ON t.typtype = 'd' AND bt.oid = t.typbasetype
+		LEFT JOIN pg_catalog.pg_namespace nbt ON nbt.oid = bt.typnamespace
+		LEFT JOIN pg_catalog.pg_attrdef ad ON ad.adrelid = a.attrelid AND ad.adnum = a.attnum
+		WHERE n.nspname = $1
+			AND c.relname = $2
+			AND c.relkind IN ('r', 'v', 'f', 'p')
+			AND a.attnum > 0
+			AND NOT a.attisdropped
+			AND (pg_catalog.pg_has_role(c.relowner, 'USAGE')
+				OR pg_catalog.has_column_privilege(c.oid, a.attnum, 'SELECT, INSERT, UPDATE, REFERENCES'))`
+)
+
+// ErrTableNotFound is returned when a table does not exist in the requested schema
+var ErrTableNotFound = errors.New("table not found in schema")
+
+// tableExists reports whether information_schema.tables lists the table, matching
+// the name exactly as given, so a differently cased name is not found
+func tableExists(db *sql.DB, schema, table string) (bool, error) {
+	var exists bool
+	err := db.QueryRow(`
+		SELECT EXISTS (
+			SELECT 1 FROM information_schema.tables
+			WHERE table_schema = $1 AND table_name = $2
+		);
+	`, schema, table).Scan(&exists)
+	return exists, err
+}
+
+// requireTable returns an ErrTableNotFound error naming the table unless it
+// exists, or an ErrAccessDenied error when the table access rules hide it
+func requireTable(db *sql.DB, schema, table string) error {
+	if err := checkTableAccess(schema, table); err != nil {
+		return err
+	}
+	exists, err := tableExists(db, schema, table)
+	if err != nil {
+		return fmt.Errorf("failed to look up table: %w", err)
+	}
+	if !exists {
+		return fmt.Errorf("%w: %q not found in schema %q", ErrTableNotFound, table, schema)
+	}
+	return nil
 }
 
 // ListTables returns a list of tables in the specified schema
 func ListTables(db *sql.DB, schema string) ([]string, error) {
+	return listTables(db, schema, "")
+}
+
+// ListTablesPage returns the tables of a schema whose names match pattern, with
+// the same wildcards as SearchColumns, skipping offset tables and returning at
+// most limit (all when limit is zero), along with the total number matching
+func ListTablesPage(db *sql.DB, schema, pattern string, limit, offset int) (map[string]interface{}, error) {
+	like := ""
+	if pattern != "" {
+		like = likePattern(pattern)
+	}
+	tables, err := listTables(db, schema, like)
+	if err != nil {
+		return nil, err
+	}
+	total := len(tables)
+	offset = min(max(offset, 0), total)
+	end := total
+	if limit > 0 {
+		end = min(offset+limit, total)
+	}
+	return map[string]interface{}{
+		"tables":      append([]string{}, tables[offset:end]...),
+		"total_count": total,
+		"offset":      offset,
+		"has_more":    end < total,
+	}, nil
+}
+
+// listTables lists the tables of a schema accessible under the table access
+// rules, only those whose name matches the ILIKE pattern like unless it is empty
+func listTables(db *sql.DB, schema, like string) ([]string, error) {
 	rows, err := db.Query(`
-		SELECT table_name
-		FROM information_schema.tables
-		WHERE table_schema = $1
-		ORDER BY table_name;
-	`, schema)
+		SELECT c.relname
+		FROM pg_catalog.pg_class c
+		JOIN pg_catalog.pg_namespace n ON n.oid = c.relnamespace
+		WHERE n.nspname = $1
+			AND c.relkind IN ('r', 'v', 'f', 'p')
+			AND ($2 = '' OR c.relname ILIKE $2)
+			AND `+relationVisibleCond+`
+		ORDER BY c.relname;
+	`, schema, like)
 	if err != nil {
 		return nil, err
 	}
@@ -66,188 +517,2501 @@ func ListTables(db *sql.DB, schema string) ([]string, error) {
 	var tables []string
 	for rows.Next() {
 		var table string
-		rows.Scan(&table)
+		if err := rows.Scan(&table); err != nil {
+			return nil, err
+		}
 		tables = append(tables, table)
 	}
-	return tables, nil
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return filterTables(schema, tables), nil
 }
 
-// ListSchemas returns a list of all schemas in the database
-func ListSchemas(db *sql.DB) ([]string, error) {
-	rows, err := db.Query(`
-		SELECT schema_name FROM information_schema.schemata ORDER BY schema_name;
-	`)
+// ListViews returns the views in the specified schema with their definitions,
+// including materialized views from pg_matviews when includeMaterialized is set
+func ListViews(db *sql.DB, schema string, includeMaterialized bool) ([]map[string]interface{}, error) {
+	query := `
+		SELECT table_name, COALESCE(view_definition, ''), false
+		FROM information_schema.views
+		WHERE table_schema = $1`
+	if includeMaterialized {
+		query += `
+		UNION ALL
+		SELECT matviewname, definition, true
+		FROM pg_catalog.pg_matviews
+		WHERE schemaname = $1`
+	}
+	rows, err := db.Query(query+" ORDER BY 1;", schema)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var schemas []string
+	views := []map[string]interface{}{}
 	for rows.Next() {
-		var schema string
-		rows.Scan(&schema)
-		schemas = append(schemas, schema)
+		var name, definition string
+		var materialized bool
+		if err := rows.Scan(&name, &definition, &materialized); err != nil {
+			return nil, err
+		}
+		if !tableAllowed(schema + "." + name) {
+			continue
+		}
+		views = append(views, map[string]interface{}{
+			"name":         name,
+			"definition":   definition,
+			"materialized": materialized,
+		})
 	}
-	return schemas, nil
+	return views, rows.Err()
 }
 
-// GetFullTableSchema returns detailed schema information for a table
-func GetFullTableSchema(db *sql.DB, schema, table string) (map[string]interface{}, error) {
-	// Get column information
-	rows, err := db.Query(`
-		SELECT column_name, data_type, is_nullable, column_default
-		FROM information_schema.columns
-		WHERE table_schema = $1 AND table_name = $2
-		ORDER BY ordinal_position;
-	`, schema, table)
+// ErrNotAView is returned when a view definition is requested for another kind of relation
+var ErrNotAView = errors.New("not a view")
+
+// GetViewDefinition returns the pretty-printed SELECT behind a view or
+// materialized view, from pg_get_viewdef or pg_matviews respectively
+func GetViewDefinition(db *sql.DB, schema, view string) (map[string]interface{}, error) {
+	if err := checkTableAccess(schema, view); err != nil {
+		return nil, err
+	}
+	var relkind string
+	err := db.QueryRow(`
+		SELECT c.relkind::text
+		FROM pg_catalog.pg_class c
+		JOIN pg_catalog.pg_namespace n ON n.oid = c.relnamespace
+		WHERE n.nspname = $1 AND c.relname = $2 AND c.relkind IN ('r', 'p', 'f', 'v', 'm');
+	`, schema, view).Scan(&relkind)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("view %q not found in schema %q", view, schema)
+	}
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
 
-	var columns []map[string]interface{}
-	for rows.Next() {
-		var colName, dataType, isNullable, colDefault sql.NullString
-		rows.Scan(&colName, &dataType, &isNullable, &colDefault)
-		
-		column := map[string]interface{}{
-			"name": colName.String,
-			"type": dataType.String,
-			"nullable": isNullable.String == "YES",
-		}
-		if colDefault.Valid {
-			column["default"] = colDefault.String
-		}
-		columns = append(columns, column)
+	var definition string
+	switch relkind {
+	case "v":
+		err = db.QueryRow(`
+			SELECT pg_catalog.pg_get_viewdef(c.oid, true)
+			FROM pg_catalog.pg_class c
+			JOIN pg_catalog.pg_namespace n ON n.oid = c.relnamespace
+			WHERE n.nspname = $1 AND c.relname = $2;
+		`, schema, view).Scan(&definition)
+	case "m":
+		err = db.QueryRow(`
+			SELECT definition FROM pg_catalog.pg_matviews
+			WHERE schemaname = $1 AND matviewname = $2;
+		`, schema, view).Scan(&definition)
+	default:
+		return nil, fmt.Errorf("%w: %s.%s is a table; use describeTable for its columns", ErrNotAView, schema, view)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read view definition: %w", err)
 	}
 
 	return map[string]interface{}{
-		"schema": schema,
-		"table":  table,
-		"columns": columns,
+		"schema":       schema,
+		"name":         view,
+		"materialized": relkind == "m",
+		"definition":   strings.TrimSpace(definition),
 	}, nil
 }
 
-// DescribeTable returns column information for a table
-func DescribeTable(db *sql.DB, schema, table string) ([]map[string]interface{}, error) {
+// ListFunctions returns the functions and procedures in a schema with their
+// argument types, return type, kind and language, plus the source body when
+// includeBody is set
+func ListFunctions(db *sql.DB, schema string, includeBody bool) ([]map[string]interface{}, error) {
 	rows, err := db.Query(`
-		SELECT column_name, data_type, is_nullable, column_default
-		FROM information_schema.columns
-		WHERE table_schema = $1 AND table_name = $2
-		ORDER BY ordinal_position;
-	`, schema, table)
+		SELECT
+			p.proname,
+			pg_catalog.pg_get_function_identity_arguments(p.oid),
+			COALESCE(pg_catalog.pg_get_function_result(p.oid), ''),
+			CASE p.prokind WHEN 'p' THEN 'procedure' WHEN 'a' THEN 'aggregate' WHEN 'w' THEN 'window' ELSE 'function' END,
+			l.lanname,
+			p.prosrc
+		FROM pg_catalog.pg_proc p
+		JOIN pg_catalog.pg_namespace n ON n.oid = p.pronamespace
+		JOIN pg_catalog.pg_language l ON l.oid = p.prolang
+		WHERE n.nspname = $1
+		ORDER BY p.proname, 2;
+	`, schema)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var columns []map[string]interface{}
+	functions := []map[string]interface{}{}
 	for rows.Next() {
-		var colName, dataType, isNullable, colDefault sql.NullString
-		rows.Scan(&colName, &dataType, &isNullable, &colDefault)
-		
-		column := map[string]interface{}{
-			"name": colName.String,
-			"type": dataType.String,
-			"nullable": isNullable.String == "YES",
+		var name, arguments, returnType, kind, language, body string
+		if err := rows.Scan(&name, &arguments, &returnType, &kind, &language, &body); err != nil {
+			return nil, err
 		}
-		if colDefault.Valid {
-			column["default"] = colDefault.String
+		function := map[string]interface{}{
+			"name":        name,
+			"arguments":   arguments,
+			"return_type": returnType,
+			"kind":        kind,
+			"language":    language,
 		}
-		columns = append(columns, column)
+		if includeBody {
+			function["body"] = body
+		}
+		functions = append(functions, function)
 	}
-
-	return columns, nil
+	return functions, rows.Err()
 }
 
-// SampleRows returns sample rows from a table
-func SampleRows(db *sql.DB, schema, table string, limit int) (map[string]interface{}, error) {
-	if limit <= 0 {
-		limit = 5 // Default limit
+// ListEnums returns the enum types in a schema, each with its labels in sort order
+func ListEnums(db *sql.DB, schema string) ([]map[string]interface{}, error) {
+	rows, err := db.Query(`
+		SELECT t.typname, array_agg(e.enumlabel ORDER BY e.enumsortorder)
+		FROM pg_catalog.pg_type t
+		JOIN pg_catalog.pg_namespace n ON n.oid = t.typnamespace
+		JOIN pg_catalog.pg_enum e ON e.enumtypid = t.oid
+		WHERE n.nspname = $1
+		GROUP BY t.typname
+		ORDER BY t.typname;
+	`, schema)
+	if err != nil {
+		return nil, err
 	}
+	defer rows.Close()
 
-	// Set the schema
-	_, err := db.Exec(fmt.Sprintf("SET search_path TO %s", pq.QuoteIdentifier(schema)))
-	if err != nil {
-		return nil, fmt.Errorf("failed to set schema: %w", err)
+	enums := []map[string]interface{}{}
+	for rows.Next() {
+		var name string
+		var labels []string
+		if err := rows.Scan(&name, pq.Array(&labels)); err != nil {
+			return nil, err
+		}
+		enums = append(enums, map[string]interface{}{
+			"schema": schema,
+			"name":   name,
+			"labels": labels,
+		})
 	}
+	return enums, rows.Err()
+}
 
-	// Get sample rows
-	query := fmt.Sprintf("SELECT * FROM %s LIMIT %d", pq.QuoteIdentifier(table), limit)
-	rows, err := db.Query(query)
+// ListSequences returns the sequences in a schema with their definition, last
+// value and the table column that owns them through a serial column, OWNED BY
+// or an identity column. last_value is null when the sequence has never been
+// used or the user lacks SELECT or USAGE on it; readable tells the two apart.
+func ListSequences(db *sql.DB, schema string) ([]map[string]interface{}, error) {
+	version, err := serverVersionNum(db)
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
+	// pg_sequences exists from PostgreSQL 10 and already hides values the user cannot read
+	lastValue, sequencesJoin := "NULL::bigint", ""
+	if version >= 100000 {
+		lastValue = "ps.last_value"
+		sequencesJoin = `
+		LEFT JOIN pg_catalog.pg_sequences ps ON ps.schemaname = s.sequence_schema AND ps.sequencename = s.sequence_name`
+	}
 
-	// Get column names
-	cols, err := rows.Columns()
+	rows, err := db.Query(fmt.Sprintf(`
+		SELECT
+			s.sequence_name,
+			s.data_type,
+			s.start_value::bigint,
+			s.minimum_value::bigint,
+			s.maximum_value::bigint,
+			s.increment::bigint,
+			s.cycle_option = 'YES',
+			%s,
+			COALESCE(pg_catalog.has_sequence_privilege(c.oid, 'SELECT,USAGE'), false),
+			tn.nspname,
+			t.relname,
+			a.attname,
+			COALESCE(d.deptype = 'i', false)
+		FROM information_schema.sequences s
+		JOIN pg_catalog.pg_namespace n ON n.nspname = s.sequence_schema
+		JOIN pg_catalog.pg_class c ON c.relnamespace = n.oid AND c.relname = s.sequence_name AND c.relkind = 'S'
+		LEFT JOIN pg_catalog.pg_depend d ON d.classid = 'pg_catalog.pg_class'::regclass AND d.objid = c.oid
+			AND d.refclassid = 'pg_catalog.pg_class'::regclass AND d.refobjsubid > 0 AND d.deptype IN ('a', 'i')
+		LEFT JOIN pg_catalog.pg_class t ON t.oid = d.refobjid
+		LEFT JOIN pg_catalog.pg_namespace tn ON tn.oid = t.relnamespace
+		LEFT JOIN pg_catalog.pg_attribute a ON a.attrelid = d.refobjid AND a.attnum = d.refobjsubid%s
+		WHERE s.sequence_schema = $1
+		ORDER BY s.sequence_name;
+	`, lastValue, sequencesJoin), schema)
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 
-	// Process results
-	var results []map[string]interface{}
+	sequences := []map[string]interface{}{}
 	for rows.Next() {
-		columnVals := make([]interface{}, len(cols))
-		columnPtrs := make([]interface{}, len(cols))
-		for i := range columnVals {
-			columnPtrs[i] = &columnVals[i]
+		var name, dataType string
+		var start, min, max, increment int64
+		var cycle, readable, identity bool
+		var last sql.NullInt64
+		var ownerSchema, ownerTable, ownerColumn sql.NullString
+		if err := rows.Scan(&name, &dataType, &start, &min, &max, &increment, &cycle, &last, &readable,
+			&ownerSchema, &ownerTable, &ownerColumn, &identity); err != nil {
+			return nil, err
 		}
-		rows.Scan(columnPtrs...)
-		rowMap := make(map[string]interface{})
-		for i, col := range cols {
-			rowMap[col] = convertValue(columnVals[i])
+		if !tableAllowed(schema + "." + name) {
+			continue
+		}
+		sequence := map[string]interface{}{
+			"name":          name,
+			"data_type":     dataType,
+			"start_value":   start,
+			"minimum_value": min,
+			"maximum_value": max,
+			"increment":     increment,
+			"cycle":         cycle,
+			"last_value":    nil,
+			"readable":      readable,
+			"owned_by":      nil,
+		}
+		if last.Valid {
+			sequence["last_value"] = last.Int64
+		}
+		if ownerTable.Valid && tableAllowed(ownerSchema.String+"."+ownerTable.String) {
+			sequence["owned_by"] = map[string]interface{}{
+				"table":    ownerSchema.String + "." + ownerTable.String,
+				"column":   ownerColumn.String,
+				"identity": identity,
+			}
 		}
-		results = append(results, rowMap)
+		sequences = append(sequences, sequence)
 	}
-
-	return map[string]interface{}{
-		"columns": cols,
-		"rows":    results,
-	}, nil
+	return sequences, rows.Err()
 }
 
-// GetForeignKeys returns foreign key relationships for a table
-func GetForeignKeys(db *sql.DB, schema, table string) ([]map[string]interface{}, error) {
+// ListTriggers returns the triggers on a table, or on every table of the schema
+// when table is empty, with the events that fire them, their timing, row or
+// statement level and the function they execute. information_schema.triggers
+// only shows triggers on tables the user owns or holds a privilege other than
+// SELECT on.
+func ListTriggers(db *sql.DB, schema, table string) ([]map[string]interface{}, error) {
+	if table != "" {
+		if err := requireTable(db, schema, table); err != nil {
+			return nil, err
+		}
+	}
 	rows, err := db.Query(`
 		SELECT
-			kcu.column_name,
-			ccu.table_schema AS foreign_table_schema,
-			ccu.table_name AS foreign_table_name,
-			ccu.column_name AS foreign_column_name
-		FROM
-			information_schema.table_constraints AS tc
-			JOIN information_schema.key_column_usage AS kcu
-			ON tc.constraint_name = kcu.constraint_name
-			AND tc.table_schema = kcu.table_schema
-			JOIN information_schema.constraint_column_usage AS ccu
-			ON ccu.constraint_name = tc.constraint_name
-			AND ccu.table_schema = tc.table_schema
-		WHERE
-			tc.constraint_type = 'FOREIGN KEY'
-			AND tc.table_schema = $1
-			AND tc.table_name = $2;
+			tr.event_object_table,
+			tr.trigger_name,
+			array_agg(tr.event_manipulation::text ORDER BY tr.event_manipulation),
+			tr.action_timing,
+			tr.action_orientation,
+			COALESCE(tr.action_condition, ''),
+			tr.action_statement,
+			COALESCE(pn.nspname || '.' || p.proname, '')
+		FROM information_schema.triggers tr
+		JOIN pg_catalog.pg_namespace n ON n.nspname = tr.event_object_schema
+		JOIN pg_catalog.pg_class c ON c.relnamespace = n.oid AND c.relname = tr.event_object_table
+		LEFT JOIN pg_catalog.pg_trigger t ON t.tgrelid = c.oid AND t.tgname = tr.trigger_name
+		LEFT JOIN pg_catalog.pg_proc p ON p.oid = t.tgfoid
+		LEFT JOIN pg_catalog.pg_namespace pn ON pn.oid = p.pronamespace
+		WHERE tr.event_object_schema = $1 AND ($2 = '' OR tr.event_object_table = $2)
+		GROUP BY tr.event_object_table, tr.trigger_name, tr.action_timing, tr.action_orientation,
+			tr.action_condition, tr.action_statement, pn.nspname, p.proname
+		ORDER BY tr.event_object_table, tr.trigger_name;
 	`, schema, table)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var foreignKeys []map[string]interface{}
+	triggers := []map[string]interface{}{}
 	for rows.Next() {
-		var column, foreignSchema, foreignTable, foreignColumn string
-		rows.Scan(&column, &foreignSchema, &foreignTable, &foreignColumn)
-		
-		foreignKeys = append(foreignKeys, map[string]interface{}{
-			"column": column,
-			"references": map[string]string{
-				"schema": foreignSchema,
-				"table":  foreignTable,
-				"column": foreignColumn,
-			},
-		})
+		var tableName, name, timing, orientation, condition, statement, function string
+		var events []string
+		if err := rows.Scan(&tableName, &name, pq.Array(&events), &timing, &orientation, &condition, &statement, &function); err != nil {
+			return nil, err
+		}
+		if !tableAllowed(schema + "." + tableName) {
+			continue
+		}
+		trigger := map[string]interface{}{
+			"table":     tableName,
+			"name":      name,
+			"events":    events,
+			"timing":    timing,
+			"level":     orientation,
+			"function":  function,
+			"statement": statement,
+		}
+		if condition != "" {
+			trigger["condition"] = condition
+		}
+		triggers = append(triggers, trigger)
 	}
+	return triggers, rows.Err()
+}
 
-	return foreignKeys, nil
+// systemSchemaCond excludes pg_catalog, pg_toast, pg_temp_* and information_schema
+const systemSchemaCond = `schema_name NOT LIKE 'pg\_%' AND schema_name <> 'information_schema'`
+
+// ListSchemas returns a list of schemas in the database, hiding system schemas unless includeSystem is set
+func ListSchemas(db *sql.DB, includeSystem bool) ([]string, error) {
+	filter := ""
+	if !includeSystem {
+		filter = "WHERE " + systemSchemaCond
+	}
+	rows, err := db.Query(`
+		SELECT schema_name FROM information_schema.schemata ` + filter + ` ORDER BY schema_name;
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var schemas []string
+	for rows.Next() {
+		var schema string
+		if err := rows.Scan(&schema); err != nil {
+			return nil, err
+		}
+		schemas = append(schemas, schema)
+	}
+	return schemas, rows.Err()
+}
+
+// GetFullTableSchema returns detailed schema information for a table
+func GetFullTableSchema(db *sql.DB, schema, table string) (map[string]interface{}, error) {
+	if err := requireTable(db, schema, table); err != nil {
+		return nil, err
+	}
+
+	// Get column information
+	rows, err := db.Query(`
+		SELECT column_name, data_type, is_nullable, column_default,
+			pg_catalog.col_description(pg_catalog.format('%I.%I', table_schema, table_name)::regclass, ordinal_position)
+		FROM information_schema.columns
+		WHERE table_schema = $1 AND table_name = $2
+		ORDER BY ordinal_position;
+	`, schema, table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var columns []map[string]interface{}
+	for rows.Next() {
+		var colName, dataType, isNullable, colDefault, comment sql.NullString
+		if err := rows.Scan(&colName, &dataType, &isNullable, &colDefault, &comment); err != nil {
+			return nil, err
+		}
+		
+		column := map[string]interface{}{
+			"name": colName.String,
+			"type": dataType.String,
+			"nullable": isNullable.String == "YES",
+		}
+		if colDefault.Valid {
+			column["default"] = colDefault.String
+		}
+		if comment.Valid {
+			column["comment"] = comment.String
+		}
+		columns = append(columns, column)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	constraints, err := checkAndUniqueConstraints(db, schema, table)
+	if err != nil {
+		return nil, err
+	}
+
+	var tableComment sql.NullString
+	err = db.QueryRow(
+		"SELECT pg_catalog.obj_description(pg_catalog.format('%I.%I', $1::text, $2::text)::regclass, 'pg_class')",
+		schema, table,
+	).Scan(&tableComment)
+	if err != nil {
+		return nil, err
+	}
+
+	result := map[string]interface{}{
+		"schema": schema,
+		"table":  table,
+		"columns": columns,
+		"constraints": constraints,
+	}
+	if tableComment.Valid {
+		result["comment"] = tableComment.String
+	}
+	return result, nil
+}
+
+// Default and maximum number of tables DumpSchema describes
+const (
+	defaultDumpSchemaTables = 100
+	maxDumpSchemaTables     = 500
+)
+
+// DumpSchema describes every table of a schema whose name matches pattern, with
+// the same wildcards as SearchColumns, in one document: the columns, primary
+// key, foreign keys and indexes of each. At most maxTables tables are included,
+// in name order, with truncated set when more match.
+func DumpSchema(db *sql.DB, schema, pattern string, maxTables int) (map[string]interface{}, error) {
+	if maxTables <= 0 {
+		maxTables = defaultDumpSchemaTables
+	}
+	maxTables = min(maxTables, maxDumpSchemaTables)
+
+	like := ""
+	if pattern != "" {
+		like = likePattern(pattern)
+	}
+	names, err := listTables(db, schema, like)
+	if err != nil {
+		return nil, err
+	}
+	total := len(names)
+	if total > maxTables {
+		names = names[:maxTables]
+	}
+
+	tables := make([]map[string]interface{}, 0, len(names))
+	for _, name := range names {
+		columns, err := DescribeTable(db, schema, name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to describe %s.%s: %w", schema, name, err)
+		}
+		primaryKey := []string{}
+		for _, col := range columns {
+			if pk, _ := col["is_primary_key"].(bool); pk {
+				primaryKey = append(primaryKey, col["name"].(string))
+			}
+		}
+		foreignKeys, err := GetForeignKeys(db, schema, name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read foreign keys of %s.%s: %w", schema, name, err)
+		}
+		indexes, err := GetIndexes(db, schema, name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read indexes of %s.%s: %w", schema, name, err)
+		}
+		tables = append(tables, map[string]interface{}{
+			"name":         name,
+			"columns":      columns,
+			"primary_key":  primaryKey,
+			"foreign_keys": foreignKeys,
+			"indexes":      indexes,
+		})
+	}
+
+	return map[string]interface{}{
+		"schema":      schema,
+		"tables":      tables,
+		"total_count": total,
+		"truncated":   total > len(tables),
+	}, nil
+}
+
+// checkAndUniqueConstraints returns a table's CHECK and UNIQUE constraints with
+// the columns they cover and their definition from pg_get_constraintdef
+func checkAndUniqueConstraints(db *sql.DB, schema, table string) ([]map[string]interface{}, error) {
+	return tableConstraints(db, schema, table, []string{"c", "u"})
+}
+
+// ListConstraints returns every constraint of a table, primary key, unique,
+// check, foreign key and exclusion alike, with its type, the columns it covers,
+// its definition from pg_get_constraintdef and, for foreign keys, the table it
+// references
+func ListConstraints(db *sql.DB, schema, table string) ([]map[string]interface{}, error) {
+	if err := requireTable(db, schema, table); err != nil {
+		return nil, err
+	}
+	return tableConstraints(db, schema, table, nil)
+}
+
+// tableConstraints lists the constraints of a table whose pg_constraint.contype
+// is one of contypes, or all of them when contypes is empty
+func tableConstraints(db *sql.DB, schema, table string, contypes []string) ([]map[string]interface{}, error) {
+	rows, err := db.Query(`
+		SELECT
+			con.conname,
+			CASE con.contype
+				WHEN 'p' THEN 'PRIMARY KEY'
+				WHEN 'u' THEN 'UNIQUE'
+				WHEN 'c' THEN 'CHECK'
+				WHEN 'f' THEN 'FOREIGN KEY'
+				WHEN 'x' THEN 'EXCLUDE'
+				WHEN 'n' THEN 'NOT NULL'
+				WHEN 't' THEN 'TRIGGER'
+				ELSE con.contype::text
+			END,
+			ARRAY(SELECT a.attname
+				FROM unnest(con.conkey) WITH ORDINALITY AS k(attnum, ord)
+				JOIN pg_catalog.pg_attribute a ON a.attrelid = con.conrelid AND a.attnum = k.attnum
+				ORDER BY k.ord),
+			pg_catalog.pg_get_constraintdef(con.oid, true),
+			COALESCE(fn.nspname || '.' || fc.relname, '')
+		FROM pg_catalog.pg_constraint con
+		JOIN pg_catalog.pg_class c ON c.oid = con.conrelid
+		JOIN pg_catalog.pg_namespace n ON n.oid = c.relnamespace
+		LEFT JOIN pg_catalog.pg_class fc ON fc.oid = con.confrelid
+		LEFT JOIN pg_catalog.pg_namespace fn ON fn.oid = fc.relnamespace
+		WHERE n.nspname = $1
+			AND c.relname = $2
+			AND (cardinality($3::text[]) = 0 OR con.contype::text = ANY ($3))
+		ORDER BY con.contype <> 'p', con.conname;
+	`, schema, table, pq.Array(contypes))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	constraints := []map[string]interface{}{}
+	for rows.Next() {
+		var name, constraintType, definition, references string
+		var columns []string
+		if err := rows.Scan(&name, &constraintType, pq.Array(&columns), &definition, &references); err != nil {
+			return nil, err
+		}
+		constraint := map[string]interface{}{
+			"name":       name,
+			"type":       constraintType,
+			"columns":    columns,
+			"definition": definition,
+		}
+		if references != "" {
+			constraint["references"] = references
+		}
+		constraints = append(constraints, constraint)
+	}
+	return constraints, rows.Err()
+}
+
+// ddlLimitations lists what GetTableDDL leaves out of the reconstructed DDL
+var ddlLimitations = []string{
+	"ownership, grants, comments, triggers, RLS policies and publications are not included",
+	"storage parameters, tablespaces, column collations and statistics targets are not included",
+	"inheritance parents and partition bounds are not included; PARTITION BY is included for partitioned tables",
+	"referenced types, sequences and tables are assumed to exist",
+}
+
+// GetTableDDL reconstructs a best-effort CREATE TABLE statement for a table from
+// pg_catalog: columns with their types, identity, generated expressions,
+// defaults and NOT NULL, then its primary key, unique, check and foreign key
+// constraints, followed by CREATE INDEX statements for indexes that do not back
+// a constraint. What the DDL leaves out is listed under limitations.
+func GetTableDDL(db *sql.DB, schema, table string) (map[string]interface{}, error) {
+	if err := requireTable(db, schema, table); err != nil {
+		return nil, err
+	}
+
+	var qualified, relkind, persistence, partitionKey string
+	err := db.QueryRow(`
+		SELECT
+			quote_ident(n.nspname) || '.' || quote_ident(c.relname),
+			c.relkind::text,
+			c.relpersistence::text,
+			CASE WHEN c.relkind = 'p' THEN pg_catalog.pg_get_partkeydef(c.oid) ELSE '' END
+		FROM pg_catalog.pg_class c
+		JOIN pg_catalog.pg_namespace n ON n.oid = c.relnamespace
+		WHERE n.nspname = $1 AND c.relname = $2;
+	`, schema, table).Scan(&qualified, &relkind, &persistence, &partitionKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up table: %w", err)
+	}
+	if relkind == "v" || relkind == "m" {
+		return nil, fmt.Errorf("%s.%s is a view; use getViewDefinition for its definition", schema, table)
+	}
+	if relkind != "r" && relkind != "p" {
+		return nil, fmt.Errorf("%s.%s is not an ordinary or partitioned table", schema, table)
+	}
+
+	rows, err := db.Query(`
+		SELECT
+			quote_ident(a.attname),
+			pg_catalog.format_type(a.atttypid, a.atttypmod),
+			a.attnotnull,
+			a.attidentity::text,
+			a.attgenerated::text,
+			COALESCE(pg_catalog.pg_get_expr(ad.adbin, ad.adrelid), '')
+		FROM pg_catalog.pg_attribute a
+		JOIN pg_catalog.pg_class c ON c.oid = a.attrelid
+		JOIN pg_catalog.pg_namespace n ON n.oid = c.relnamespace
+		LEFT JOIN pg_catalog.pg_attrdef ad ON ad.adrelid = a.attrelid AND ad.adnum = a.attnum
+		WHERE n.nspname = $1 AND c.relname = $2 AND a.attnum > 0 AND NOT a.attisdropped
+		ORDER BY a.attnum;
+	`, schema, table)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read columns: %w", err)
+	}
+	defer rows.Close()
+
+	var lines []string
+	for rows.Next() {
+		var name, dataType, identity, generated, expr string
+		var notNull bool
+		if err := rows.Scan(&name, &dataType, &notNull, &identity, &generated, &expr); err != nil {
+			return nil, err
+		}
+		line := name + " " + dataType
+		switch {
+		case identity == "a":
+			line += " GENERATED ALWAYS AS IDENTITY"
+		case identity == "d":
+			line += " GENERATED BY DEFAULT AS IDENTITY"
+		case generated == "s":
+			line += " GENERATED ALWAYS AS (" + expr + ") STORED"
+		case expr != "":
+			line += " DEFAULT " + expr
+		}
+		if notNull {
+			line += " NOT NULL"
+		}
+		lines = append(lines, line)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	constraints, err := tableConstraints(db, schema, table, []string{"p", "u", "c", "f"})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read constraints: %w", err)
+	}
+	for _, con := range constraints {
+		lines = append(lines, fmt.Sprintf("CONSTRAINT %s %s", pq.QuoteIdentifier(con["name"].(string)), con["definition"]))
+	}
+
+	var ddl strings.Builder
+	ddl.WriteString("CREATE ")
+	if persistence == "u" {
+		ddl.WriteString("UNLOGGED ")
+	}
+	ddl.WriteString("TABLE " + qualified + " (\n    " + strings.Join(lines, ",\n    ") + "\n)")
+	if partitionKey != "" {
+		ddl.WriteString(" PARTITION BY " + partitionKey)
+	}
+	ddl.WriteString(";\n")
+
+	indexRows, err := db.Query(`
+		SELECT pg_catalog.pg_get_indexdef(i.indexrelid)
+		FROM pg_catalog.pg_index i
+		JOIN pg_catalog.pg_class c ON c.oid = i.indrelid
+		JOIN pg_catalog.pg_namespace n ON n.oid = c.relnamespace
+		JOIN pg_catalog.pg_class ic ON ic.oid = i.indexrelid
+		WHERE n.nspname = $1 AND c.relname = $2
+			AND NOT EXISTS (SELECT 1 FROM pg_catalog.pg_constraint con WHERE con.conindid = i.indexrelid)
+		ORDER BY ic.relname;
+	`, schema, table)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read indexes: %w", err)
+	}
+	defer indexRows.Close()
+	for indexRows.Next() {
+		var definition string
+		if err := indexRows.Scan(&definition); err != nil {
+			return nil, err
+		}
+		ddl.WriteString("\n" + definition + ";")
+	}
+	if err := indexRows.Err(); err != nil {
+		return nil, err
+	}
+
+	return map[string]interface{}{
+		"schema":      schema,
+		"table":       table,
+		"ddl":         strings.TrimSuffix(ddl.String(), "\n"),
+		"limitations": ddlLimitations,
+	}, nil
+}
+
+// DescribeTable returns column information for a table, including each
+// column's position and whether it is part of the primary key
+func DescribeTable(db *sql.DB, schema, table string) ([]map[string]interface{}, error) {
+	if err := checkTableAccess(schema, table); err != nil {
+		return nil, err
+	}
+	rows, err := db.Query(`
+		SELECT a.attname, `+pgDataTypeExpr+`,
+			CASE WHEN a.attnotnull THEN 'NO' ELSE 'YES' END,
+			CASE WHEN a.attgenerated = '' THEN pg_catalog.pg_get_expr(ad.adbin, ad.adrelid) END,
+			a.attnum,
+			EXISTS (
+				SELECT 1 FROM pg_catalog.pg_index pk
+				WHERE pk.indrelid = a.attrelid AND pk.indisprimary AND a.attnum = ANY (pk.indkey)
+			),
+			pg_catalog.col_description(a.attrelid, a.attnum)
+		`+pgColumnsFrom+`
+		ORDER BY a.attnum;
+	`, schema, table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var columns []map[string]interface{}
+	for rows.Next() {
+		var colName, dataType, isNullable, colDefault, comment sql.NullString
+		var position int
+		var primaryKey bool
+		if err := rows.Scan(&colName, &dataType, &isNullable, &colDefault, &position, &primaryKey, &comment); err != nil {
+			return nil, err
+		}
+		
+		column := map[string]interface{}{
+			"name": colName.String,
+			"type": dataType.String,
+			"nullable": isNullable.String == "YES",
+			"ordinal_position": position,
+			"is_primary_key": primaryKey,
+		}
+		if colDefault.Valid {
+			column["default"] = colDefault.String
+		}
+		if comment.Valid {
+			column["comment"] = comment.String
+		}
+		columns = append(columns, column)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return columns, nil
+}
+
+// AddColumnStats adds the planner statistics pg_stats holds for each column
+// returned by DescribeTable under "stats": n_distinct (negative values are the
+// negated fraction of rows that are distinct), null_frac, correlation and the
+// most common values with their frequencies, masked like sampled rows. Columns
+// without statistics, including every column of a table that has never been
+// analyzed or that the user cannot read, get a null stats value.
+func AddColumnStats(db *sql.DB, schema, table string, columns []map[string]interface{}) error {
+	// Partitioned and inheritance parents only have inherited statistics, so
+	// those are used when a column has no statistics of its own
+	rows, err := db.Query(`
+		SELECT DISTINCT ON (attname)
+			attname, n_distinct, null_frac, correlation,
+			most_common_vals::text, most_common_freqs
+		FROM pg_catalog.pg_stats
+		WHERE schemaname = $1 AND tablename = $2
+		ORDER BY attname, inherited;
+	`, schema, table)
+	if err != nil {
+		return fmt.Errorf("failed to read column statistics: %w", err)
+	}
+	defer rows.Close()
+
+	stats := map[string]map[string]interface{}{}
+	for rows.Next() {
+		var name string
+		var nDistinct, nullFrac float64
+		var correlation sql.NullFloat64
+		var commonVals sql.NullString
+		var commonFreqs []float64
+		if err := rows.Scan(&name, &nDistinct, &nullFrac, &correlation, &commonVals, pq.Array(&commonFreqs)); err != nil {
+			return err
+		}
+		colStats := map[string]interface{}{
+			"n_distinct":        nDistinct,
+			"null_frac":         nullFrac,
+			"correlation":       nil,
+			"most_common_vals":  nil,
+			"most_common_freqs": nil,
+		}
+		if correlation.Valid {
+			colStats["correlation"] = correlation.Float64
+		}
+		if commonVals.Valid {
+			var vals []sql.NullString
+			if err := pq.Array(&vals).Scan(commonVals.String); err != nil {
+				return fmt.Errorf("failed to parse most common values of %s: %w", name, err)
+			}
+			common := make([]interface{}, len(vals))
+			for i, v := range vals {
+				if v.Valid {
+					common[i] = maskValue(schema+"."+table+"."+name, v.String)
+				}
+			}
+			colStats["most_common_vals"] = common
+			colStats["most_common_freqs"] = commonFreqs
+		}
+		stats[name] = colStats
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, column := range columns {
+		name, _ := column["name"].(string)
+		if colStats, ok := stats[name]; ok {
+			column["stats"] = colStats
+		} else {
+			column["stats"] = nil
+		}
+	}
+	return nil
+}
+
+// SampleRows returns sample rows from a table, skipping offset rows, with limit
+// clamped to MAX_ROWS. When orderBy names a column of the table the rows are
+// sorted by it, so successive pages are deterministic. where is an optional
+// condition using $1, $2, ... placeholders bound to whereArgs, such as
+// "status = $1"; it must be a single expression (see checkWhereCondition).
+// Rows are masked by the policy of every table the query reads.
+func SampleRows(db *sql.DB, schema, table string, limit, offset int, orderBy, where string, whereArgs []interface{}) (map[string]interface{}, error) {
+	if limit <= 0 {
+		limit = 5 // Default limit
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	limit = MaxRows(limit)
+	if err := requireTable(db, schema, table); err != nil {
+		return nil, err
+	}
+	orderClause := ""
+	if orderBy != "" {
+		if err := ValidateColumns(db, schema, table, []string{orderBy}); err != nil {
+			return nil, err
+		}
+		orderClause = " ORDER BY " + pq.QuoteIdentifier(orderBy)
+	}
+	whereClause := ""
+	if strings.TrimSpace(where) != "" {
+		if err := checkWhereCondition(where); err != nil {
+			return nil, err
+		}
+		// The newline ends the condition even if it finishes in a comment
+		// that checkWhereCondition missed
+		whereClause = " WHERE (" + where + "\n)"
+	} else if len(whereArgs) > 0 {
+		return nil, fmt.Errorf("whereArgs given without a where condition")
+	}
+	args, err := coerceArgs(whereArgs, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// Get sample rows, qualifying the table rather than relying on search_path
+	query := fmt.Sprintf("SELECT * FROM %s.%s%s%s LIMIT %d OFFSET %d",
+		pq.QuoteIdentifier(schema), pq.QuoteIdentifier(table), whereClause, orderClause, limit, offset)
+
+	// The where condition is caller-supplied SQL, so it runs read-only and any
+	// tables its subqueries read are checked against the access rules
+	ctx, cancel := WithQueryTimeout(context.Background(), 0)
+	defer cancel()
+	tx, err := db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+	relations := []string{schema + "." + table}
+	if whereClause != "" {
+		if relations, err = checkQueryTables(ctx, tx, query, args, true); err != nil {
+			return nil, err
+		}
+	}
+
+	rows, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	// Convert and mask rows the same way query results are
+	cols, results, err := scanRows(rows, QueryOptions{MaxRows: limit, mask: newQueryMask(relations)})
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]interface{}{
+		"columns": cols,
+		"rows":    results,
+	}, nil
+}
+
+// checkWhereCondition rejects a where condition that could end the WHERE clause
+// it is placed in: a ';', a comment, a backslash or dollar quote that would hide
+// a closing quote, or a parenthesis closed before it was opened or left open.
+// Values belong in whereArgs, so none of these are needed in a condition.
+func checkWhereCondition(where string) error {
+	depth := 0
+	var quote rune
+	runes := []rune(where)
+	for i, r := range runes {
+		if quote != 0 {
+			if r == quote {
+				quote = 0
+			}
+			if r == '\\' {
+				return fmt.Errorf("where cannot contain backslashes; pass values in whereArgs")
+			}
+			continue
+		}
+		next := rune(0)
+		if i+1 < len(runes) {
+			next = runes[i+1]
+		}
+		switch {
+		case r == '\'' || r == '"':
+			quote = r
+		case r == ';':
+			return fmt.Errorf("where must be a single condition and cannot contain ';'")
+		case r == '-' && next == '-', r == '/' && next == '*':
+			return fmt.Errorf("where cannot contain comments")
+		case r == '\\':
+			return fmt.Errorf("where cannot contain backslashes; pass values in whereArgs")
+		case r == '$' && (next < '0' || next > '9'):
+			return fmt.Errorf("where cannot contain dollar-quoted strings; pass values in whereArgs")
+		case r == '(':
+			depth++
+		case r == ')':
+			depth--
+			if depth < 0 {
+				return fmt.Errorf("where has an unbalanced ')'")
+			}
+		}
+	}
+	if quote != 0 {
+		return fmt.Errorf("where has an unterminated quote")
+	}
+	if depth != 0 {
+		return fmt.Errorf("where has an unbalanced '('")
+	}
+	return nil
+}
+
+// GetIndexes returns a table's indexes with their key and included columns,
+// uniqueness and access method. Expression index keys are reported as their
+// expression text, and definition holds the full CREATE INDEX statement, which
+// also covers partial indexes alongside their predicate.
+func GetIndexes(db *sql.DB, schema, table string) ([]map[string]interface{}, error) {
+	if err := checkTableAccess(schema, table); err != nil {
+		return nil, err
+	}
+	rows, err := db.Query(`
+		SELECT
+			i.relname,
+			ARRAY(SELECT pg_catalog.pg_get_indexdef(ix.indexrelid, k, true)
+				FROM generate_series(1, ix.indnkeyatts) AS k ORDER BY k),
+			ARRAY(SELECT pg_catalog.pg_get_indexdef(ix.indexrelid, k, true)
+				FROM generate_series(ix.indnkeyatts + 1, ix.indnatts) AS k ORDER BY k),
+			ix.indisunique,
+			ix.indisprimary,
+			am.amname,
+			pg_catalog.pg_get_expr(ix.indpred, ix.indrelid, true),
+			pg_catalog.pg_get_indexdef(ix.indexrelid)
+		FROM pg_catalog.pg_index ix
+		JOIN pg_catalog.pg_class i ON i.oid = ix.indexrelid
+		JOIN pg_catalog.pg_class c ON c.oid = ix.indrelid
+		JOIN pg_catalog.pg_namespace n ON n.oid = c.relnamespace
+		JOIN pg_catalog.pg_am am ON am.oid = i.relam
+		WHERE n.nspname = $1
+			AND c.relname = $2
+		ORDER BY i.relname;
+	`, schema, table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	indexes := []map[string]interface{}{}
+	for rows.Next() {
+		var name, method, definition string
+		var columns, include []string
+		var unique, primary bool
+		var predicate sql.NullString
+		if err := rows.Scan(&name, pq.Array(&columns), pq.Array(&include), &unique, &primary, &method, &predicate, &definition); err != nil {
+			return nil, err
+		}
+
+		index := map[string]interface{}{
+			"name":        name,
+			"columns":     columns,
+			"unique":      unique,
+			"primary_key": primary,
+			"method":      method,
+			"partial":     predicate.Valid,
+			"definition":  definition,
+		}
+		if len(include) > 0 {
+			index["include"] = include
+		}
+		if predicate.Valid {
+			index["predicate"] = predicate.String
+		}
+		indexes = append(indexes, index)
+	}
+	return indexes, rows.Err()
+}
+
+// GetTableStats returns a table's estimated row count from pg_class.reltuples
+// together with its total, heap and index sizes. When exact is set it also counts
+// the rows with count(*), which scans the whole table.
+func GetTableStats(db *sql.DB, schema, table string, exact bool) (map[string]interface{}, error) {
+	if err := checkTableAccess(schema, table); err != nil {
+		return nil, err
+	}
+	var reltuples float64
+	var totalSize, tableSize, indexSize int64
+	var totalPretty string
+	err := db.QueryRow(`
+		SELECT c.reltuples, pg_catalog.pg_total_relation_size(c.oid), pg_catalog.pg_table_size(c.oid),
+			pg_catalog.pg_indexes_size(c.oid), pg_catalog.pg_size_pretty(pg_catalog.pg_total_relation_size(c.oid))
+		FROM pg_catalog.pg_class c
+		JOIN pg_catalog.pg_namespace n ON n.oid = c.relnamespace
+		WHERE n.nspname = $1
+			AND c.relname = $2
+			AND c.relkind IN ('r', 'p', 'm');
+	`, schema, table).Scan(&reltuples, &totalSize, &tableSize, &indexSize, &totalPretty)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("table %s.%s not found", schema, table)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	stats := map[string]interface{}{
+		"schema":              schema,
+		"table":               table,
+		"total_size_bytes":    totalSize,
+		"total_size":          totalPretty,
+		"table_size_bytes":    tableSize,
+		"index_size_bytes":    indexSize,
+		"estimated_row_count": nil,
+	}
+	// reltuples is -1 for tables that have never been vacuumed or analyzed
+	if reltuples >= 0 {
+		stats["estimated_row_count"] = int64(reltuples)
+	}
+
+	if exact {
+		var count int64
+		query := fmt.Sprintf("SELECT count(*) FROM %s.%s", pq.QuoteIdentifier(schema), pq.QuoteIdentifier(table))
+		if err := db.QueryRow(query).Scan(&count); err != nil {
+			return nil, fmt.Errorf("failed to count rows: %w", err)
+		}
+		stats["exact_row_count"] = count
+	}
+	return stats, nil
+}
+
+// GetForeignKeys returns foreign key relationships for a table
+func GetForeignKeys(db *sql.DB, schema, table string) ([]map[string]interface{}, error) {
+	if err := checkTableAccess(schema, table); err != nil {
+		return nil, err
+	}
+	rows, err := db.Query(`
+		SELECT
+			a.attname,
+			fn.nspname AS foreign_table_schema,
+			ft.relname AS foreign_table_name,
+			fa.attname AS foreign_column_name
+		FROM pg_catalog.pg_constraint con
+		JOIN pg_catalog.pg_class c ON c.oid = con.conrelid
+		JOIN pg_catalog.pg_namespace n ON n.oid = c.relnamespace
+		JOIN pg_catalog.pg_class ft ON ft.oid = con.confrelid
+		JOIN pg_catalog.pg_namespace fn ON fn.oid = ft.relnamespace
+		CROSS JOIN LATERAL unnest(con.conkey, con.confkey) WITH ORDINALITY AS k(attnum, fattnum, ord)
+		JOIN pg_catalog.pg_attribute a ON a.attrelid = con.conrelid AND a.attnum = k.attnum
+		JOIN pg_catalog.pg_attribute fa ON fa.attrelid = con.confrelid AND fa.attnum = k.fattnum
+		WHERE con.contype = 'f'
+			AND n.nspname = $1
+			AND c.relname = $2
+		ORDER BY con.conname, k.ord;
+	`, schema, table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var foreignKeys []map[string]interface{}
+	for rows.Next() {
+		var column, foreignSchema, foreignTable, foreignColumn string
+		if err := rows.Scan(&column, &foreignSchema, &foreignTable, &foreignColumn); err != nil {
+			return nil, err
+		}
+		
+		foreignKeys = append(foreignKeys, map[string]interface{}{
+			"column": column,
+			"references": map[string]string{
+				"schema": foreignSchema,
+				"table":  foreignTable,
+				"column": foreignColumn,
+			},
+		})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return foreignKeys, nil
+}
+
+// FindUnindexedForeignKeys returns foreign keys in a schema whose columns are not
+// the leading columns of any index, along with a suggested CREATE INDEX statement
+func FindUnindexedForeignKeys(db *sql.DB, schema string) ([]map[string]interface{}, error) {
+	rows, err := db.Query(`
+		SELECT
+			c.conname,
+			t.relname,
+			rn.nspname AS referenced_schema,
+			rt.relname AS referenced_table,
+			array_agg(a.attname::text ORDER BY k.ord) AS columns
+		FROM pg_constraint c
+		JOIN pg_class t ON t.oid = c.conrelid
+		JOIN pg_namespace n ON n.oid = t.relnamespace
+		JOIN pg_class rt ON rt.oid = c.confrelid
+		JOIN pg_namespace rn ON rn.oid = rt.relnamespace
+		CROSS JOIN LATERAL unnest(c.conkey) WITH ORDINALITY AS k(attnum, ord)
+		JOIN pg_attribute a ON a.attrelid = c.conrelid AND a.attnum = k.attnum
+		WHERE c.contype = 'f'
+			AND n.nspname = $1
+			AND NOT EXISTS (
+				SELECT 1
+				FROM pg_index i
+				WHERE i.indrelid = c.conrelid
+					AND i.indpred IS NULL
+					AND (string_to_array(i.indkey::text, ' ')::int2[])[1:array_length(c.conkey, 1)] @> c.conkey
+					AND (string_to_array(i.indkey::text, ' ')::int2[])[1:array_length(c.conkey, 1)] <@ c.conkey
+			)
+		GROUP BY c.conname, t.relname, rn.nspname, rt.relname
+		ORDER BY t.relname, c.conname;
+	`, schema)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := []map[string]interface{}{}
+	for rows.Next() {
+		var constraint, table, referencedSchema, referencedTable string
+		var cols []string
+		if err := rows.Scan(&constraint, &table, &referencedSchema, &referencedTable, pq.Array(&cols)); err != nil {
+			return nil, err
+		}
+		if !tableAllowed(schema+"."+table) || !tableAllowed(referencedSchema+"."+referencedTable) {
+			continue
+		}
+
+		quotedCols := make([]string, len(cols))
+		for i, col := range cols {
+			quotedCols[i] = pq.QuoteIdentifier(col)
+		}
+
+		results = append(results, map[string]interface{}{
+			"constraint":       constraint,
+			"table":            table,
+			"columns":          cols,
+			"referenced_table": referencedTable,
+			"suggested_index": fmt.Sprintf("CREATE INDEX ON %s.%s (%s);",
+				pq.QuoteIdentifier(schema), pq.QuoteIdentifier(table), strings.Join(quotedCols, ", ")),
+		})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
+
+// EstimateBloat estimates wasted space per table in a schema by comparing the
+// actual page count with the size the live tuples would need according to
+// pg_stats, using the widely used ioguix table bloat estimation query
+func EstimateBloat(db *sql.DB, schema string, thresholdRatio float64) ([]map[string]interface{}, error) {
+	rows, err := db.Query(`
+		SELECT tblname, bs * tblpages AS real_size,
+			CASE WHEN tblpages > 0 AND tblpages - est_tblpages_ff > 0
+				THEN (tblpages - est_tblpages_ff) * bs ELSE 0 END AS bloat_size,
+			CASE WHEN tblpages > 0 AND tblpages - est_tblpages_ff > 0
+				THEN 100 * (tblpages - est_tblpages_ff) / tblpages::float ELSE 0 END AS bloat_ratio,
+			is_na
+		FROM (
+			SELECT ceil(reltuples / ((bs - page_hdr) * fillfactor / (tpl_size * 100))) + ceil(toasttuples / 4) AS est_tblpages_ff,
+				tblpages, bs, tblname, is_na
+			FROM (
+				SELECT
+					(4 + tpl_hdr_size + tpl_data_size + (2 * ma)
+						- CASE WHEN tpl_hdr_size % ma = 0 THEN ma ELSE tpl_hdr_size % ma END
+						- CASE WHEN ceil(tpl_data_size)::int % ma = 0 THEN ma ELSE ceil(tpl_data_size)::int % ma END
+					) AS tpl_size,
+					bs - page_hdr AS size_per_block, heappages + toastpages AS tblpages,
+					reltuples, toasttuples, bs, page_hdr, tblname, fillfactor, is_na
+				FROM (
+					SELECT
+						tbl.relname AS tblname, tbl.reltuples, tbl.relpages AS heappages,
+						coalesce(toast.relpages, 0) AS toastpages,
+						coalesce(toast.reltuples, 0) AS toasttuples,
+						coalesce(substring(array_to_string(tbl.reloptions, ' ') FROM 'fillfactor=([0-9]+)')::smallint, 100) AS fillfactor,
+						current_setting('block_size')::numeric AS bs,
+						CASE WHEN version() ~ 'mingw32' OR version() ~ '64-bit|x86_64|ppc64|ia64|amd64' THEN 8 ELSE 4 END AS ma,
+						24 AS page_hdr,
+						23 + CASE WHEN max(coalesce(s.null_frac, 0)) > 0 THEN (7 + count(s.attname)) / 8 ELSE 0::int END
+							+ CASE WHEN bool_or(att.attname = 'oid' AND att.attnum < 0) THEN 4 ELSE 0 END AS tpl_hdr_size,
+						sum((1 - coalesce(s.null_frac, 0)) * coalesce(s.avg_width, 0)) AS tpl_data_size,
+						bool_or(att.atttypid = 'pg_catalog.name'::regtype)
+							OR sum(CASE WHEN att.attnum > 0 THEN 1 ELSE 0 END) <> count(s.attname) AS is_na
+					FROM pg_attribute AS att
+					JOIN pg_class AS tbl ON att.attrelid = tbl.oid
+					JOIN pg_namespace AS ns ON ns.oid = tbl.relnamespace
+					LEFT JOIN pg_stats AS s ON s.schemaname = ns.nspname
+						AND s.tablename = tbl.relname AND s.inherited = false AND s.attname = att.attname
+					LEFT JOIN pg_class AS toast ON tbl.reltoastrelid = toast.oid
+					WHERE NOT att.attisdropped
+						AND tbl.relkind IN ('r', 'm')
+						AND ns.nspname = $1
+					GROUP BY tbl.oid, tbl.relname, tbl.reltuples, tbl.relpages, toastpages, toasttuples, fillfactor, tbl.reloptions
+				) AS s
+			) AS s2
+		) AS s3
+		ORDER BY bloat_size DESC, tblname;
+	`, schema)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := []map[string]interface{}{}
+	for rows.Next() {
+		var table string
+		var realSize, bloatSize, bloatRatio float64
+		var estimateUnavailable bool
+		if err := rows.Scan(&table, &realSize, &bloatSize, &bloatRatio, &estimateUnavailable); err != nil {
+			return nil, err
+		}
+		if !tableAllowed(schema + "." + table) {
+			continue
+		}
+
+		results = append(results, map[string]interface{}{
+			"table":                table,
+			"real_size_bytes":      int64(realSize),
+			"bloat_bytes":          int64(bloatSize),
+			"bloat_ratio":          bloatRatio,
+			"above_threshold":      bloatRatio >= thresholdRatio,
+			"estimate_unavailable": estimateUnavailable,
+		})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
+
+// GetIndexedColumns returns every column of a table with the indexes it appears
+// in and its position within each, answering "is this column indexed"
+func GetIndexedColumns(db *sql.DB, schema, table string) ([]map[string]interface{}, error) {
+	if err := checkTableAccess(schema, table); err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Query(`
+		SELECT a.attname, i.relname, k.ord, k.ord > ix.indnkeyatts, ix.indisunique, ix.indisprimary
+		FROM pg_catalog.pg_attribute a
+		JOIN pg_catalog.pg_class c ON c.oid = a.attrelid
+		JOIN pg_catalog.pg_namespace n ON n.oid = c.relnamespace
+		LEFT JOIN (
+			pg_catalog.pg_index ix
+			CROSS JOIN LATERAL unnest(ix.indkey::int2[]) WITH ORDINALITY AS k(attnum, ord)
+			JOIN pg_catalog.pg_class i ON i.oid = ix.indexrelid
+		) ON ix.indrelid = c.oid AND k.attnum = a.attnum
+		WHERE n.nspname = $1
+			AND c.relname = $2
+			AND a.attnum > 0
+			AND NOT a.attisdropped
+		ORDER BY a.attnum, i.relname;
+	`, schema, table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := []map[string]interface{}{}
+	byColumn := map[string]map[string]interface{}{}
+	for rows.Next() {
+		var column string
+		var index sql.NullString
+		var position sql.NullInt64
+		var included, unique, primary sql.NullBool
+		if err := rows.Scan(&column, &index, &position, &included, &unique, &primary); err != nil {
+			return nil, err
+		}
+
+		entry, ok := byColumn[column]
+		if !ok {
+			entry = map[string]interface{}{
+				"column":  column,
+				"indexed": false,
+				"indexes": []map[string]interface{}{},
+			}
+			byColumn[column] = entry
+			results = append(results, entry)
+		}
+		if !index.Valid {
+			continue
+		}
+
+		entry["indexed"] = true
+		entry["indexes"] = append(entry["indexes"].([]map[string]interface{}), map[string]interface{}{
+			"index":       index.String,
+			"position":    position.Int64,
+			"included":    included.Bool,
+			"unique":      unique.Bool,
+			"primary_key": primary.Bool,
+		})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
+
+// maxOrphanSamples caps the sample orphan rows returned per constraint
+const maxOrphanSamples = 100
+
+// FindOrphans checks every foreign key of a table with an anti-join and returns,
+// per constraint, the number of child rows whose key has no matching parent plus
+// a capped sample of them. Rows with a NULL in any key column are not orphans,
+// matching the default MATCH SIMPLE semantics. Constraints referencing a table
+// the access rules hide are skipped.
+func FindOrphans(ctx context.Context, db *sql.DB, schema, table string, sampleLimit int) ([]map[string]interface{}, error) {
+	if err := checkTableAccess(schema, table); err != nil {
+		return nil, err
+	}
+	if sampleLimit <= 0 {
+		sampleLimit = 5
+	}
+	if sampleLimit > maxOrphanSamples {
+		sampleLimit = maxOrphanSamples
+	}
+
+	fkRows, err := db.QueryContext(ctx, `
+		SELECT
+			con.conname,
+			fn.nspname,
+			ft.relname,
+			array_agg(a.attname::text ORDER BY k.ord),
+			array_agg(fa.attname::text ORDER BY k.ord)
+		FROM pg_catalog.pg_constraint con
+		JOIN pg_catalog.pg_class c ON c.oid = con.conrelid
+		JOIN pg_catalog.pg_namespace n ON n.oid = c.relnamespace
+		JOIN pg_catalog.pg_class ft ON ft.oid = con.confrelid
+		JOIN pg_catalog.pg_namespace fn ON fn.oid = ft.relnamespace
+		CROSS JOIN LATERAL unnest(con.conkey, con.confkey) WITH ORDINALITY AS k(attnum, fattnum, ord)
+		JOIN pg_catalog.pg_attribute a ON a.attrelid = con.conrelid AND a.attnum = k.attnum
+		JOIN pg_catalog.pg_attribute fa ON fa.attrelid = con.confrelid AND fa.attnum = k.fattnum
+		WHERE con.contype = 'f'
+			AND n.nspname = $1
+			AND c.relname = $2
+		GROUP BY con.conname, fn.nspname, ft.relname
+		ORDER BY con.conname;
+	`, schema, table)
+	if err != nil {
+		return nil, err
+	}
+	defer fkRows.Close()
+
+	type foreignKey struct {
+		name, refSchema, refTable string
+		columns, refColumns       []string
+	}
+	var fks []foreignKey
+	for fkRows.Next() {
+		var fk foreignKey
+		if err := fkRows.Scan(&fk.name, &fk.refSchema, &fk.refTable, pq.Array(&fk.columns), pq.Array(&fk.refColumns)); err != nil {
+			return nil, err
+		}
+		if !tableAllowed(fk.refSchema + "." + fk.refTable) {
+			continue
+		}
+		fks = append(fks, fk)
+	}
+	if err := fkRows.Err(); err != nil {
+		return nil, err
+	}
+
+	child := pq.QuoteIdentifier(schema) + "." + pq.QuoteIdentifier(table)
+	results := []map[string]interface{}{}
+	for _, fk := range fks {
+		var notNull, joinOn []string
+		for i, col := range fk.columns {
+			notNull = append(notNull, "c."+pq.QuoteIdentifier(col)+" IS NOT NULL")
+			joinOn = append(joinOn, "p."+pq.QuoteIdentifier(fk.refColumns[i])+" = c."+pq.QuoteIdentifier(col))
+		}
+		where := fmt.Sprintf("%s AND NOT EXISTS (SELECT 1 FROM %s.%s p WHERE %s)",
+			strings.Join(notNull, " AND "),
+			pq.QuoteIdentifier(fk.refSchema), pq.QuoteIdentifier(fk.refTable),
+			strings.Join(joinOn, " AND "))
+
+		var count int64
+		if err := db.QueryRowContext(ctx, fmt.Sprintf("SELECT count(*) FROM %s c WHERE %s", child, where)).Scan(&count); err != nil {
+			return nil, fmt.Errorf("failed to check %s: %w", fk.name, err)
+		}
+
+		samples := []map[string]interface{}{}
+		if count > 0 {
+			rows, err := db.QueryContext(ctx, fmt.Sprintf("SELECT c.* FROM %s c WHERE %s LIMIT %d", child, where, sampleLimit))
+			if err != nil {
+				return nil, fmt.Errorf("failed to sample %s: %w", fk.name, err)
+			}
+			_, samples, err = scanRows(rows, QueryOptions{})
+			rows.Close()
+			if err != nil {
+				return nil, err
+			}
+			for _, row := range samples {
+				maskRow(schema, table, row)
+			}
+		}
+
+		results = append(results, map[string]interface{}{
+			"constraint":         fk.name,
+			"columns":            fk.columns,
+			"referenced_schema":  fk.refSchema,
+			"referenced_table":   fk.refTable,
+			"referenced_columns": fk.refColumns,
+			"orphan_count":       count,
+			"sample_rows":        samples,
+		})
+	}
+
+	return results, nil
+}
+
+// recentChangeColumns are the timestamp column names GetRecentChanges looks for, in order of preference
+var recentChangeColumns = []string{"updated_at", "modified_at", "last_modified", "created_at"}
+
+// SetRecentChangeColumns overrides the timestamp column names GetRecentChanges auto-detects
+func SetRecentChangeColumns(names []string) {
+	var cols []string
+	for _, name := range names {
+		if name = strings.TrimSpace(name); name != "" {
+			cols = append(cols, name)
+		}
+	}
+	if len(cols) > 0 {
+		recentChangeColumns = cols
+	}
+}
+
+// GetRecentChanges returns the rows of a table whose change timestamp falls within
+// the last since, newest first. The timestamp column is the first of the
+// configured names that exists on the table with a date or timestamp type.
+func GetRecentChanges(db *sql.DB, schema, table string, since time.Duration, limit int) (map[string]interface{}, error) {
+	if limit <= 0 {
+		limit = 100
+	}
+
+	columns, err := DescribeTable(db, schema, table)
+	if err != nil {
+		return nil, err
+	}
+	if len(columns) == 0 {
+		return nil, fmt.Errorf("table %s.%s not found", schema, table)
+	}
+	types := make(map[string]string, len(columns))
+	for _, col := range columns {
+		types[col["name"].(string)] = col["type"].(string)
+	}
+
+	var tsColumn string
+	for _, name := range recentChangeColumns {
+		if typ, ok := types[name]; ok && (typ == "date" || strings.HasPrefix(typ, "timestamp")) {
+			tsColumn = name
+			break
+		}
+	}
+	if tsColumn == "" {
+		return nil, fmt.Errorf("table %s.%s has no timestamp column (looked for %s)", schema, table, strings.Join(recentChangeColumns, ", "))
+	}
+
+	query := fmt.Sprintf("SELECT * FROM %s.%s WHERE %s >= now() - make_interval(secs => $1) ORDER BY %s DESC LIMIT %d",
+		pq.QuoteIdentifier(schema), pq.QuoteIdentifier(table),
+		pq.QuoteIdentifier(tsColumn), pq.QuoteIdentifier(tsColumn), limit)
+	rows, err := db.Query(query, since.Seconds())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	_, results, err := scanRows(rows, QueryOptions{})
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range results {
+		maskRow(schema, table, row)
+	}
+
+	return map[string]interface{}{
+		"column":    tsColumn,
+		"since":     since.String(),
+		"row_count": len(results),
+		"rows":      results,
+	}, nil
+}
+
+// explainJSON returns the JSON plan of a query without executing it, resolving
+// names against schema inside a read-only transaction. The query must be a
+// single statement over tables the access rules allow.
+func explainJSON(ctx context.Context, db *sql.DB, schema, query string) ([]byte, error) {
+	tx, err := db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, fmt.Sprintf("SET LOCAL search_path TO %s", pq.QuoteIdentifier(schema))); err != nil {
+		return nil, fmt.Errorf("failed to set schema: %w", err)
+	}
+	if _, err := checkQueryTables(ctx, tx, query, nil, true); err != nil {
+		return nil, err
+	}
+
+	var planJSON []byte
+	if err := tx.QueryRowContext(ctx, "EXPLAIN (FORMAT JSON) "+query).Scan(&planJSON); err != nil {
+		return nil, fmt.Errorf("explain error: %w", err)
+	}
+	return planJSON, nil
+}
+
+// ExplainQuery returns the parsed JSON plan of a query. With analyze set the
+// query is executed by EXPLAIN ANALYZE inside a transaction that is always
+// rolled back, so data-modifying statements leave no changes behind. Only a
+// single statement is accepted, since a COMMIT after the first would end that
+// transaction and let the statements following it persist.
+func ExplainQuery(ctx context.Context, db *sql.DB, schema, query string, analyze bool) (map[string]interface{}, error) {
+	tx, err := db.BeginTx(ctx, &sql.TxOptions{ReadOnly: !analyze})
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, fmt.Sprintf("SET LOCAL search_path TO %s", pq.QuoteIdentifier(schema))); err != nil {
+		return nil, fmt.Errorf("failed to set schema: %w", err)
+	}
+	if _, err := checkQueryTables(ctx, tx, query, nil, true); err != nil {
+		return nil, err
+	}
+
+	explain := "EXPLAIN (FORMAT JSON) "
+	if analyze {
+		explain = "EXPLAIN (ANALYZE, FORMAT JSON) "
+	}
+	var planJSON []byte
+	if err := tx.QueryRowContext(ctx, explain+query).Scan(&planJSON); err != nil {
+		return nil, fmt.Errorf("explain error: %w", err)
+	}
+
+	var plans []map[string]interface{}
+	if err := json.Unmarshal(planJSON, &plans); err != nil {
+		return nil, fmt.Errorf("failed to parse query plan: %w", err)
+	}
+	if len(plans) == 0 {
+		return nil, fmt.Errorf("failed to parse query plan: empty plan")
+	}
+	return plans[0], nil
+}
+
+// streamRecommendationBytes is the estimated result size above which
+// EstimateResultSize recommends streaming instead of a buffered executeQuery
+const streamRecommendationBytes = 10 << 20
+
+// EstimateResultSize explains a query without running it and returns the
+// planner's estimated row count, average row width and total result bytes
+func EstimateResultSize(ctx context.Context, db *sql.DB, schema, query string) (map[string]interface{}, error) {
+	planJSON, err := explainJSON(ctx, db, schema, query)
+	if err != nil {
+		return nil, err
+	}
+	var plans []struct {
+		Plan struct {
+			PlanRows  float64 `json:"Plan Rows"`
+			PlanWidth int64   `json:"Plan Width"`
+			TotalCost float64 `json:"Total Cost"`
+		} `json:"Plan"`
+	}
+	if err := json.Unmarshal(planJSON, &plans); err != nil || len(plans) == 0 {
+		return nil, fmt.Errorf("failed to parse query plan: %v", err)
+	}
+
+	plan := plans[0].Plan
+	rowsEstimate := int64(plan.PlanRows)
+	bytesEstimate := rowsEstimate * plan.PlanWidth
+	recommendation := "executeQuery"
+	if bytesEstimate > streamRecommendationBytes {
+		recommendation = "openStream"
+	}
+
+	return map[string]interface{}{
+		"estimated_rows":      rowsEstimate,
+		"estimated_row_width": plan.PlanWidth,
+		"estimated_bytes":     bytesEstimate,
+		"total_cost":          plan.TotalCost,
+		"recommendation":      recommendation,
+	}, nil
+}
+
+// ListRLSPolicies returns whether row-level security is enabled and forced on a
+// table together with its policies from pg_policies
+func ListRLSPolicies(db *sql.DB, schema, table string) (map[string]interface{}, error) {
+	if err := checkTableAccess(schema, table); err != nil {
+		return nil, err
+	}
+
+	var enabled, forced bool
+	err := db.QueryRow(`
+		SELECT c.relrowsecurity, c.relforcerowsecurity
+		FROM pg_catalog.pg_class c
+		JOIN pg_catalog.pg_namespace n ON n.oid = c.relnamespace
+		WHERE n.nspname = $1 AND c.relname = $2;
+	`, schema, table).Scan(&enabled, &forced)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("table %s.%s not found", schema, table)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Query(`
+		SELECT policyname, permissive, roles::text[], cmd, qual, with_check
+		FROM pg_catalog.pg_policies
+		WHERE schemaname = $1 AND tablename = $2
+		ORDER BY policyname;
+	`, schema, table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	policies := []map[string]interface{}{}
+	for rows.Next() {
+		var name, permissive, command string
+		var roles []string
+		var using, withCheck sql.NullString
+		if err := rows.Scan(&name, &permissive, pq.Array(&roles), &command, &using, &withCheck); err != nil {
+			return nil, err
+		}
+		policy := map[string]interface{}{
+			"name":       name,
+			"permissive": permissive == "PERMISSIVE",
+			"command":    command,
+			"roles":      roles,
+		}
+		if using.Valid {
+			policy["using"] = using.String
+		}
+		if withCheck.Valid {
+			policy["with_check"] = withCheck.String
+		}
+		policies = append(policies, policy)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	result := map[string]interface{}{
+		"table":       table,
+		"rls_enabled": enabled,
+		"rls_forced":  forced,
+		"policies":    policies,
+	}
+	switch {
+	case !enabled && len(policies) > 0:
+		result["note"] = "row-level security is disabled on this table, so these policies are not enforced"
+	case !enabled:
+		result["note"] = "row-level security is disabled on this table; every role with table privileges sees all rows"
+	case !forced:
+		result["note"] = "row-level security is not forced, so the table owner bypasses these policies"
+	}
+	return result, nil
+}
+
+// ListTablesDetailed returns every table, view, materialized view and foreign
+// table in a schema with its kind, estimated row count, total size and whether
+// it has a primary key, largest first, using a single catalog query
+func ListTablesDetailed(db *sql.DB, schema string) ([]map[string]interface{}, error) {
+	rows, err := db.Query(`
+		SELECT
+			c.relname,
+			CASE c.relkind
+				WHEN 'r' THEN 'table'
+				WHEN 'p' THEN 'partitioned table'
+				WHEN 'v' THEN 'view'
+				WHEN 'm' THEN 'materialized view'
+				WHEN 'f' THEN 'foreign table'
+			END,
+			CASE WHEN c.relkind IN ('r', 'm') THEN c.reltuples::bigint END,
+			CASE WHEN c.relkind IN ('r', 'm', 'p') THEN pg_catalog.pg_total_relation_size(c.oid) END,
+			EXISTS (
+				SELECT 1 FROM pg_catalog.pg_constraint con
+				WHERE con.conrelid = c.oid AND con.contype = 'p'
+			)
+		FROM pg_catalog.pg_class c
+		JOIN pg_catalog.pg_namespace n ON n.oid = c.relnamespace
+		WHERE n.nspname = $1
+			AND c.relkind IN ('r', 'v', 'm', 'f', 'p')
+			AND `+relationVisibleCond+`
+		ORDER BY 4 DESC NULLS LAST, c.relname;
+	`, schema)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tables := []map[string]interface{}{}
+	for rows.Next() {
+		var name, kind string
+		var rowEstimate, totalSize sql.NullInt64
+		var hasPrimaryKey bool
+		if err := rows.Scan(&name, &kind, &rowEstimate, &totalSize, &hasPrimaryKey); err != nil {
+			return nil, err
+		}
+		if !tableAllowed(schema + "." + name) {
+			continue
+		}
+
+		table := map[string]interface{}{
+			"name":            name,
+			"kind":            kind,
+			"has_primary_key": hasPrimaryKey,
+		}
+		// reltuples is -1 for tables that have never been analyzed
+		if rowEstimate.Valid && rowEstimate.Int64 >= 0 {
+			table["row_estimate"] = rowEstimate.Int64
+		}
+		if totalSize.Valid {
+			table["total_size_bytes"] = totalSize.Int64
+		}
+		tables = append(tables, table)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return tables, nil
+}
+
+// serverVersionNum returns the server's version as an integer, e.g. 160002 for 16.2
+func serverVersionNum(db *sql.DB) (int, error) {
+	var version int
+	if err := db.QueryRow("SELECT current_setting('server_version_num')::int").Scan(&version); err != nil {
+		return 0, fmt.Errorf("failed to read server version: %w", err)
+	}
+	return version, nil
+}
+
+// statsViewRow reads the single row of a cumulative statistics view as a map
+func statsViewRow(db *sql.DB, view string) (map[string]interface{}, error) {
+	var rowJSON []byte
+	if err := db.QueryRow(fmt.Sprintf("SELECT row_to_json(s) FROM %s s", view)).Scan(&rowJSON); err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", view, err)
+	}
+	var row map[string]interface{}
+	if err := json.Unmarshal(rowJSON, &row); err != nil {
+		return nil, err
+	}
+	return row, nil
+}
+
+// GetBgwriterStats returns background writer and checkpoint statistics. From
+// PostgreSQL 17 the checkpoint counters live in pg_stat_checkpointer, so both
+// views are read and returned under separate keys.
+func GetBgwriterStats(db *sql.DB) (map[string]interface{}, error) {
+	version, err := serverVersionNum(db)
+	if err != nil {
+		return nil, err
+	}
+
+	bgwriter, err := statsViewRow(db, "pg_catalog.pg_stat_bgwriter")
+	if err != nil {
+		return nil, err
+	}
+	result := map[string]interface{}{
+		"server_version_num": version,
+		"bgwriter":           bgwriter,
+	}
+
+	if version >= 170000 {
+		checkpointer, err := statsViewRow(db, "pg_catalog.pg_stat_checkpointer")
+		if err != nil {
+			return nil, err
+		}
+		result["checkpointer"] = checkpointer
+	}
+	return result, nil
+}
+
+// GetWALStats returns WAL generation statistics from pg_stat_wal and the current
+// WAL position. pg_stat_wal exists from PostgreSQL 14; older servers get an
+// explanatory message instead of an error.
+func GetWALStats(db *sql.DB) (map[string]interface{}, error) {
+	version, err := serverVersionNum(db)
+	if err != nil {
+		return nil, err
+	}
+	result := map[string]interface{}{
+		"server_version_num": version,
+	}
+
+	var inRecovery bool
+	var lsn sql.NullString
+	if err := db.QueryRow(`
+		SELECT pg_catalog.pg_is_in_recovery(),
+			CASE WHEN pg_catalog.pg_is_in_recovery() THEN pg_catalog.pg_last_wal_replay_lsn()
+				ELSE pg_catalog.pg_current_wal_lsn() END::text
+	`).Scan(&inRecovery, &lsn); err != nil {
+		return nil, fmt.Errorf("failed to read WAL position: %w", err)
+	}
+	result["in_recovery"] = inRecovery
+	if lsn.Valid {
+		result["wal_lsn"] = lsn.String
+	}
+
+	if version < 140000 {
+		result["available"] = false
+		result["message"] = fmt.Sprintf("pg_stat_wal requires PostgreSQL 14 or later; this server reports version %d", version)
+		return result, nil
+	}
+
+	wal, err := statsViewRow(db, "pg_catalog.pg_stat_wal")
+	if err != nil {
+		return nil, err
+	}
+	result["available"] = true
+	result["wal"] = wal
+	return result, nil
+}
+
+// FindTablesWithoutPrimaryKey returns the base tables of a schema that have no
+// primary key, largest first. Partitioned parents are skipped since their
+// partitions are the tables that hold rows; views and foreign tables cannot have one.
+func FindTablesWithoutPrimaryKey(db *sql.DB, schema string) ([]map[string]interface{}, error) {
+	rows, err := db.Query(`
+		SELECT
+			c.relname,
+			c.reltuples::bigint,
+			c.relispartition,
+			EXISTS (
+				SELECT 1 FROM pg_catalog.pg_index i
+				WHERE i.indrelid = c.oid AND i.indisunique
+			)
+		FROM pg_catalog.pg_class c
+		JOIN pg_catalog.pg_namespace n ON n.oid = c.relnamespace
+		WHERE n.nspname = $1
+			AND c.relkind = 'r'
+			AND `+relationVisibleCond+`
+			AND NOT EXISTS (
+				SELECT 1 FROM pg_catalog.pg_constraint con
+				WHERE con.conrelid = c.oid AND con.contype = 'p'
+			)
+		ORDER BY c.reltuples DESC, c.relname;
+	`, schema)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tables := []map[string]interface{}{}
+	for rows.Next() {
+		var name string
+		var rowEstimate int64
+		var isPartition, hasUniqueIndex bool
+		if err := rows.Scan(&name, &rowEstimate, &isPartition, &hasUniqueIndex); err != nil {
+			return nil, err
+		}
+		if !tableAllowed(schema + "." + name) {
+			continue
+		}
+
+		table := map[string]interface{}{
+			"table":            name,
+			"is_partition":     isPartition,
+			"has_unique_index": hasUniqueIndex,
+		}
+		// reltuples is -1 for tables that have never been analyzed
+		if rowEstimate >= 0 {
+			table["row_estimate"] = rowEstimate
+		}
+		tables = append(tables, table)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return tables, nil
+}
+
+// SuggestPaginationKeys ranks a table's indexed columns by how well they work
+// as keyset pagination keys: the primary key first, then unique indexes over
+// NOT NULL columns, then nullable unique indexes, then plain indexes whose
+// leading column is monotonic (a timestamp or sequence-backed integer), which
+// need the primary key appended as a tiebreaker
+func SuggestPaginationKeys(db *sql.DB, schema, table string) ([]map[string]interface{}, error) {
+	if err := checkTableAccess(schema, table); err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Query(`
+		SELECT
+			i.relname,
+			ix.indisprimary,
+			ix.indisunique,
+			array_agg(a.attname::text ORDER BY k.ord),
+			array_agg(pg_catalog.format_type(a.atttypid, a.atttypmod) ORDER BY k.ord),
+			bool_and(a.attnotnull),
+			(array_agg(a.attidentity <> '' OR COALESCE(pg_catalog.pg_get_expr(d.adbin, d.adrelid), '') LIKE 'nextval(%' ORDER BY k.ord))[1]
+		FROM pg_catalog.pg_index ix
+		JOIN pg_catalog.pg_class c ON c.oid = ix.indrelid
+		JOIN pg_catalog.pg_namespace n ON n.oid = c.relnamespace
+		JOIN pg_catalog.pg_class i ON i.oid = ix.indexrelid
+		CROSS JOIN LATERAL unnest(ix.indkey::int2[]) WITH ORDINALITY AS k(attnum, ord)
+		JOIN pg_catalog.pg_attribute a ON a.attrelid = c.oid AND a.attnum = k.attnum
+		LEFT JOIN pg_catalog.pg_attrdef d ON d.adrelid = c.oid AND d.adnum = a.attnum
+		WHERE n.nspname = $1
+			AND c.relname = $2
+			AND ix.indisvalid
+			AND ix.indpred IS NULL
+			AND ix.indexprs IS NULL
+			AND k.ord <= ix.indnkeyatts
+		GROUP BY i.relname, ix.indisprimary, ix.indisunique
+		ORDER BY i.relname;
+	`, schema, table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	type index struct {
+		name               string
+		primary, unique    bool
+		columns, types     []string
+		notNull, monotonic bool
+	}
+	var indexes []index
+	var pkColumns []string
+	for rows.Next() {
+		var idx index
+		if err := rows.Scan(&idx.name, &idx.primary, &idx.unique, pq.Array(&idx.columns), pq.Array(&idx.types), &idx.notNull, &idx.monotonic); err != nil {
+			return nil, err
+		}
+		if idx.primary {
+			pkColumns = idx.columns
+		}
+		indexes = append(indexes, idx)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	candidates := []map[string]interface{}{}
+	for _, idx := range indexes {
+		leadingTimestamp := strings.HasPrefix(idx.types[0], "timestamp") || idx.types[0] == "date"
+
+		var rank int
+		var kind, reason string
+		orderBy := idx.columns
+		switch {
+		case idx.primary:
+			rank, kind, reason = 1, "primary_key", "unique, NOT NULL and indexed"
+		case idx.unique && idx.notNull:
+			rank, kind, reason = 2, "unique", "unique index over NOT NULL columns"
+		case idx.unique:
+			rank, kind, reason = 3, "unique_nullable", "unique index, but NULLs are not unique and must be filtered or ordered explicitly"
+		case idx.monotonic || leadingTimestamp:
+			rank, kind, reason = 4, "monotonic", "indexed monotonic column; not unique, so a tiebreaker column is needed"
+			if len(pkColumns) > 0 {
+				orderBy = append(append([]string{}, idx.columns...), pkColumns...)
+			}
+		default:
+			continue
+		}
+
+		candidates = append(candidates, map[string]interface{}{
+			"rank":     rank,
+			"kind":     kind,
+			"index":    idx.name,
+			"columns":  idx.columns,
+			"types":    idx.types,
+			"order_by": orderBy,
+			"reason":   reason,
+		})
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i]["rank"].(int) < candidates[j]["rank"].(int)
+	})
+	return candidates, nil
+}
+
+// GetRecentlyModifiedTables ranks the tables of a schema by recent write
+// activity from pg_stat_user_tables: rows modified since the last analyze
+// first, then total inserts, updates and deletes. The counters accumulate
+// since the last statistics reset, which is returned as stats_reset.
+func GetRecentlyModifiedTables(db *sql.DB, schema string, limit int) (map[string]interface{}, error) {
+	if limit <= 0 {
+		limit = 10
+	}
+
+	var statsReset sql.NullTime
+	if err := db.QueryRow(
+		"SELECT stats_reset FROM pg_catalog.pg_stat_database WHERE datname = current_database()",
+	).Scan(&statsReset); err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	rows, err := db.Query(`
+		SELECT
+			relname,
+			n_tup_ins,
+			n_tup_upd,
+			n_tup_del,
+			n_mod_since_analyze,
+			GREATEST(last_vacuum, last_autovacuum),
+			GREATEST(last_analyze, last_autoanalyze)
+		FROM pg_catalog.pg_stat_user_tables
+		WHERE schemaname = $1
+		ORDER BY n_mod_since_analyze DESC, n_tup_ins + n_tup_upd + n_tup_del DESC, relname;
+	`, schema)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	// The limit is applied here rather than in SQL so hidden tables do not use it up
+	tables := []map[string]interface{}{}
+	for rows.Next() && len(tables) < limit {
+		var name string
+		var inserts, updates, deletes, modSinceAnalyze int64
+		var lastVacuum, lastAnalyze sql.NullTime
+		if err := rows.Scan(&name, &inserts, &updates, &deletes, &modSinceAnalyze, &lastVacuum, &lastAnalyze); err != nil {
+			return nil, err
+		}
+		if !tableAllowed(schema + "." + name) {
+			continue
+		}
+
+		table := map[string]interface{}{
+			"table":                  name,
+			"inserts":                inserts,
+			"updates":                updates,
+			"deletes":                deletes,
+			"total_writes":           inserts + updates + deletes,
+			"modified_since_analyze": modSinceAnalyze,
+		}
+		if lastVacuum.Valid {
+			table["last_vacuum"] = lastVacuum.Time
+		}
+		if lastAnalyze.Valid {
+			table["last_analyze"] = lastAnalyze.Time
+		}
+		tables = append(tables, table)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	result := map[string]interface{}{
+		"tables": tables,
+		"note":   "write counters accumulate since the last statistics reset; a recent reset makes them understate activity",
+	}
+	if statsReset.Valid {
+		result["stats_reset"] = statsReset.Time
+	}
+	return result, nil
+}
+
+// ErrConfirmationMismatch is returned when a destructive operation's confirmation token does not match its target
+var ErrConfirmationMismatch = errors.New("confirmation does not match the table name")
+
+// TruncateTable empties a table after checking that confirm equals the table
+// name, optionally restarting its identity sequences and cascading to tables
+// that reference it. It returns the planner's row estimate from before the truncate.
+func TruncateTable(ctx context.Context, db *sql.DB, schema, table, confirm string, restartIdentity, cascade bool) (map[string]interface{}, error) {
+	if err := checkTableAccess(schema, table); err != nil {
+		return nil, err
+	}
+	if confirm != table {
+		return nil, fmt.Errorf("%w: pass confirm=%q to truncate %s.%s", ErrConfirmationMismatch, table, schema, table)
+	}
+
+	var rowEstimate int64
+	err := db.QueryRowContext(ctx, `
+		SELECT c.reltuples::bigint
+		FROM pg_catalog.pg_class c
+		JOIN pg_catalog.pg_namespace n ON n.oid = c.relnamespace
+		WHERE n.nspname = $1 AND c.relname = $2 AND c.relkind IN ('r', 'p');
+	`, schema, table).Scan(&rowEstimate)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("table %s.%s not found", schema, table)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if cascade {
+		if err := checkCascadeAccess(ctx, db, schema, table); err != nil {
+			return nil, err
+		}
+	}
+
+	stmt := fmt.Sprintf("TRUNCATE TABLE %s.%s", pq.QuoteIdentifier(schema), pq.QuoteIdentifier(table))
+	if restartIdentity {
+		stmt += " RESTART IDENTITY"
+	}
+	if cascade {
+		stmt += " CASCADE"
+	}
+
+	start := time.Now()
+	defer recordQuery(stmt, start)
+	if _, err := db.ExecContext(ctx, stmt); err != nil {
+		return nil, fmt.Errorf("truncate error: %w", err)
+	}
+	results.reset()
+
+	result := map[string]interface{}{
+		"table":            schema + "." + table,
+		"restart_identity": restartIdentity,
+		"cascade":          cascade,
+	}
+	// reltuples is -1 for tables that have never been analyzed
+	if rowEstimate >= 0 {
+		result["rows_removed_estimate"] = rowEstimate
+	}
+	return result, nil
+}
+
+// checkCascadeAccess checks every table TRUNCATE ... CASCADE would reach through
+// foreign keys referencing schema.table against the access rules
+func checkCascadeAccess(ctx context.Context, db *sql.DB, schema, table string) error {
+	if !tableAccessRestricted() {
+		return nil
+	}
+
+	rows, err := db.QueryContext(ctx, `
+		WITH RECURSIVE refs(oid) AS (
+			SELECT c.oid
+			FROM pg_catalog.pg_class c
+			JOIN pg_catalog.pg_namespace n ON n.oid = c.relnamespace
+			WHERE n.nspname = $1 AND c.relname = $2
+			UNION
+			SELECT con.conrelid
+			FROM pg_catalog.pg_constraint con
+			JOIN refs ON con.confrelid = refs.oid
+			WHERE con.contype = 'f'
+		)
+		SELECT n.nspname, c.relname
+		FROM refs
+		JOIN pg_catalog.pg_class c ON c.oid = refs.oid
+		JOIN pg_catalog.pg_namespace n ON n.oid = c.relnamespace;
+	`, schema, table)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var refSchema, refTable string
+		if err := rows.Scan(&refSchema, &refTable); err != nil {
+			return err
+		}
+		if err := checkTableAccess(refSchema, refTable); err != nil {
+			return fmt.Errorf("cascade would truncate a hidden table: %w", err)
+		}
+	}
+	return rows.Err()
+}
+
+// Maintenance operations accepted by RunMaintenance
+const (
+	MaintenanceAnalyze       = "analyze"
+	MaintenanceVacuum        = "vacuum"
+	MaintenanceVacuumAnalyze = "vacuum_analyze"
+)
+
+// ErrVacuumFullDisabled is returned when VACUUM FULL is requested but not allowed
+var ErrVacuumFullDisabled = errors.New("VACUUM FULL is disabled")
+
+// RunMaintenance runs ANALYZE, VACUUM or VACUUM ANALYZE on a table. full turns
+// VACUUM into VACUUM FULL, which rewrites the table under an ACCESS EXCLUSIVE
+// lock, so it is rejected unless allowFull is set.
+func RunMaintenance(ctx context.Context, db *sql.DB, schema, table, operation string, full, allowFull bool) (map[string]interface{}, error) {
+	var command string
+	switch operation {
+	case MaintenanceAnalyze:
+		command = "ANALYZE"
+	case MaintenanceVacuum:
+		command = "VACUUM"
+	case MaintenanceVacuumAnalyze:
+		command = "VACUUM (ANALYZE)"
+	default:
+		return nil, fmt.Errorf("unsupported operation %q (use analyze, vacuum or vacuum_analyze)", operation)
+	}
+	if full {
+		if operation == MaintenanceAnalyze {
+			return nil, fmt.Errorf("full only applies to vacuum")
+		}
+		if !allowFull {
+			return nil, fmt.Errorf("%w: it locks the table for the whole rewrite; set ALLOW_VACUUM_FULL to enable it", ErrVacuumFullDisabled)
+		}
+		command = strings.Replace(command, "VACUUM", "VACUUM FULL", 1)
+	}
+	if err := requireTable(db, schema, table); err != nil {
+		return nil, err
+	}
+
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = WithQueryTimeout(ctx, 0)
+		defer cancel()
+	}
+	stmt := fmt.Sprintf("%s %s.%s", command, pq.QuoteIdentifier(schema), pq.QuoteIdentifier(table))
+
+	// VACUUM cannot run inside a transaction, so it is executed on its own
+	start := time.Now()
+	defer recordQuery(stmt, start)
+	if _, err := db.ExecContext(ctx, stmt); err != nil {
+		return nil, fmt.Errorf("maintenance error: %w", err)
+	}
+	// Fresh statistics change what cached introspection results report
+	results.reset()
+
+	return map[string]interface{}{
+		"table":       schema + "." + table,
+		"statement":   stmt,
+		"status":      "completed",
+		"duration_ms": durationMillis(time.Since(start)),
+	}, nil
+}
+
+// sensitiveSettingPattern matches settings whose values may hold credentials
+var sensitiveSettingPattern = regexp.MustCompile(`(?i)(password|passphrase|secret|token|key|conninfo|_command$)`)
+
+// GetServerSettings returns pg_settings rows whose name matches the ILIKE
+// pattern (all settings when empty). Values of settings that may hold
+// credentials, such as primary_conninfo or archive_command, are redacted.
+func GetServerSettings(db *sql.DB, pattern string) ([]map[string]interface{}, error) {
+	if pattern == "" {
+		pattern = "%"
+	}
+	rows, err := db.Query(`
+		SELECT name, setting, unit, category, context, source, pending_restart
+		FROM pg_catalog.pg_settings
+		WHERE name ILIKE $1
+		ORDER BY name;
+	`, pattern)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	settings := []map[string]interface{}{}
+	for rows.Next() {
+		var name, category, context, source string
+		var setting, unit sql.NullString
+		var pendingRestart bool
+		if err := rows.Scan(&name, &setting, &unit, &category, &context, &source, &pendingRestart); err != nil {
+			return nil, err
+		}
+
+		entry := map[string]interface{}{
+			"name":             name,
+			"category":         category,
+			"context":          context,
+			"source":           source,
+			"requires_restart": context == "postmaster",
+			"pending_restart":  pendingRestart,
+		}
+		if setting.Valid {
+			if sensitiveSettingPattern.MatchString(name) && setting.String != "" {
+				entry["setting"] = redactedValue
+			} else {
+				entry["setting"] = setting.String
+			}
+		}
+		if unit.Valid {
+			entry["unit"] = unit.String
+		}
+		settings = append(settings, entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return settings, nil
+}
+
+// GetDatabaseInfo reports what the server is connected to: the database name,
+// server version, total database size, client connection counts and how long
+// the server has been up
+func GetDatabaseInfo(db *sql.DB) (map[string]interface{}, error) {
+	var database, version, sizePretty, startedAt string
+	var size, connections, active int64
+	var uptimeSeconds float64
+	err := db.QueryRow(`
+		SELECT current_database(), current_setting('server_version'),
+			pg_catalog.pg_database_size(current_database()),
+			pg_catalog.pg_size_pretty(pg_catalog.pg_database_size(current_database())),
+			pg_catalog.pg_postmaster_start_time()::text,
+			extract(epoch FROM now() - pg_catalog.pg_postmaster_start_time()),
+			(SELECT count(*) FROM pg_catalog.pg_stat_activity WHERE backend_type = 'client backend'),
+			(SELECT count(*) FROM pg_catalog.pg_stat_activity WHERE backend_type = 'client backend' AND state = 'active');
+	`).Scan(&database, &version, &size, &sizePretty, &startedAt, &uptimeSeconds, &connections, &active)
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]interface{}{
+		"database":           database,
+		"server_version":     version,
+		"size_bytes":         size,
+		"size_pretty":        sizePretty,
+		"started_at":         startedAt,
+		"uptime_seconds":     int64(uptimeSeconds),
+		"connections":        connections,
+		"active_connections": active,
+	}, nil
+}
+
+// defaultColumnSearchLimit and maxColumnSearchLimit bound the matches SearchColumns returns
+const (
+	defaultColumnSearchLimit = 100
+	maxColumnSearchLimit     = 1000
+)
+
+// likePattern turns a search pattern with * and ? wildcards into an ILIKE
+// pattern. Underscores are common in names, so only * ? and % make the pattern
+// anchored; without them it matches anywhere, and _ still matches any character.
+func likePattern(pattern string) string {
+	like := strings.NewReplacer("*", "%", "?", "_").Replace(pattern)
+	if !strings.ContainsAny(pattern, "*?%") {
+		like = "%" + like + "%"
+	}
+	return like
+}
+
+// SearchColumns finds columns whose name matches pattern, case-insensitively,
+// across every non-system schema or only the given one. The pattern accepts *
+// and ? wildcards as well as ILIKE's % and _; without *, ? or % it matches
+// anywhere in the name. At most limit matches are returned, with truncated set
+// when more exist.
+func SearchColumns(db *sql.DB, pattern, schema string, limit int) (map[string]interface{}, error) {
+	if pattern == "" {
+		return nil, fmt.Errorf("pattern is required")
+	}
+	if limit <= 0 {
+		limit = defaultColumnSearchLimit
+	}
+	limit = min(limit, maxColumnSearchLimit)
+
+	like := likePattern(pattern)
+
+	rows, err := db.Query(`
+		SELECT n.nspname, c.relname, a.attname, `+pgDataTypeExpr+`
+		FROM pg_catalog.pg_attribute a
+		JOIN pg_catalog.pg_class c ON c.oid = a.attrelid
+		JOIN pg_catalog.pg_namespace n ON n.oid = c.relnamespace
+		JOIN pg_catalog.pg_type t ON t.oid = a.atttypid
+		JOIN pg_catalog.pg_namespace nt ON nt.oid = t.typnamespace
+		LEFT JOIN pg_catalog.pg_type bt ON t.typtype = 'd' AND bt.oid = t.typbasetype
+		LEFT JOIN pg_catalog.pg_namespace nbt ON nbt.oid = bt.typnamespace
+		WHERE a.attname ILIKE $1
+			AND ($2 = '' OR n.nspname = $2)
+			AND n.nspname NOT LIKE 'pg\_%' AND n.nspname <> 'information_schema'
+			AND c.relkind IN ('r', 'v', 'm', 'f', 'p')
+			AND a.attnum > 0
+			AND NOT a.attisdropped
+			AND (pg_catalog.pg_has_role(c.relowner, 'USAGE')
+				OR pg_catalog.has_column_privilege(c.oid, a.attnum, 'SELECT, INSERT, UPDATE, REFERENCES'))
+		ORDER BY n.nspname, c.relname, a.attnum
+		LIMIT $3;
+	`, like, schema, limit+1)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	matches := []map[string]interface{}{}
+	truncated := false
+	for rows.Next() {
+		var schemaName, table, column, dataType string
+		if err := rows.Scan(&schemaName, &table, &column, &dataType); err != nil {
+			return nil, err
+		}
+		if len(matches) == limit {
+			truncated = true
+			break
+		}
+		if !tableAllowed(schemaName + "." + table) {
+			continue
+		}
+		matches = append(matches, map[string]interface{}{
+			"schema": schemaName,
+			"table":  table,
+			"column": column,
+			"type":   dataType,
+		})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return map[string]interface{}{
+		"matches":   matches,
+		"truncated": truncated,
+	}, nil
+}
+
+// GetComments returns the COMMENT ON documentation of a schema's tables, views
+// and columns, or of a single table when table is set. Each entry names its
+// table, plus its column for column comments; objects without a comment are left out.
+func GetComments(db *sql.DB, schema, table string) ([]map[string]interface{}, error) {
+	if table != "" {
+		if err := requireTable(db, schema, table); err != nil {
+			return nil, err
+		}
+	}
+	rows, err := db.Query(`
+		SELECT c.relname, a.attname, d.description
+		FROM pg_catalog.pg_description d
+		JOIN pg_catalog.pg_class c ON c.oid = d.objoid AND d.classoid = 'pg_catalog.pg_class'::regclass
+		JOIN pg_catalog.pg_namespace n ON n.oid = c.relnamespace
+		LEFT JOIN pg_catalog.pg_attribute a ON a.attrelid = c.oid AND a.attnum = d.objsubid AND d.objsubid > 0
+		WHERE n.nspname = $1
+			AND ($2 = '' OR c.relname = $2)
+			AND c.relkind IN ('r', 'v', 'm', 'f', 'p')
+			AND (d.objsubid = 0 OR NOT a.attisdropped)
+			AND `+relationVisibleCond+`
+		ORDER BY c.relname, d.objsubid;
+	`, schema, table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	comments := []map[string]interface{}{}
+	for rows.Next() {
+		var tableName, comment string
+		var column sql.NullString
+		if err := rows.Scan(&tableName, &column, &comment); err != nil {
+			return nil, err
+		}
+		if !tableAllowed(schema + "." + tableName) {
+			continue
+		}
+		entry := map[string]interface{}{
+			"table":   tableName,
+			"comment": comment,
+		}
+		if column.Valid {
+			entry["column"] = column.String
+		}
+		comments = append(comments, entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return comments, nil
 }
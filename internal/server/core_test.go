@@ -0,0 +1,490 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+func TestExplainQueryAnalyzeRollsBack(t *testing.T) {
+	db := testDB(t)
+	schema := testSchema(t, db,
+		"CREATE TABLE items (id int)",
+		"INSERT INTO items VALUES (1), (2)",
+	)
+	ctx := context.Background()
+
+	plan, err := ExplainQuery(ctx, db, schema, "DELETE FROM items", true)
+	if err != nil {
+		t.Fatalf("ExplainQuery: %v", err)
+	}
+	if plan == nil {
+		t.Fatal("ExplainQuery returned no plan")
+	}
+
+	// A COMMIT after the first statement would end the rolled-back transaction
+	for _, query := range []string{
+		"SELECT 1; COMMIT; DELETE FROM items",
+		"DELETE FROM items; COMMIT",
+	} {
+		if _, err := ExplainQuery(ctx, db, schema, query, true); !errors.Is(err, ErrMultipleStatements) {
+			t.Errorf("%q: err = %v, want ErrMultipleStatements", query, err)
+		}
+	}
+
+	var count int
+	if err := db.QueryRow("SELECT count(*) FROM " + schema + ".items").Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+	if count != 2 {
+		t.Fatalf("items has %d rows after EXPLAIN ANALYZE, want 2", count)
+	}
+}
+
+func TestExplainQueryRejectsDeniedTable(t *testing.T) {
+	db := testDB(t)
+	schema := testSchema(t, db, "CREATE TABLE secret (id int)")
+	setTestTableAccess(t, "", schema+".secret")
+
+	_, err := ExplainQuery(context.Background(), db, schema, "SELECT * FROM secret", false)
+	if !errors.Is(err, ErrAccessDenied) {
+		t.Fatalf("err = %v, want ErrAccessDenied", err)
+	}
+}
+
+func TestFindOrphans(t *testing.T) {
+	db := testDB(t)
+	schema := testSchema(t, db,
+		"CREATE TABLE customers (id int PRIMARY KEY)",
+		"CREATE TABLE vault (id int PRIMARY KEY)",
+		"CREATE TABLE orders (id int, customer_id int, vault_id int, email text)",
+		"INSERT INTO customers VALUES (1)",
+		"INSERT INTO orders VALUES (1, 1, NULL, 'a@example.com'), (2, 2, NULL, 'b@example.com'), (3, NULL, 7, 'c@example.com')",
+		// NOT VALID keeps the existing orphans in place
+		"ALTER TABLE orders ADD CONSTRAINT orders_customer_fk FOREIGN KEY (customer_id) REFERENCES customers NOT VALID",
+		"ALTER TABLE orders ADD CONSTRAINT orders_vault_fk FOREIGN KEY (vault_id) REFERENCES vault NOT VALID",
+	)
+	setTestMaskPolicy(t, "email:redact")
+	ctx := context.Background()
+
+	orphans, err := FindOrphans(ctx, db, schema, "orders", 5)
+	if err != nil {
+		t.Fatalf("FindOrphans: %v", err)
+	}
+	if len(orphans) != 2 {
+		t.Fatalf("got %d constraints, want 2", len(orphans))
+	}
+	customer := orphans[0]
+	// The NULL customer_id is not an orphan
+	if customer["constraint"] != "orders_customer_fk" || customer["orphan_count"] != int64(1) {
+		t.Fatalf("customer constraint = %v", customer)
+	}
+	samples := customer["sample_rows"].([]map[string]interface{})
+	if len(samples) != 1 || samples[0]["email"] != redactedValue {
+		t.Errorf("sample_rows = %v, want one row with email redacted", samples)
+	}
+
+	// A constraint referencing a hidden table is left out
+	setTestTableAccess(t, "", schema+".vault")
+	orphans, err = FindOrphans(ctx, db, schema, "orders", 5)
+	if err != nil {
+		t.Fatalf("FindOrphans with vault hidden: %v", err)
+	}
+	if len(orphans) != 1 || orphans[0]["constraint"] != "orders_customer_fk" {
+		t.Errorf("constraints = %v, want only orders_customer_fk", orphans)
+	}
+
+	setTestTableAccess(t, "", schema+".orders")
+	if _, err := FindOrphans(ctx, db, schema, "orders", 5); !errors.Is(err, ErrAccessDenied) {
+		t.Errorf("denied table: err = %v, want ErrAccessDenied", err)
+	}
+}
+
+func TestTruncateTableConfirmationMismatch(t *testing.T) {
+	tests := []struct {
+		table, confirm string
+	}{
+		{"scratch", ""},
+		{"scratch", "scratc"},
+		{"scratch", "Scratch"},
+		{"scratch", "public.scratch"},
+		{"scratch", "scratch "},
+	}
+	for _, tt := range tests {
+		// The confirmation is checked before the database is touched
+		_, err := TruncateTable(context.Background(), nil, "public", tt.table, tt.confirm, false, false)
+		if !errors.Is(err, ErrConfirmationMismatch) {
+			t.Errorf("confirm %q for %q: err = %v, want ErrConfirmationMismatch", tt.confirm, tt.table, err)
+		}
+	}
+}
+
+func TestTruncateTable(t *testing.T) {
+	db := testDB(t)
+	schema := testSchema(t, db,
+		"CREATE TABLE scratch (id serial, note text)",
+		"INSERT INTO scratch (note) VALUES ('a'), ('b')",
+	)
+	ctx := context.Background()
+
+	if _, err := TruncateTable(ctx, db, schema, "scratch", "other", false, false); !errors.Is(err, ErrConfirmationMismatch) {
+		t.Fatalf("mismatch: err = %v, want ErrConfirmationMismatch", err)
+	}
+	var count int
+	if err := db.QueryRow("SELECT count(*) FROM " + schema + ".scratch").Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+	if count != 2 {
+		t.Fatalf("table changed after a confirmation mismatch: %d rows", count)
+	}
+
+	if _, err := TruncateTable(ctx, db, schema, "scratch", "scratch", true, false); err != nil {
+		t.Fatalf("TruncateTable: %v", err)
+	}
+	mustExec(t, db, "INSERT INTO "+schema+".scratch (note) VALUES ('c')")
+	var id int
+	if err := db.QueryRow("SELECT id FROM " + schema + ".scratch").Scan(&id); err != nil {
+		t.Fatal(err)
+	}
+	if id != 1 {
+		t.Errorf("id after RESTART IDENTITY = %d, want 1", id)
+	}
+}
+
+func TestGetIndexedColumns(t *testing.T) {
+	db := testDB(t)
+	schema := testSchema(t, db,
+		"CREATE TABLE items (id int PRIMARY KEY, a int, b int, c int, note text)",
+		"CREATE INDEX items_a ON items (a)",
+		"CREATE UNIQUE INDEX items_b_a ON items (b, a) INCLUDE (c)",
+	)
+
+	columns, err := GetIndexedColumns(db, schema, "items")
+	if err != nil {
+		t.Fatalf("GetIndexedColumns: %v", err)
+	}
+	// Each column's indexes as name/position with u for unique, p for primary
+	// key and i for an included column
+	want := map[string]string{
+		"id":   "items_pkey/1up",
+		"a":    "items_a/1,items_b_a/2u",
+		"b":    "items_b_a/1u",
+		"c":    "items_b_a/3ui",
+		"note": "",
+	}
+	if len(columns) != len(want) {
+		t.Fatalf("got %d columns, want %d", len(columns), len(want))
+	}
+	for _, col := range columns {
+		var got []string
+		for _, idx := range col["indexes"].([]map[string]interface{}) {
+			s := fmt.Sprintf("%s/%d", idx["index"], idx["position"])
+			if idx["unique"] == true {
+				s += "u"
+			}
+			if idx["primary_key"] == true {
+				s += "p"
+			}
+			if idx["included"] == true {
+				s += "i"
+			}
+			got = append(got, s)
+		}
+		name := col["column"].(string)
+		if strings.Join(got, ",") != want[name] {
+			t.Errorf("%s: indexes = %v, want %s", name, got, want[name])
+		}
+		if col["indexed"] != (want[name] != "") {
+			t.Errorf("%s: indexed = %v", name, col["indexed"])
+		}
+	}
+}
+
+func TestSuggestPaginationKeys(t *testing.T) {
+	db := testDB(t)
+	schema := testSchema(t, db,
+		`CREATE TABLE events (
+			id bigserial PRIMARY KEY,
+			code text NOT NULL UNIQUE,
+			email text UNIQUE,
+			created_at timestamptz,
+			seq int GENERATED ALWAYS AS IDENTITY,
+			category text
+		)`,
+		"CREATE INDEX events_created ON events (created_at)",
+		"CREATE INDEX events_seq ON events (seq)",
+		"CREATE INDEX events_category ON events (category)",
+		"CREATE INDEX events_lower_code ON events (lower(code))",
+		"CREATE UNIQUE INDEX events_partial ON events (category) WHERE category IS NOT NULL",
+		"CREATE TABLE logs (at date, message text)",
+		"CREATE INDEX logs_at ON logs (at)",
+		"CREATE TABLE notes (body text)",
+	)
+
+	// candidates renders each suggestion as kind:order_by
+	candidates := func(table string) []string {
+		t.Helper()
+		suggestions, err := SuggestPaginationKeys(db, schema, table)
+		if err != nil {
+			t.Fatalf("SuggestPaginationKeys(%s): %v", table, err)
+		}
+		var out []string
+		for _, s := range suggestions {
+			out = append(out, s["kind"].(string)+":"+strings.Join(s["order_by"].([]string), ","))
+		}
+		return out
+	}
+
+	tests := []struct {
+		table string
+		want  string
+	}{
+		// Expression, partial and non-monotonic indexes are never suggested
+		{"events", "primary_key:id unique:code unique_nullable:email monotonic:created_at,id monotonic:seq,id"},
+		// Without a primary key there is no tiebreaker to append
+		{"logs", "monotonic:at"},
+		{"notes", ""},
+	}
+	for _, tt := range tests {
+		if got := strings.Join(candidates(tt.table), " "); got != tt.want {
+			t.Errorf("%s: candidates = %q, want %q", tt.table, got, tt.want)
+		}
+	}
+}
+
+func TestSchemaNameIsQuoted(t *testing.T) {
+	db := testDB(t)
+	victim := testSchema(t, db, "CREATE TABLE kept (id int)")
+	// A real schema whose name would break out of an unquoted SET search_path
+	odd := `odd"; DROP SCHEMA ` + victim + ` CASCADE; --`
+	mustExec(t, db, "CREATE SCHEMA "+pq.QuoteIdentifier(odd))
+	t.Cleanup(func() { db.Exec("DROP SCHEMA " + pq.QuoteIdentifier(odd) + " CASCADE") })
+	mustExec(t, db, "CREATE TABLE "+pq.QuoteIdentifier(odd)+".items (id int)")
+	mustExec(t, db, "INSERT INTO "+pq.QuoteIdentifier(odd)+".items VALUES (1)")
+
+	sess := testSession(t, db)
+	streams := NewStreamRegistry(db, time.Minute)
+	t.Cleanup(streams.CloseAll)
+	ctx := context.Background()
+	injected := "public; DROP SCHEMA " + victim + " CASCADE"
+
+	tests := []struct {
+		name string
+		run  func(schema string) error
+	}{
+		{"ExecuteQueryWithOptions", func(schema string) error {
+			_, err := ExecuteQueryWithOptions(ctx, db, schema, "SELECT * FROM items", nil, QueryOptions{NoCache: true})
+			return err
+		}},
+		{"ExecuteQueryWithOptions in a session", func(schema string) error {
+			_, err := ExecuteQueryWithOptions(ctx, db, schema, "SELECT * FROM items", nil, QueryOptions{Session: sess})
+			return err
+		}},
+		{"ExecuteQueryWithProgress", func(schema string) error {
+			_, err := ExecuteQueryWithProgress(ctx, db, schema, "SELECT * FROM items", nil, 10, nil)
+			return err
+		}},
+		{"ExplainQuery", func(schema string) error {
+			_, err := ExplainQuery(ctx, db, schema, "SELECT * FROM items", false)
+			return err
+		}},
+		{"PrepareStatement", func(schema string) error {
+			_, err := PrepareStatement(ctx, sess, schema, "quoted", "SELECT * FROM items")
+			if err == nil {
+				err = DeallocateStatement(ctx, sess, "quoted")
+			}
+			return err
+		}},
+		{"MaterializeQuery", func(schema string) error {
+			_, err := MaterializeQuery(ctx, sess, schema, "copy_"+fmt.Sprint(time.Now().UnixNano()), "SELECT * FROM items", nil, QueryOptions{})
+			return err
+		}},
+		{"OpenCursor", func(schema string) error {
+			id, err := streams.OpenCursor(ctx, "test", schema, "SELECT * FROM items", nil, QueryOptions{})
+			if err == nil {
+				err = streams.CloseCursor("test", id)
+			}
+			return err
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The odd name resolves to its own schema
+			if err := tt.run(odd); err != nil {
+				t.Errorf("query in %q: %v", odd, err)
+			}
+			// An injected statement is part of the schema name, which does not exist
+			if err := tt.run(injected); err == nil {
+				t.Error("query resolved items in a schema that does not exist")
+			}
+			var exists bool
+			if err := db.QueryRow("SELECT to_regclass($1) IS NOT NULL", pq.QuoteIdentifier(victim)+".kept").Scan(&exists); err != nil {
+				t.Fatal(err)
+			}
+			if !exists {
+				t.Fatal("schema name was executed as SQL")
+			}
+		})
+	}
+}
+
+func TestNullsAcrossQueryPaths(t *testing.T) {
+	db := testDB(t)
+	schema := testSchema(t, db,
+		"CREATE TABLE notes (id int, body text, score int)",
+		"INSERT INTO notes VALUES (1, NULL, NULL)",
+	)
+	sess := testSession(t, db)
+	streams := NewStreamRegistry(db, time.Minute)
+	t.Cleanup(streams.CloseAll)
+	ctx := context.Background()
+	const query = "SELECT body, score FROM notes"
+
+	rowsOf := func(result map[string]interface{}, err error) ([]map[string]interface{}, error) {
+		if err != nil {
+			return nil, err
+		}
+		return result["rows"].([]map[string]interface{}), nil
+	}
+	tests := []struct {
+		name string
+		run  func() ([]map[string]interface{}, error)
+	}{
+		{"ExecuteQuery", func() ([]map[string]interface{}, error) {
+			return rowsOf(ExecuteQuery(db, schema, query, nil))
+		}},
+		{"ExecuteQueryWithOptions", func() ([]map[string]interface{}, error) {
+			return rowsOf(ExecuteQueryWithOptions(ctx, db, schema, query, nil, QueryOptions{NoCache: true}))
+		}},
+		{"ExecuteQueryWithProgress", func() ([]map[string]interface{}, error) {
+			return rowsOf(ExecuteQueryWithProgress(ctx, db, schema, query, nil, 10, nil))
+		}},
+		{"SampleRows", func() ([]map[string]interface{}, error) {
+			result, err := SampleRows(db, schema, "notes", 5, 0, "", "", nil)
+			rows, err := rowsOf(result, err)
+			for _, row := range rows {
+				delete(row, "id")
+			}
+			return rows, err
+		}},
+		{"ExecutePrepared", func() ([]map[string]interface{}, error) {
+			if _, err := PrepareStatement(ctx, sess, schema, "nulls", query); err != nil {
+				return nil, err
+			}
+			return rowsOf(ExecutePrepared(ctx, sess, schema, "nulls", nil, QueryOptions{}))
+		}},
+		{"FetchCursor", func() ([]map[string]interface{}, error) {
+			id, err := streams.OpenCursor(ctx, "test", schema, query, nil, QueryOptions{})
+			if err != nil {
+				return nil, err
+			}
+			page, err := streams.FetchCursor(ctx, "test", id, 10)
+			if err != nil {
+				return nil, err
+			}
+			return page.Rows, nil
+		}},
+		{"stream", func() ([]map[string]interface{}, error) {
+			id, err := streams.Open(ctx, "test", schema, query, nil, 10)
+			if err != nil {
+				return nil, err
+			}
+			batch, err := streams.Next(ctx, "test", id)
+			if err != nil {
+				return nil, err
+			}
+			return batch.Rows, nil
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rows, err := tt.run()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(rows) != 1 {
+				t.Fatalf("got %d rows, want 1", len(rows))
+			}
+			data, err := json.Marshal(rows[0])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := `{"body":null,"score":null}`; string(data) != want {
+				t.Errorf("row = %s, want %s", data, want)
+			}
+		})
+	}
+}
+
+func TestCheckWhereCondition(t *testing.T) {
+	tests := []struct {
+		where string
+		ok    bool
+	}{
+		{"status = $1", true},
+		{"name = 'it''s (fine)' AND id IN (1, 2)", true},
+		{`"Weird)Name" > $2`, true},
+		{"note = 'a -- b /* c ;'", true},
+		{"true; DROP TABLE t", false},
+		{"true --", false},
+		{"true /* hidden", false},
+		{"false) UNION ALL SELECT * FROM other WHERE (true", false},
+		{"(true", false},
+		{"name = 'open", false},
+		{`name = E'\'' OR true`, false},
+		{"name = $$x$$", false},
+	}
+	for _, tt := range tests {
+		if err := checkWhereCondition(tt.where); (err == nil) != tt.ok {
+			t.Errorf("checkWhereCondition(%q) = %v, want ok %v", tt.where, err, tt.ok)
+		}
+	}
+}
+
+func TestSampleRowsWhere(t *testing.T) {
+	db := testDB(t)
+	schema := testSchema(t, db,
+		"CREATE TABLE items (id int, status text)",
+		"INSERT INTO items SELECT n, CASE WHEN n % 2 = 0 THEN 'open' ELSE 'closed' END FROM generate_series(1, 10) AS n",
+		"CREATE TABLE other (id int, status text)",
+		"INSERT INTO other VALUES (100, 'secret')",
+	)
+
+	result, err := SampleRows(db, schema, "items", 10, 0, "id", "status = $1 AND id > $2", []interface{}{"open", float64(4)})
+	if err != nil {
+		t.Fatalf("SampleRows: %v", err)
+	}
+	rows := result["rows"].([]map[string]interface{})
+	if len(rows) != 3 || rows[0]["id"] != int64(6) {
+		t.Errorf("rows = %v, want ids 6, 8 and 10", rows)
+	}
+
+	escapes := []string{
+		"true --",
+		"true /*",
+		"false UNION ALL SELECT * FROM other",
+		"false) UNION ALL SELECT * FROM other WHERE (true",
+	}
+	for _, where := range escapes {
+		result, err := SampleRows(db, schema, "items", 2, 0, "", where, nil)
+		if err == nil {
+			t.Errorf("where %q returned %v", where, result["rows"])
+		}
+	}
+
+	// The limit is capped by MAX_ROWS
+	setTestMaxRows(t, 3)
+	result, err = SampleRows(db, schema, "items", 100, 0, "id", "true", nil)
+	if err != nil {
+		t.Fatalf("SampleRows: %v", err)
+	}
+	if rows := result["rows"].([]map[string]interface{}); len(rows) != 3 {
+		t.Errorf("got %d rows, want the MAX_ROWS cap of 3", len(rows))
+	}
+}
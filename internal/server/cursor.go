@@ -0,0 +1,106 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// defaultFetchSize is the number of rows fetched from a cursor per round-trip
+const defaultFetchSize = 1000
+
+var cursorSeq uint64
+
+// nextCursorName returns a cursor name that is unique within the process
+func nextCursorName() string {
+	return fmt.Sprintf("mcp_cursor_%d", atomic.AddUint64(&cursorSeq, 1))
+}
+
+// ProgressFunc is called after each batch with the number of rows fetched so far
+type ProgressFunc func(rowsFetched int)
+
+// ExecuteQueryWithProgress runs a read-only query through a server-side cursor,
+// fetching fetchSize rows at a time and calling progress after every batch.
+// Like executeQuery it stops at MAX_ROWS, setting truncated when more rows
+// remained. Cancelling ctx stops the scan between or during fetches.
+func ExecuteQueryWithProgress(ctx context.Context, db *sql.DB, schema, query string, args []interface{}, fetchSize int, progress ProgressFunc) (map[string]interface{}, error) {
+	if fetchSize <= 0 {
+		fetchSize = defaultFetchSize
+	}
+
+	tx, err := db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, fmt.Sprintf("SET LOCAL search_path TO %s", pq.QuoteIdentifier(schema))); err != nil {
+		return nil, fmt.Errorf("failed to set schema: %w", err)
+	}
+	relations, err := checkQueryTables(ctx, tx, query, args, true)
+	if err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+	defer recordQuery(query, start)
+
+	cursor := pq.QuoteIdentifier(nextCursorName())
+	if _, err := tx.ExecContext(ctx, fmt.Sprintf("DECLARE %s NO SCROLL CURSOR FOR %s", cursor, query), args...); err != nil {
+		return nil, fmt.Errorf("query error: %w", err)
+	}
+
+	limit := MaxRows(0)
+	mask := newQueryMask(relations)
+	var cols []string
+	results := []map[string]interface{}{}
+	truncated := false
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		// Near the cap only one row beyond it is fetched, to tell whether any remain
+		n := fetchSize
+		if limit > 0 && limit-len(results) < n {
+			n = limit - len(results) + 1
+		}
+		rows, err := tx.QueryContext(ctx, fmt.Sprintf("FETCH FORWARD %d FROM %s", n, cursor))
+		if err != nil {
+			return nil, fmt.Errorf("fetch error: %w", err)
+		}
+		batchCols, batch, err := scanRows(rows, QueryOptions{mask: mask})
+		rows.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		cols = batchCols
+		if limit > 0 && len(results)+len(batch) > limit {
+			batch = batch[:limit-len(results)]
+			truncated = true
+		}
+		results = append(results, batch...)
+		if progress != nil {
+			progress(len(results))
+		}
+		if truncated || len(batch) < n {
+			break
+		}
+	}
+
+	result := map[string]interface{}{
+		"columns":   cols,
+		"rows":      results,
+		"row_count": len(results),
+		"truncated": truncated,
+	}
+	if masked := mask.strategies(cols); masked != nil {
+		result["masked_columns"] = masked
+	}
+	return result, nil
+}
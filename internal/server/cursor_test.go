@@ -0,0 +1,61 @@
+package server
+
+import (
+	"context"
+	"testing"
+)
+
+// setTestMaxRows installs a row cap for the duration of a test
+func setTestMaxRows(t *testing.T, n int) {
+	t.Helper()
+	SetMaxRows(n)
+	t.Cleanup(func() { SetMaxRows(defaultMaxRows) })
+}
+
+func TestExecuteQueryWithProgress(t *testing.T) {
+	db := testDB(t)
+	schema := testSchema(t, db)
+	ctx := context.Background()
+
+	tests := []struct {
+		name      string
+		maxRows   int
+		series    int
+		wantRows  int
+		truncated bool
+		progress  []int
+	}{
+		{"below the cap", 100, 25, 25, false, []int{10, 20, 25}},
+		{"exact multiple of the fetch size", 100, 30, 30, false, []int{10, 20, 30, 30}},
+		{"truncated mid-batch", 15, 25, 15, true, []int{10, 15}},
+		{"cap on a batch boundary", 20, 25, 20, true, []int{10, 20, 20}},
+		{"result exactly at the cap", 20, 20, 20, false, []int{10, 20, 20}},
+		{"no cap", 0, 25, 25, false, []int{10, 20, 25}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setTestMaxRows(t, tt.maxRows)
+			var progress []int
+			result, err := ExecuteQueryWithProgress(ctx, db, schema, "SELECT generate_series(1, $1::int) AS n", []interface{}{tt.series}, 10, func(rowsFetched int) {
+				progress = append(progress, rowsFetched)
+			})
+			if err != nil {
+				t.Fatalf("ExecuteQueryWithProgress: %v", err)
+			}
+			if result["row_count"] != tt.wantRows || result["truncated"] != tt.truncated {
+				t.Errorf("row_count = %v, truncated = %v, want %d, %v", result["row_count"], result["truncated"], tt.wantRows, tt.truncated)
+			}
+			if len(result["rows"].([]map[string]interface{})) != tt.wantRows {
+				t.Errorf("got %d rows, want %d", len(result["rows"].([]map[string]interface{})), tt.wantRows)
+			}
+			if len(progress) != len(tt.progress) {
+				t.Fatalf("progress = %v, want %v", progress, tt.progress)
+			}
+			for i := range progress {
+				if progress[i] != tt.progress[i] {
+					t.Fatalf("progress = %v, want %v", progress, tt.progress)
+				}
+			}
+		})
+	}
+}
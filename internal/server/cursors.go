@@ -0,0 +1,124 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// maxSessionCursors caps the cursors one session may hold open, since each
+// holds a pooled connection in an open transaction
+const maxSessionCursors = 8
+
+// ErrCursorNotFound is returned for unknown, exhausted or expired cursor IDs,
+// and for cursors opened by another session
+var ErrCursorNotFound = errors.New("cursor not found or expired")
+
+// ErrTooManyCursors is returned when a session already holds maxSessionCursors cursors
+var ErrTooManyCursors = fmt.Errorf("too many open cursors; close one with closeCursor first (limit %d per session)", maxSessionCursors)
+
+// CursorPage is one page of rows fetched from an open cursor
+type CursorPage struct {
+	CursorID    string                   `json:"cursor_id"`
+	Columns     []string                 `json:"columns"`
+	Rows        []map[string]interface{} `json:"rows"`
+	RowsFetched int                      `json:"rows_fetched"`
+	Done        bool                     `json:"done"`
+}
+
+// OpenCursor declares a server-side cursor for a read-only query on behalf of
+// the session owner and returns its ID. Unlike a stream, the cursor is read a
+// page at a time with FetchCursor. Only ArgTypes, Role, TimeFormat and
+// FormattedMoney of opts apply.
+func (r *StreamRegistry) OpenCursor(ctx context.Context, owner, schema, query string, args []interface{}, opts QueryOptions) (string, error) {
+	args, err := coerceArgs(args, opts.ArgTypes)
+	if err != nil {
+		return "", err
+	}
+
+	c, err := r.declare(ctx, opts.Role, schema, query, args)
+	if err != nil {
+		return "", err
+	}
+	c.paged = true
+	c.owner = owner
+	c.opts.TimeFormat = opts.TimeFormat
+	c.opts.FormattedMoney = opts.FormattedMoney
+	return r.add(c)
+}
+
+// FetchCursor returns the next count rows of a cursor the owner opened, at most
+// MAX_ROWS at a time. The cursor is closed once a short page signals the end.
+func (r *StreamRegistry) FetchCursor(ctx context.Context, owner, id string, count int) (*CursorPage, error) {
+	c := r.lookup(id, owner, true)
+	if c == nil {
+		return nil, ErrCursorNotFound
+	}
+	if count <= 0 {
+		count = defaultFetchSize
+	}
+	count = MaxRows(count)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.lastUsed = time.Now()
+
+	rows, err := c.tx.QueryContext(ctx, fmt.Sprintf("FETCH FORWARD %d FROM %s", count, c.cursor))
+	if err != nil {
+		r.closeStream(id)
+		return nil, fmt.Errorf("fetch error: %w", err)
+	}
+	cols, page, err := scanRows(rows, c.opts)
+	rows.Close()
+	if err != nil {
+		r.closeStream(id)
+		return nil, err
+	}
+	if page == nil {
+		page = []map[string]interface{}{}
+	}
+
+	c.rowsSent += len(page)
+	done := len(page) < count
+	if done {
+		r.closeStream(id)
+	}
+
+	return &CursorPage{
+		CursorID:    id,
+		Columns:     cols,
+		Rows:        page,
+		RowsFetched: c.rowsSent,
+		Done:        done,
+	}, nil
+}
+
+// CloseCursor closes a cursor the owner opened and releases its connection
+func (r *StreamRegistry) CloseCursor(owner, id string) error {
+	if r.lookup(id, owner, true) == nil {
+		return ErrCursorNotFound
+	}
+	err := r.closeStream(id)
+	if errors.Is(err, ErrStreamNotFound) {
+		return ErrCursorNotFound
+	}
+	return err
+}
+
+// CloseSession closes every stream and cursor opened by the session owner
+func (r *StreamRegistry) CloseSession(owner string) {
+	r.mu.Lock()
+	var closed []*resultStream
+	for id, c := range r.streams {
+		if c.owner == owner {
+			closed = append(closed, c)
+			delete(r.streams, id)
+		}
+	}
+	r.mu.Unlock()
+
+	for _, c := range closed {
+		c.tx.Rollback()
+	}
+}
@@ -0,0 +1,128 @@
+package server
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+	"sync/atomic"
+
+	"github.com/lib/pq"
+)
+
+// verboseErrors disables SanitizeError, returning database errors in full
+var verboseErrors atomic.Bool
+
+// SetVerboseErrors controls whether database errors reach clients in full,
+// for debugging, instead of as sanitized messages
+func SetVerboseErrors(verbose bool) {
+	verboseErrors.Store(verbose)
+}
+
+// friendlyErrors holds client-facing messages for common SQLSTATE codes; other
+// codes are described by their condition name
+var friendlyErrors = map[pq.ErrorCode]string{
+	"0A000": "feature not supported",
+	"22001": "value too long for the column type",
+	"22003": "numeric value out of range",
+	"22012": "division by zero",
+	"22P02": "invalid input syntax for the value's type",
+	"23502": "null value violates a not-null constraint",
+	"23503": "insert or update violates a foreign key constraint",
+	"23505": "duplicate key violates a unique constraint",
+	"23514": "row violates a check constraint",
+	"25006": "cannot modify data in a read-only transaction",
+	"28000": "database authentication failed",
+	"28P01": "database authentication failed",
+	"3D000": "database does not exist",
+	"3F000": "schema does not exist",
+	"40001": "serialization failure; retry the transaction",
+	"40P01": "deadlock detected; retry the transaction",
+	"42501": "permission denied",
+	"42601": "syntax error",
+	"42703": "column does not exist",
+	"42804": "data type mismatch",
+	"42883": "function or operator does not exist for the given argument types",
+	"42P01": "relation does not exist",
+	"42P07": "relation already exists",
+	"53300": "too many database connections",
+	"57014": "query cancelled, for example by the statement timeout",
+}
+
+// SanitizeError replaces Postgres and connection errors with messages that do
+// not reveal schema details, server addresses or credentials, logging the full
+// error server-side. Other errors, which the server produced itself, are
+// returned unchanged, as are all errors while verbose errors are enabled.
+func SanitizeError(err error) error {
+	if err == nil || verboseErrors.Load() {
+		return err
+	}
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		slog.Warn("Database error", "err", err, "code", string(pqErr.Code), "detail", pqErr.Detail)
+		return errors.New(describePqError(pqErr))
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) || errors.Is(err, driver.ErrBadConn) {
+		slog.Warn("Database connection error", "err", err)
+		return errors.New("database connection error")
+	}
+	return err
+}
+
+// describePqError renders the friendly message of a Postgres error with its
+// SQLSTATE code, plus the position of a syntax error in the query
+func describePqError(pqErr *pq.Error) string {
+	msg, ok := friendlyErrors[pqErr.Code]
+	if !ok {
+		name := pqErr.Code.Name()
+		if name == "" {
+			name = pqErr.Code.Class().Name()
+		}
+		msg = strings.ReplaceAll(name, "_", " ")
+	}
+	if pqErr.Code == "42601" && pqErr.Position != "" {
+		msg += " at position " + pqErr.Position
+	}
+	return fmt.Sprintf("%s (SQLSTATE %s)", msg, pqErr.Code)
+}
+
+// queryErrorStatus maps a query error to an HTTP status: 403 for permission
+// errors and tables hidden by the access rules, 404 for missing relations and
+// schemas, 409 for serialization failures and deadlocks worth retrying, 500 for
+// connection, resource and internal server errors, and 400 for errors in the
+// query itself such as syntax, data and constraint violations.
+func queryErrorStatus(err error) int {
+	if errors.Is(err, ErrRoleNotAllowed) || errors.Is(err, ErrAccessDenied) {
+		return http.StatusForbidden
+	}
+	if errors.Is(err, ErrTableNotFound) {
+		return http.StatusNotFound
+	}
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		switch pqErr.Code {
+		case "42501", "25006":
+			return http.StatusForbidden
+		case "42P01", "3F000":
+			return http.StatusNotFound
+		}
+		switch pqErr.Code.Class() {
+		case "40":
+			return http.StatusConflict
+		case "08", "28", "3D", "53", "55", "57", "58", "F0", "XX":
+			return http.StatusInternalServerError
+		}
+		return http.StatusBadRequest
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) || errors.Is(err, driver.ErrBadConn) {
+		return http.StatusInternalServerError
+	}
+	return http.StatusBadRequest
+}
@@ -0,0 +1,76 @@
+package server
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/lib/pq"
+)
+
+func TestSanitizeError(t *testing.T) {
+	t.Cleanup(func() { SetVerboseErrors(false) })
+
+	missing := &pq.Error{Code: "42P01", Message: `relation "billing.payment_tokens" does not exist`}
+	syntax := &pq.Error{Code: "42601", Message: `syntax error at or near "FORM"`, Position: "10"}
+	unlisted := &pq.Error{Code: "22007", Message: `invalid datetime format: "2024-13-01"`}
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{"friendly message", fmt.Errorf("query error: %w", missing), "relation does not exist (SQLSTATE 42P01)"},
+		{"syntax error position", syntax, "syntax error at position 10 (SQLSTATE 42601)"},
+		{"condition name for other codes", unlisted, "invalid datetime format (SQLSTATE 22007)"},
+		{"connection error", fmt.Errorf("ping: %w", &netError{"dial tcp 10.0.0.5:5432: connection refused"}), "database connection error"},
+		{"server errors pass through", ErrAccessDenied, ErrAccessDenied.Error()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := SanitizeError(tt.err).Error(); got != tt.want {
+				t.Errorf("SanitizeError = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	if SanitizeError(nil) != nil {
+		t.Error("SanitizeError(nil) != nil")
+	}
+
+	SetVerboseErrors(true)
+	if got := SanitizeError(missing).Error(); !strings.Contains(got, "payment_tokens") {
+		t.Errorf("verbose SanitizeError = %q, want the full message", got)
+	}
+}
+
+// netError is a minimal net.Error
+type netError struct{ msg string }
+
+func (e *netError) Error() string   { return e.msg }
+func (e *netError) Timeout() bool   { return false }
+func (e *netError) Temporary() bool { return false }
+
+func TestQueryErrorStatus(t *testing.T) {
+	tests := []struct {
+		err  error
+		want int
+	}{
+		{&pq.Error{Code: "42601"}, http.StatusBadRequest},
+		{&pq.Error{Code: "23505"}, http.StatusBadRequest},
+		{&pq.Error{Code: "42501"}, http.StatusForbidden},
+		{&pq.Error{Code: "42P01"}, http.StatusNotFound},
+		{&pq.Error{Code: "40001"}, http.StatusConflict},
+		{&pq.Error{Code: "53300"}, http.StatusInternalServerError},
+		{fmt.Errorf("%w: public.secret", ErrAccessDenied), http.StatusForbidden},
+		{fmt.Errorf("query error: %w", driver.ErrBadConn), http.StatusInternalServerError},
+		{errors.New("invalid delimiter"), http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		if got := queryErrorStatus(tt.err); got != tt.want {
+			t.Errorf("queryErrorStatus(%v) = %d, want %d", tt.err, got, tt.want)
+		}
+	}
+}
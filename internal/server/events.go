@@ -0,0 +1,140 @@
+package server
+
+// Event payload types, carried in the payload's "type" field so clients can
+// decode the SSE stream as a discriminated union
+const (
+	EventTypeQueryResult  = "query_result"
+	EventTypeProgress     = "progress"
+	EventTypeNotification = "notification"
+	EventTypeLifecycle    = "lifecycle"
+	EventTypePgNotify     = "pg_notify"
+)
+
+// Lifecycle states reported by LifecycleEvent
+const (
+	LifecycleStreamOpened = "stream_opened"
+	LifecycleStreamClosed = "stream_closed"
+)
+
+// EventPayload is implemented by every typed event payload
+type EventPayload interface {
+	EventType() string
+}
+
+// Event represents a server-sent event
+type Event struct {
+	Name string
+	Data EventPayload
+}
+
+// NewEvent creates a new event with the given name and payload
+func NewEvent(name string, data EventPayload) Event {
+	return Event{
+		Name: name,
+		Data: data,
+	}
+}
+
+// QueryResultEvent carries the rows of a query result, or one batch of a
+// flow-controlled stream when StreamID is set
+type QueryResultEvent struct {
+	Type      string                   `json:"type"`
+	Columns   []string                 `json:"columns"`
+	Rows      []map[string]interface{} `json:"rows"`
+	RowCount  int                      `json:"row_count"`
+	Truncated bool                     `json:"truncated,omitempty"`
+	StreamID  string                   `json:"stream_id,omitempty"`
+	Seq       int                      `json:"seq,omitempty"`
+	RowsSent  int                      `json:"rows_sent,omitempty"`
+	Done      bool                     `json:"done,omitempty"`
+}
+
+// EventType implements EventPayload
+func (QueryResultEvent) EventType() string { return EventTypeQueryResult }
+
+// ProgressEvent reports how many rows a long-running query has fetched so far
+type ProgressEvent struct {
+	Type        string `json:"type"`
+	RowsFetched int    `json:"rows_fetched"`
+}
+
+// EventType implements EventPayload
+func (ProgressEvent) EventType() string { return EventTypeProgress }
+
+// NotificationEvent carries a free-form message sent by a client or tool
+type NotificationEvent struct {
+	Type    string `json:"type"`
+	Message string `json:"message"`
+}
+
+// EventType implements EventPayload
+func (NotificationEvent) EventType() string { return EventTypeNotification }
+
+// LifecycleEvent reports a state change of the server or one of its resources
+type LifecycleEvent struct {
+	Type   string `json:"type"`
+	State  string `json:"state"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// EventType implements EventPayload
+func (LifecycleEvent) EventType() string { return EventTypeLifecycle }
+
+// PgNotifyEvent carries a Postgres NOTIFY message received on a subscribed channel
+type PgNotifyEvent struct {
+	Type    string `json:"type"`
+	Channel string `json:"channel"`
+	Payload string `json:"payload"`
+	PID     int    `json:"pid"`
+}
+
+// EventType implements EventPayload
+func (PgNotifyEvent) EventType() string { return EventTypePgNotify }
+
+// NewQueryResultEvent creates a query result event from a result map as returned by ExecuteQuery
+func NewQueryResultEvent(name string, result map[string]interface{}) Event {
+	cols, _ := result["columns"].([]string)
+	rows, _ := result["rows"].([]map[string]interface{})
+	truncated, _ := result["truncated"].(bool)
+	return NewEvent(name, QueryResultEvent{
+		Type:      EventTypeQueryResult,
+		Columns:   cols,
+		Rows:      rows,
+		RowCount:  len(rows),
+		Truncated: truncated,
+	})
+}
+
+// NewStreamBatchEvent creates a query result event for one batch of a stream
+func NewStreamBatchEvent(name string, batch *StreamBatch) Event {
+	return NewEvent(name, QueryResultEvent{
+		Type:     EventTypeQueryResult,
+		Columns:  batch.Columns,
+		Rows:     batch.Rows,
+		RowCount: len(batch.Rows),
+		StreamID: batch.StreamID,
+		Seq:      batch.Seq,
+		RowsSent: batch.RowsSent,
+		Done:     batch.Done,
+	})
+}
+
+// NewProgressEvent creates a progress event
+func NewProgressEvent(name string, rowsFetched int) Event {
+	return NewEvent(name, ProgressEvent{Type: EventTypeProgress, RowsFetched: rowsFetched})
+}
+
+// NewNotificationEvent creates a notification event
+func NewNotificationEvent(name, message string) Event {
+	return NewEvent(name, NotificationEvent{Type: EventTypeNotification, Message: message})
+}
+
+// NewLifecycleEvent creates a lifecycle event
+func NewLifecycleEvent(name, state, detail string) Event {
+	return NewEvent(name, LifecycleEvent{Type: EventTypeLifecycle, State: state, Detail: detail})
+}
+
+// NewPgNotifyEvent creates an event for a NOTIFY message sent by backend pid
+func NewPgNotifyEvent(name, channel, payload string, pid int) Event {
+	return NewEvent(name, PgNotifyEvent{Type: EventTypePgNotify, Channel: channel, Payload: payload, PID: pid})
+}
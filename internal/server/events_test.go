@@ -0,0 +1,89 @@
+package server
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestEventSerialization(t *testing.T) {
+	tests := []struct {
+		name  string
+		event Event
+		want  string
+	}{
+		{
+			"query result",
+			NewQueryResultEvent("orders", map[string]interface{}{
+				"columns":   []string{"id"},
+				"rows":      []map[string]interface{}{{"id": 1}, {"id": 2}},
+				"truncated": true,
+			}),
+			`{"type": "query_result", "columns": ["id"], "rows": [{"id": 1}, {"id": 2}], "row_count": 2, "truncated": true}`,
+		},
+		{
+			"empty query result",
+			NewQueryResultEvent("orders", map[string]interface{}{}),
+			`{"type": "query_result", "columns": null, "rows": null, "row_count": 0}`,
+		},
+		{
+			"stream batch",
+			NewStreamBatchEvent("orders", &StreamBatch{
+				StreamID: "abc",
+				Columns:  []string{"id"},
+				Rows:     []map[string]interface{}{{"id": 3}},
+				Seq:      2,
+				RowsSent: 11,
+				Done:     true,
+			}),
+			`{"type": "query_result", "columns": ["id"], "rows": [{"id": 3}], "row_count": 1, "stream_id": "abc", "seq": 2, "rows_sent": 11, "done": true}`,
+		},
+		{
+			"progress",
+			NewProgressEvent("query_progress", 500),
+			`{"type": "progress", "rows_fetched": 500}`,
+		},
+		{
+			"notification",
+			NewNotificationEvent("note", "hello"),
+			`{"type": "notification", "message": "hello"}`,
+		},
+		{
+			"lifecycle",
+			NewLifecycleEvent("stream", LifecycleStreamOpened, "abc"),
+			`{"type": "lifecycle", "state": "stream_opened", "detail": "abc"}`,
+		},
+		{
+			"lifecycle without detail",
+			NewLifecycleEvent("stream", LifecycleStreamClosed, ""),
+			`{"type": "lifecycle", "state": "stream_closed"}`,
+		},
+		{
+			"pg notify",
+			NewPgNotifyEvent("jobs", "jobs", `{"id": 7}`, 4242),
+			`{"type": "pg_notify", "channel": "jobs", "payload": "{\"id\": 7}", "pid": 4242}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := json.Marshal(tt.event.Data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got, want map[string]interface{}
+			if err := json.Unmarshal(data, &got); err != nil {
+				t.Fatal(err)
+			}
+			if err := json.Unmarshal([]byte(tt.want), &want); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("payload = %s, want %s", data, tt.want)
+			}
+			// The discriminator always matches the payload's Go type
+			if got["type"] != tt.event.Data.EventType() {
+				t.Errorf("type = %v, EventType() = %s", got["type"], tt.event.Data.EventType())
+			}
+		})
+	}
+}
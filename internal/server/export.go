@@ -0,0 +1,87 @@
+package server
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// ExportOptions controls how query results are written as delimited text
+type ExportOptions struct {
+	// Delimiter separates fields, ',' for CSV or '\t' for TSV
+	Delimiter rune
+	// NullString is written, unquoted, for SQL NULLs (e.g. \N or NULL)
+	NullString string
+}
+
+// ParseDelimiter accepts comma/tab by name or as the literal character
+func ParseDelimiter(name string) (rune, error) {
+	switch strings.ToLower(name) {
+	case "", "comma", ",", "csv":
+		return ',', nil
+	case "tab", "\t", `\t`, "tsv":
+		return '\t', nil
+	}
+	return 0, fmt.Errorf("unsupported delimiter %q (use comma or tab)", name)
+}
+
+// WriteDelimited writes a header row and the rows of a query result as CSV/TSV.
+// SQL NULLs are written as opts.NullString while empty strings are always
+// quoted, so the two stay distinguishable even with the default empty
+// NullString, matching how COPY ... CSV reads them back.
+func WriteDelimited(w io.Writer, columns []string, rows []map[string]interface{}, opts ExportOptions) error {
+	if opts.Delimiter == 0 {
+		opts.Delimiter = ','
+	}
+	bw := bufio.NewWriter(w)
+
+	header := make([]string, len(columns))
+	for i, col := range columns {
+		header[i] = quoteField(col, opts)
+	}
+	bw.WriteString(strings.Join(header, string(opts.Delimiter)) + "\n")
+
+	fields := make([]string, len(columns))
+	for _, row := range rows {
+		for i, col := range columns {
+			val := row[col]
+			if val == nil {
+				fields[i] = opts.NullString
+				continue
+			}
+			fields[i] = quoteField(formatExportValue(val), opts)
+		}
+		bw.WriteString(strings.Join(fields, string(opts.Delimiter)) + "\n")
+	}
+
+	return bw.Flush()
+}
+
+// formatExportValue renders a converted result value as text
+func formatExportValue(val interface{}) string {
+	switch v := val.(type) {
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	case map[string]interface{}, []interface{}:
+		data, _ := json.Marshal(v)
+		return string(data)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// quoteField quotes a field that is empty, equals the NULL sentinel or contains
+// the delimiter, a quote or a line break
+func quoteField(field string, opts ExportOptions) string {
+	if field != "" && field != opts.NullString && !strings.ContainsRune(field, opts.Delimiter) && !strings.ContainsAny(field, "\"\r\n") {
+		return field
+	}
+	return `"` + strings.ReplaceAll(field, `"`, `""`) + `"`
+}
@@ -0,0 +1,111 @@
+package server
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseDelimiter(t *testing.T) {
+	tests := []struct {
+		name string
+		want rune
+	}{
+		{"", ','}, {"comma", ','}, {",", ','}, {"CSV", ','},
+		{"tab", '\t'}, {"\t", '\t'}, {`\t`, '\t'}, {"tsv", '\t'},
+	}
+	for _, tt := range tests {
+		if got, err := ParseDelimiter(tt.name); err != nil || got != tt.want {
+			t.Errorf("ParseDelimiter(%q) = %q, %v; want %q", tt.name, got, err, tt.want)
+		}
+	}
+	if _, err := ParseDelimiter(";"); err == nil {
+		t.Error("semicolon delimiter was accepted")
+	}
+}
+
+func TestWriteDelimited(t *testing.T) {
+	columns := []string{"id", "note"}
+	rows := []map[string]interface{}{
+		{"id": int64(1), "note": nil},
+		{"id": int64(2), "note": ""},
+		{"id": int64(3), "note": "plain"},
+		{"id": int64(4), "note": `say "hi", ok`},
+		{"id": int64(5), "note": "two\nlines"},
+		{"id": int64(6), "note": `\N`},
+		{"id": int64(7), "note": "a\tb"},
+	}
+
+	tests := []struct {
+		name string
+		opts ExportOptions
+		want string
+	}{
+		{
+			"csv with an empty null string",
+			ExportOptions{},
+			"id,note\n1,\n2,\"\"\n3,plain\n4,\"say \"\"hi\"\", ok\"\n5,\"two\nlines\"\n6,\\N\n7,a\tb\n",
+		},
+		{
+			"csv with a null sentinel",
+			ExportOptions{Delimiter: ',', NullString: `\N`},
+			"id,note\n1,\\N\n2,\"\"\n3,plain\n4,\"say \"\"hi\"\", ok\"\n5,\"two\nlines\"\n6,\"\\N\"\n7,a\tb\n",
+		},
+		{
+			"tsv",
+			ExportOptions{Delimiter: '\t', NullString: "NULL"},
+			"id\tnote\n1\tNULL\n2\t\"\"\n3\tplain\n4\t\"say \"\"hi\"\", ok\"\n5\t\"two\nlines\"\n6\t\\N\n7\t\"a\tb\"\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var b strings.Builder
+			if err := WriteDelimited(&b, columns, rows, tt.opts); err != nil {
+				t.Fatal(err)
+			}
+			if b.String() != tt.want {
+				t.Errorf("output:\n%q\nwant:\n%q", b.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatExportValue(t *testing.T) {
+	ts := time.Date(2024, 5, 1, 12, 30, 0, 500, time.UTC)
+	tests := []struct {
+		val  interface{}
+		want string
+	}{
+		{"text", "text"},
+		{[]byte("raw"), "raw"},
+		{int64(42), "42"},
+		{1.5, "1.5"},
+		{true, "true"},
+		{ts, "2024-05-01T12:30:00.0000005Z"},
+		{map[string]interface{}{"a": 1}, `{"a":1}`},
+		{[]interface{}{1, nil, "x"}, `[1,null,"x"]`},
+	}
+	for _, tt := range tests {
+		if got := formatExportValue(tt.val); got != tt.want {
+			t.Errorf("formatExportValue(%#v) = %q, want %q", tt.val, got, tt.want)
+		}
+	}
+}
+
+func TestExportDistinguishesNullFromEmpty(t *testing.T) {
+	db := testDB(t)
+	result, err := ExecuteQueryWithOptions(context.Background(), db, "public",
+		"SELECT * FROM (VALUES (1, NULL::text), (2, '')) AS v(id, note) ORDER BY id", nil, QueryOptions{NoCache: true})
+	if err != nil {
+		t.Fatalf("ExecuteQueryWithOptions: %v", err)
+	}
+
+	var b strings.Builder
+	if err := WriteDelimited(&b, result["columns"].([]string), result["rows"].([]map[string]interface{}), ExportOptions{NullString: `\N`}); err != nil {
+		t.Fatal(err)
+	}
+	if want := "id,note\n1,\\N\n2,\"\"\n"; b.String() != want {
+		t.Errorf("output = %q, want %q", b.String(), want)
+	}
+}
@@ -3,12 +3,23 @@ package server
 import (
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/lib/pq"
 )
 
+// writeJSONError replies with status and a {"error": msg} JSON body
+func writeJSONError(w http.ResponseWriter, status int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": msg})
+}
+
 func getSchemaParam(r *http.Request) string {
 	schema := r.URL.Query().Get("schema")
 	if schema == "" {
@@ -21,22 +32,31 @@ type QueryRequest struct {
 	Schema     string        `json:"schema"`
 	Query      string        `json:"query"`
 	Args       []interface{} `json:"args"`
+	// ArgTypes optionally hints each arg's Postgres type, e.g. jsonb or int[]
+	ArgTypes []string `json:"arg_types,omitempty"`
 	Broadcast  bool          `json:"broadcast,omitempty"`
 	EventName  string        `json:"event_name,omitempty"`
-}
-
-// Event represents a server-sent event
-type Event struct {
-	Name string
-	Data interface{}
-}
-
-// NewEvent creates a new event with the given name and data
-func NewEvent(name string, data interface{}) Event {
-	return Event{
-		Name: name,
-		Data: data,
-	}
+	Role       string        `json:"role,omitempty"`
+	// BinaryArtifacts returns large bytea values as /artifact/<id> links
+	BinaryArtifacts bool `json:"binary_artifacts,omitempty"`
+	// FormattedMoney returns money values with their locale-formatted text alongside the exact amount
+	FormattedMoney bool `json:"formatted_money,omitempty"`
+	// Summarize adds a summary of the result's shape and column statistics
+	Summarize bool `json:"summarize,omitempty"`
+	// Format selects the response encoding: json (default), csv or tsv
+	Format string `json:"format,omitempty"`
+	// Delimiter overrides the csv/tsv field separator: comma or tab
+	Delimiter string `json:"delimiter,omitempty"`
+	// NullString is written for SQL NULLs in csv/tsv output; empty strings are quoted
+	NullString string `json:"null_string,omitempty"`
+	// TimeoutMs overrides the default query timeout, clamped to MAX_QUERY_TIMEOUT
+	TimeoutMs int `json:"timeout_ms,omitempty"`
+	// MaxRows lowers the number of rows returned below MAX_ROWS
+	MaxRows int `json:"max_rows,omitempty"`
+	// TimeFormat renders date/time values as rfc3339, unix, unixmilli or a Go layout
+	TimeFormat string `json:"time_format,omitempty"`
+	// NoCache runs the query even when a cached result exists
+	NoCache bool `json:"no_cache,omitempty"`
 }
 
 // HubInterface defines the interface for a Hub that can broadcast events
@@ -49,11 +69,11 @@ func ExecuteQueryHandler(db *sql.DB, hub HubInterface) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		var req QueryRequest
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			http.Error(w, "Invalid input", http.StatusBadRequest)
+			writeJSONError(w, http.StatusBadRequest, "Invalid input")
 			return
 		}
 		if req.Query == "" {
-			http.Error(w, "Missing SQL query", http.StatusBadRequest)
+			writeJSONError(w, http.StatusBadRequest, "Missing SQL query")
 			return
 		}
 		if req.Schema == "" {
@@ -62,46 +82,140 @@ func ExecuteQueryHandler(db *sql.DB, hub HubInterface) http.HandlerFunc {
 		if req.EventName == "" {
 			req.EventName = "query_result"
 		}
+		if role := r.Header.Get("X-DB-Role"); role != "" {
+			req.Role = role
+		}
 
-		_, err := db.Exec(fmt.Sprintf("SET search_path TO %s", pq.QuoteIdentifier(req.Schema)))
-		if err != nil {
-			http.Error(w, "Failed to set schema: "+err.Error(), http.StatusInternalServerError)
+		var exportOpts ExportOptions
+		switch req.Format {
+		case "", "json":
+		case "csv", "tsv":
+			delimiter := req.Delimiter
+			if delimiter == "" {
+				delimiter = req.Format
+			}
+			d, err := ParseDelimiter(delimiter)
+			if err != nil {
+				writeJSONError(w, http.StatusBadRequest, SanitizeError(err).Error())
+				return
+			}
+			exportOpts = ExportOptions{Delimiter: d, NullString: req.NullString}
+		default:
+			writeJSONError(w, http.StatusBadRequest, "Unsupported format "+req.Format+" (use json, csv or tsv)")
 			return
 		}
 
-		rows, err := db.Query(req.Query, req.Args...)
-		if err != nil {
-			http.Error(w, "Query error: "+err.Error(), http.StatusBadRequest)
+		if err := AllowQuery(); err != nil {
+			writeJSONError(w, http.StatusTooManyRequests, "Rate limit exceeded, retry later")
 			return
 		}
-		defer rows.Close()
 
-		cols, _ := rows.Columns()
-		var results []map[string]interface{}
+		opts := QueryOptions{Role: req.Role, BinaryArtifacts: req.BinaryArtifacts, FormattedMoney: req.FormattedMoney, ArgTypes: req.ArgTypes, MaxRows: req.MaxRows, TimeFormat: req.TimeFormat, NoCache: req.NoCache}
+		ctx, cancel := WithQueryTimeout(r.Context(), time.Duration(req.TimeoutMs)*time.Millisecond)
+		defer cancel()
 
-		for rows.Next() {
-			columnVals := make([]interface{}, len(cols))
-			columnPtrs := make([]interface{}, len(cols))
-			for i := range columnVals {
-				columnPtrs[i] = &columnVals[i]
-			}
-			rows.Scan(columnPtrs...)
-			rowMap := make(map[string]interface{})
-			for i, col := range cols {
-				rowMap[col] = convertValue(columnVals[i])
-			}
-			results = append(results, rowMap)
+		// In streaming mode each row is written as one NDJSON line as soon as it is scanned
+		stream := r.URL.Query().Get("stream") == "true" || strings.Contains(r.Header.Get("Accept"), ndjsonContentType)
+		var nd *ndjsonWriter
+		if stream {
+			nd = newNDJSONWriter(w)
+			opts.OnRow = nd.writeRow
 		}
 
-		resp := map[string]interface{}{
-			"columns": cols,
-			"rows":    results,
+		resp, err := ExecuteQueryWithOptions(ctx, db, req.Schema, req.Query, req.Args, opts)
+		if stream && nd.started {
+			// Headers are already sent, so a failure can only be reported in-band
+			nd.finish(err)
+			return
 		}
-
-		if req.Broadcast {
-			hub.Broadcast() <- NewEvent(req.EventName, resp)
+		if err != nil {
+			status, msg := queryErrorStatus(err), "Query error: "+SanitizeError(err).Error()
+			if IsQueryTimeout(ctx, err) {
+				status, msg = http.StatusGatewayTimeout, "Query exceeded the allowed time and was cancelled"
+			}
+			writeJSONError(w, status, msg)
+			return
+		}
+		if stream {
+			nd.finish(nil)
+			return
 		}
+		writeQueryResult(w, hub, req, resp, exportOpts)
+	}
+}
+
+// ndjsonContentType is the media type of newline-delimited JSON responses
+const ndjsonContentType = "application/x-ndjson"
+
+// ndjsonFlushEvery is how many rows are written between flushes to the client
+const ndjsonFlushEvery = 100
+
+// ndjsonWriter writes query rows as newline-delimited JSON, sending the response
+// headers with the first row
+type ndjsonWriter struct {
+	w       http.ResponseWriter
+	enc     *json.Encoder
+	flusher http.Flusher
+	started bool
+	rows    int
+}
+
+func newNDJSONWriter(w http.ResponseWriter) *ndjsonWriter {
+	flusher, _ := w.(http.Flusher)
+	return &ndjsonWriter{w: w, enc: json.NewEncoder(w), flusher: flusher}
+}
 
+func (nd *ndjsonWriter) writeRow(row map[string]interface{}) error {
+	if !nd.started {
+		nd.w.Header().Set("Content-Type", ndjsonContentType)
+		nd.started = true
+	}
+	if err := nd.enc.Encode(row); err != nil {
+		return err
+	}
+	nd.rows++
+	if nd.flusher != nil && nd.rows%ndjsonFlushEvery == 0 {
+		nd.flusher.Flush()
+	}
+	return nil
+}
+
+// finish ends the stream, appending an {"error": ...} line if the query failed part way
+func (nd *ndjsonWriter) finish(err error) {
+	if !nd.started {
+		nd.w.Header().Set("Content-Type", ndjsonContentType)
+		nd.started = true
+	}
+	if err != nil {
+		nd.enc.Encode(map[string]string{"error": SanitizeError(err).Error()})
+	}
+	if nd.flusher != nil {
+		nd.flusher.Flush()
+	}
+}
+
+// writeQueryResult summarizes and broadcasts a query result as requested and
+// writes it as JSON, or as CSV/TSV when the request asks for an export format
+func writeQueryResult(w http.ResponseWriter, hub HubInterface, req QueryRequest, resp map[string]interface{}, exportOpts ExportOptions) {
+	cols, _ := resp["columns"].([]string)
+	rows, _ := resp["rows"].([]map[string]interface{})
+	if req.Summarize {
+		resp["summary"] = SummarizeResult(cols, rows)
+	}
+
+	if req.Broadcast {
+		hub.Broadcast() <- NewQueryResultEvent(req.EventName, resp)
+	}
+
+	switch req.Format {
+	case "csv", "tsv":
+		contentType := "text/csv"
+		if exportOpts.Delimiter == '\t' {
+			contentType = "text/tab-separated-values"
+		}
+		w.Header().Set("Content-Type", contentType+"; charset=utf-8")
+		WriteDelimited(w, cols, rows, exportOpts)
+	default:
 		json.NewEncoder(w).Encode(resp)
 	}
 }
@@ -111,7 +225,17 @@ func FullTableSchemaHandler(db *sql.DB) http.HandlerFunc {
 		schema := getSchemaParam(r)
 		table := r.URL.Query().Get("table")
 		if table == "" {
-			http.Error(w, "Missing table parameter", http.StatusBadRequest)
+			writeJSONError(w, http.StatusBadRequest, "Missing table parameter")
+			return
+		}
+		if err := requireTable(db, schema, table); err != nil {
+			status := http.StatusInternalServerError
+			if errors.Is(err, ErrTableNotFound) {
+				status = http.StatusNotFound
+			} else if errors.Is(err, ErrAccessDenied) {
+				status = http.StatusForbidden
+			}
+			writeJSONError(w, status, SanitizeError(err).Error())
 			return
 		}
 
@@ -139,34 +263,38 @@ func FullTableSchemaHandler(db *sql.DB) http.HandlerFunc {
 			WHERE table_schema = $1 AND table_name = $2;
 		`, schema, table)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			writeJSONError(w, http.StatusInternalServerError, SanitizeError(err).Error())
 			return
 		}
 		defer colRows.Close()
 		for colRows.Next() {
 			var col Column
-			colRows.Scan(&col.Name, &col.Type, &col.Nullable, &col.DefaultValue)
+			var defaultValue sql.NullString
+			if err := colRows.Scan(&col.Name, &col.Type, &col.Nullable, &defaultValue); err != nil {
+				writeJSONError(w, http.StatusInternalServerError, SanitizeError(err).Error())
+				return
+			}
+			col.DefaultValue = defaultValue.String
 			columns = append(columns, col)
 		}
+		if err := colRows.Err(); err != nil {
+			writeJSONError(w, http.StatusInternalServerError, SanitizeError(err).Error())
+			return
+		}
 
 		query := fmt.Sprintf(`SELECT * FROM %s.%s LIMIT 5`, pq.QuoteIdentifier(schema), pq.QuoteIdentifier(table))
 		sampleRows, err := db.Query(query)
 		if err == nil {
 			defer sampleRows.Close()
-			cols, _ := sampleRows.Columns()
-			for sampleRows.Next() {
-				columnVals := make([]interface{}, len(cols))
-				columnPtrs := make([]interface{}, len(cols))
-				for i := range columnVals {
-					columnPtrs[i] = &columnVals[i]
-				}
-				sampleRows.Scan(columnPtrs...)
-				rowMap := make(map[string]interface{})
-				for i, col := range cols {
-					rowMap[col] = convertValue(columnVals[i])
-				}
-				samples = append(samples, rowMap)
+			_, rows, err := scanRows(sampleRows, QueryOptions{})
+			if err != nil {
+				writeJSONError(w, http.StatusInternalServerError, SanitizeError(err).Error())
+				return
 			}
+			for _, row := range rows {
+				maskRow(schema, table, row)
+			}
+			samples = append(samples, rows...)
 		}
 
 		fkRows, err := db.Query(`
@@ -188,9 +316,22 @@ func FullTableSchemaHandler(db *sql.DB) http.HandlerFunc {
 			defer fkRows.Close()
 			for fkRows.Next() {
 				var fk FKConstraint
-				fkRows.Scan(&fk.ConstraintName, &fk.SourceTable, &fk.SourceColumn, &fk.TargetTable, &fk.TargetColumn)
+				if err := fkRows.Scan(&fk.ConstraintName, &fk.SourceTable, &fk.SourceColumn, &fk.TargetTable, &fk.TargetColumn); err != nil {
+					writeJSONError(w, http.StatusInternalServerError, SanitizeError(err).Error())
+					return
+				}
 				foreignKeys = append(foreignKeys, fk)
 			}
+			if err := fkRows.Err(); err != nil {
+				writeJSONError(w, http.StatusInternalServerError, SanitizeError(err).Error())
+				return
+			}
+		}
+
+		constraints, err := checkAndUniqueConstraints(db, schema, table)
+		if err != nil {
+			writeJSONError(w, http.StatusInternalServerError, SanitizeError(err).Error())
+			return
 		}
 
 		json.NewEncoder(w).Encode(map[string]interface{}{
@@ -198,6 +339,7 @@ func FullTableSchemaHandler(db *sql.DB) http.HandlerFunc {
 			"columns":      columns,
 			"sample_rows":  samples,
 			"foreign_keys": foreignKeys,
+			"constraints":  constraints,
 		})
 	}
 }
@@ -212,7 +354,7 @@ func ListTablesHandler(db *sql.DB) http.HandlerFunc {
 			ORDER BY table_name;
 		`, schema)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			writeJSONError(w, http.StatusInternalServerError, SanitizeError(err).Error())
 			return
 		}
 		defer rows.Close()
@@ -220,10 +362,45 @@ func ListTablesHandler(db *sql.DB) http.HandlerFunc {
 		var tables []string
 		for rows.Next() {
 			var table string
-			rows.Scan(&table)
+			if err := rows.Scan(&table); err != nil {
+				writeJSONError(w, http.StatusInternalServerError, SanitizeError(err).Error())
+				return
+			}
 			tables = append(tables, table)
 		}
-		json.NewEncoder(w).Encode(tables)
+		if err := rows.Err(); err != nil {
+			writeJSONError(w, http.StatusInternalServerError, SanitizeError(err).Error())
+			return
+		}
+		json.NewEncoder(w).Encode(filterTables(schema, tables))
+	}
+}
+
+func ListViewsHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		schema := getSchemaParam(r)
+		includeMaterialized := r.URL.Query().Get("materialized") == "true"
+
+		views, err := ListViews(db, schema, includeMaterialized)
+		if err != nil {
+			writeJSONError(w, http.StatusInternalServerError, SanitizeError(err).Error())
+			return
+		}
+		json.NewEncoder(w).Encode(views)
+	}
+}
+
+func ListFunctionsHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		schema := getSchemaParam(r)
+		includeBody := r.URL.Query().Get("include_body") == "true"
+
+		functions, err := ListFunctions(db, schema, includeBody)
+		if err != nil {
+			writeJSONError(w, http.StatusInternalServerError, SanitizeError(err).Error())
+			return
+		}
+		json.NewEncoder(w).Encode(functions)
 	}
 }
 
@@ -232,7 +409,11 @@ func DescribeTableHandler(db *sql.DB) http.HandlerFunc {
 		schema := getSchemaParam(r)
 		table := r.URL.Query().Get("table")
 		if table == "" {
-			http.Error(w, "Missing table parameter", http.StatusBadRequest)
+			writeJSONError(w, http.StatusBadRequest, "Missing table parameter")
+			return
+		}
+		if err := checkTableAccess(schema, table); err != nil {
+			writeJSONError(w, http.StatusForbidden, SanitizeError(err).Error())
 			return
 		}
 		rows, err := db.Query(`
@@ -241,7 +422,7 @@ func DescribeTableHandler(db *sql.DB) http.HandlerFunc {
 			WHERE table_schema = $1 AND table_name = $2;
 		`, schema, table)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			writeJSONError(w, http.StatusInternalServerError, SanitizeError(err).Error())
 			return
 		}
 		defer rows.Close()
@@ -255,9 +436,16 @@ func DescribeTableHandler(db *sql.DB) http.HandlerFunc {
 		var columns []Column
 		for rows.Next() {
 			var col Column
-			rows.Scan(&col.Name, &col.Type, &col.Nullable)
+			if err := rows.Scan(&col.Name, &col.Type, &col.Nullable); err != nil {
+				writeJSONError(w, http.StatusInternalServerError, SanitizeError(err).Error())
+				return
+			}
 			columns = append(columns, col)
 		}
+		if err := rows.Err(); err != nil {
+			writeJSONError(w, http.StatusInternalServerError, SanitizeError(err).Error())
+			return
+		}
 		json.NewEncoder(w).Encode(columns)
 	}
 }
@@ -267,31 +455,37 @@ func SampleRowsHandler(db *sql.DB) http.HandlerFunc {
 		schema := getSchemaParam(r)
 		table := r.URL.Query().Get("table")
 		if table == "" {
-			http.Error(w, "Missing table parameter", http.StatusBadRequest)
+			writeJSONError(w, http.StatusBadRequest, "Missing table parameter")
+			return
+		}
+		if err := requireTable(db, schema, table); err != nil {
+			status := http.StatusInternalServerError
+			if errors.Is(err, ErrTableNotFound) {
+				status = http.StatusNotFound
+			} else if errors.Is(err, ErrAccessDenied) {
+				status = http.StatusForbidden
+			}
+			writeJSONError(w, status, SanitizeError(err).Error())
 			return
 		}
 		query := fmt.Sprintf("SELECT * FROM %s.%s LIMIT 5", pq.QuoteIdentifier(schema), pq.QuoteIdentifier(table))
 		rows, err := db.Query(query)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			writeJSONError(w, http.StatusInternalServerError, SanitizeError(err).Error())
 			return
 		}
 		defer rows.Close()
 
-		cols, _ := rows.Columns()
-		result := []map[string]interface{}{}
-		for rows.Next() {
-			columnVals := make([]interface{}, len(cols))
-			columnPtrs := make([]interface{}, len(cols))
-			for i := range columnVals {
-				columnPtrs[i] = &columnVals[i]
-			}
-			rows.Scan(columnPtrs...)
-			rowMap := make(map[string]interface{})
-			for i, col := range cols {
-				rowMap[col] = convertValue(columnVals[i])
-			}
-			result = append(result, rowMap)
+		_, result, err := scanRows(rows, QueryOptions{})
+		if err != nil {
+			writeJSONError(w, http.StatusInternalServerError, SanitizeError(err).Error())
+			return
+		}
+		for _, row := range result {
+			maskRow(schema, table, row)
+		}
+		if result == nil {
+			result = []map[string]interface{}{}
 		}
 		json.NewEncoder(w).Encode(result)
 	}
@@ -302,7 +496,11 @@ func ForeignKeysHandler(db *sql.DB) http.HandlerFunc {
 		schema := getSchemaParam(r)
 		table := r.URL.Query().Get("table")
 		if table == "" {
-			http.Error(w, "Missing table parameter", http.StatusBadRequest)
+			writeJSONError(w, http.StatusBadRequest, "Missing table parameter")
+			return
+		}
+		if err := checkTableAccess(schema, table); err != nil {
+			writeJSONError(w, http.StatusForbidden, SanitizeError(err).Error())
 			return
 		}
 
@@ -322,7 +520,7 @@ func ForeignKeysHandler(db *sql.DB) http.HandlerFunc {
 			  AND (tc.table_name = $2 OR ccu.table_name = $2);
 		`, schema, table)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			writeJSONError(w, http.StatusInternalServerError, SanitizeError(err).Error())
 			return
 		}
 		defer rows.Close()
@@ -337,20 +535,53 @@ func ForeignKeysHandler(db *sql.DB) http.HandlerFunc {
 		var constraints []FKConstraint
 		for rows.Next() {
 			var fk FKConstraint
-			rows.Scan(&fk.ConstraintName, &fk.SourceTable, &fk.SourceColumn, &fk.TargetTable, &fk.TargetColumn)
+			if err := rows.Scan(&fk.ConstraintName, &fk.SourceTable, &fk.SourceColumn, &fk.TargetTable, &fk.TargetColumn); err != nil {
+				writeJSONError(w, http.StatusInternalServerError, SanitizeError(err).Error())
+				return
+			}
 			constraints = append(constraints, fk)
 		}
+		if err := rows.Err(); err != nil {
+			writeJSONError(w, http.StatusInternalServerError, SanitizeError(err).Error())
+			return
+		}
 		json.NewEncoder(w).Encode(constraints)
 	}
 }
 
+func IndexesHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		schema := getSchemaParam(r)
+		table := r.URL.Query().Get("table")
+		if table == "" {
+			writeJSONError(w, http.StatusBadRequest, "Missing table parameter")
+			return
+		}
+
+		indexes, err := GetIndexes(db, schema, table)
+		if errors.Is(err, ErrAccessDenied) {
+			writeJSONError(w, http.StatusForbidden, SanitizeError(err).Error())
+			return
+		}
+		if err != nil {
+			writeJSONError(w, http.StatusInternalServerError, SanitizeError(err).Error())
+			return
+		}
+		json.NewEncoder(w).Encode(indexes)
+	}
+}
+
 func ListSchemasHandler(db *sql.DB) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		filter := ""
+		if r.URL.Query().Get("include_system") != "true" {
+			filter = "WHERE " + systemSchemaCond
+		}
 		rows, err := db.Query(`
-			SELECT schema_name FROM information_schema.schemata ORDER BY schema_name;
+			SELECT schema_name FROM information_schema.schemata ` + filter + ` ORDER BY schema_name;
 		`)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			writeJSONError(w, http.StatusInternalServerError, SanitizeError(err).Error())
 			return
 		}
 		defer rows.Close()
@@ -358,9 +589,16 @@ func ListSchemasHandler(db *sql.DB) http.HandlerFunc {
 		var schemas []string
 		for rows.Next() {
 			var schema string
-			rows.Scan(&schema)
+			if err := rows.Scan(&schema); err != nil {
+				writeJSONError(w, http.StatusInternalServerError, SanitizeError(err).Error())
+				return
+			}
 			schemas = append(schemas, schema)
 		}
+		if err := rows.Err(); err != nil {
+			writeJSONError(w, http.StatusInternalServerError, SanitizeError(err).Error())
+			return
+		}
 		json.NewEncoder(w).Encode(schemas)
 	}
 }
@@ -0,0 +1,80 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestExecuteQueryHandlerSanitizesErrors(t *testing.T) {
+	db := testDB(t)
+	schema := testSchema(t, db)
+	handler := ExecuteQueryHandler(db, nil)
+
+	body := `{"schema": "` + schema + `", "query": "SELECT token FROM payment_tokens_archive"}`
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodPost, "/query", strings.NewReader(body)))
+
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+	var resp map[string]string
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp["error"] != "Query error: relation does not exist (SQLSTATE 42P01)" {
+		t.Errorf("error = %q", resp["error"])
+	}
+	if strings.Contains(resp["error"], "payment_tokens_archive") {
+		t.Errorf("error reveals the relation name: %q", resp["error"])
+	}
+}
+
+func TestListSchemasHidesSystemSchemas(t *testing.T) {
+	db := testDB(t)
+	schema := testSchema(t, db)
+
+	isSystem := func(name string) bool {
+		return strings.HasPrefix(name, "pg_") || name == "information_schema"
+	}
+	check := func(source string, schemas []string, includeSystem bool) {
+		t.Helper()
+		var sawSystem, sawTest bool
+		for _, name := range schemas {
+			sawSystem = sawSystem || isSystem(name)
+			sawTest = sawTest || name == schema
+		}
+		if !sawTest {
+			t.Errorf("%s: %s is missing from %v", source, schema, schemas)
+		}
+		if sawSystem != includeSystem {
+			t.Errorf("%s: system schemas listed = %v, want %v in %v", source, sawSystem, includeSystem, schemas)
+		}
+	}
+
+	for _, includeSystem := range []bool{false, true} {
+		schemas, err := ListSchemas(db, includeSystem)
+		if err != nil {
+			t.Fatalf("ListSchemas: %v", err)
+		}
+		check("ListSchemas", schemas, includeSystem)
+	}
+
+	for _, tt := range []struct {
+		url           string
+		includeSystem bool
+	}{
+		{"/schemas", false},
+		{"/schemas?include_system=true", true},
+	} {
+		rec := httptest.NewRecorder()
+		ListSchemasHandler(db)(rec, httptest.NewRequest(http.MethodGet, tt.url, nil))
+		var schemas []string
+		if err := json.NewDecoder(rec.Body).Decode(&schemas); err != nil {
+			t.Fatalf("%s: %v", tt.url, err)
+		}
+		check(tt.url, schemas, tt.includeSystem)
+	}
+}
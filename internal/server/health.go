@@ -0,0 +1,187 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// defaultReadinessTimeout bounds the database ping made by the readiness probe
+const defaultReadinessTimeout = 2 * time.Second
+
+// HealthzHandler is the liveness probe; it succeeds whenever the process can serve HTTP
+func HealthzHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+	}
+}
+
+// ReadyzHandler is the readiness probe. It pings the database within timeout
+// and answers 503 when it is unreachable, reporting connection pool stats and
+// the state of the background health check, when one runs, either way.
+func ReadyzHandler(db *sql.DB, timeout time.Duration, health *HealthMonitor) http.HandlerFunc {
+	if timeout <= 0 {
+		timeout = defaultReadinessTimeout
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		stats := db.Stats()
+		resp := map[string]interface{}{
+			"status": "ready",
+			"pool": map[string]interface{}{
+				"max_open_connections": stats.MaxOpenConnections,
+				"open_connections":     stats.OpenConnections,
+				"in_use":               stats.InUse,
+				"idle":                 stats.Idle,
+				"wait_count":           stats.WaitCount,
+				"wait_duration_ms":     stats.WaitDuration.Milliseconds(),
+				"max_idle_closed":      stats.MaxIdleClosed,
+				"max_idle_time_closed": stats.MaxIdleTimeClosed,
+				"max_lifetime_closed":  stats.MaxLifetimeClosed,
+			},
+		}
+
+		if health != nil {
+			resp["health_check"] = health.Status()
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := db.PingContext(ctx); err != nil {
+			resp["status"] = "unavailable"
+			resp["error"] = SanitizeError(err).Error()
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		json.NewEncoder(w).Encode(resp)
+	}
+}
+
+// HealthMonitor pings the database in the background. When a ping fails, and
+// again once one succeeds after an outage, it drops the idle connections of the
+// pool so queries after a database restart get fresh connections instead of
+// failing on stale ones.
+type HealthMonitor struct {
+	db           *sql.DB
+	interval     time.Duration
+	timeout      time.Duration
+	maxIdleConns int
+
+	mu        sync.Mutex
+	healthy   bool
+	failures  int
+	lastError string
+	lastCheck time.Time
+	since     time.Time
+
+	done    chan struct{}
+	stopped chan struct{}
+}
+
+// NewHealthMonitor creates a monitor pinging db every interval within timeout.
+// maxIdleConns is the pool's idle connection limit, restored after idle
+// connections are dropped.
+func NewHealthMonitor(db *sql.DB, interval, timeout time.Duration, maxIdleConns int) *HealthMonitor {
+	if timeout <= 0 {
+		timeout = defaultReadinessTimeout
+	}
+	return &HealthMonitor{
+		db:           db,
+		interval:     interval,
+		timeout:      timeout,
+		maxIdleConns: maxIdleConns,
+		healthy:      true,
+		since:        time.Now(),
+		done:         make(chan struct{}),
+		stopped:      make(chan struct{}),
+	}
+}
+
+// Start runs the health check loop until Stop is called
+func (m *HealthMonitor) Start() {
+	go func() {
+		defer close(m.stopped)
+		ticker := time.NewTicker(m.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				m.check()
+			case <-m.done:
+				return
+			}
+		}
+	}()
+}
+
+// Stop ends the health check loop and waits for a running check to finish
+func (m *HealthMonitor) Stop() {
+	close(m.done)
+	<-m.stopped
+}
+
+// check pings the database once and records the outcome
+func (m *HealthMonitor) check() {
+	ctx, cancel := context.WithTimeout(context.Background(), m.timeout)
+	err := m.db.PingContext(ctx)
+	cancel()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.lastCheck = time.Now()
+
+	if err != nil {
+		m.failures++
+		m.lastError = SanitizeError(err).Error()
+		if m.healthy {
+			m.healthy = false
+			m.since = m.lastCheck
+			slog.Error("Database health check failed", "err", err)
+			m.resetIdleConns()
+		} else {
+			slog.Warn("Database still unreachable", "err", err, "consecutive_failures", m.failures)
+		}
+		return
+	}
+
+	if !m.healthy {
+		slog.Info("Database connection restored", "down_for", m.lastCheck.Sub(m.since).Round(time.Millisecond))
+		m.healthy = true
+		m.since = m.lastCheck
+		m.resetIdleConns()
+	}
+	m.failures = 0
+	m.lastError = ""
+}
+
+// resetIdleConns closes every idle pooled connection, as they may be broken,
+// and restores the idle limit so new connections are pooled again
+func (m *HealthMonitor) resetIdleConns() {
+	m.db.SetMaxIdleConns(0)
+	m.db.SetMaxIdleConns(m.maxIdleConns)
+}
+
+// Status reports the outcome of the latest health check
+func (m *HealthMonitor) Status() map[string]interface{} {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	status := map[string]interface{}{
+		"healthy":              m.healthy,
+		"since":                m.since.UTC().Format(time.RFC3339),
+		"consecutive_failures": m.failures,
+		"interval_ms":          m.interval.Milliseconds(),
+	}
+	if !m.lastCheck.IsZero() {
+		status["last_check"] = m.lastCheck.UTC().Format(time.RFC3339)
+	}
+	if m.lastError != "" {
+		status["last_error"] = m.lastError
+	}
+	return status
+}
@@ -0,0 +1,285 @@
+package server
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode"
+)
+
+// defaultHistorySize is the number of executed queries kept in memory
+const defaultHistorySize = 500
+
+// inListPattern matches a parenthesized list of placeholders such as (?, ?, ?)
+var inListPattern = regexp.MustCompile(`\(\s*\?(?:\s*,\s*\?)*\s*\)`)
+
+// defaultConnectionLabel labels queries when DB_LABEL is not set
+const defaultConnectionLabel = "default"
+
+// connectionLabel identifies the database connection queries are recorded against
+var connectionLabel atomic.Value
+
+// SetConnectionLabel sets the label recorded with every executed query so
+// per-connection breakdowns such as the slow query report can tell databases apart
+func SetConnectionLabel(label string) {
+	if label == "" {
+		label = defaultConnectionLabel
+	}
+	connectionLabel.Store(label)
+}
+
+// ConnectionLabel returns the label of the database connection
+func ConnectionLabel() string {
+	if label, ok := connectionLabel.Load().(string); ok {
+		return label
+	}
+	return defaultConnectionLabel
+}
+
+// QueryRecord is a single executed query kept in the history buffer
+type QueryRecord struct {
+	Connection  string
+	Query       string
+	Fingerprint string
+	Duration    time.Duration
+	ExecutedAt  time.Time
+}
+
+// queryHistory is a fixed-size ring buffer of recently executed queries
+type queryHistory struct {
+	mu      sync.Mutex
+	records []QueryRecord
+	next    int
+	full    bool
+}
+
+func newQueryHistory(size int) *queryHistory {
+	return &queryHistory{records: make([]QueryRecord, size)}
+}
+
+var history = newQueryHistory(defaultHistorySize)
+
+// SetQueryHistorySize resizes the history buffer, discarding recorded queries
+func SetQueryHistorySize(size int) {
+	if size <= 0 {
+		size = defaultHistorySize
+	}
+	history.mu.Lock()
+	defer history.mu.Unlock()
+	history.records = make([]QueryRecord, size)
+	history.next = 0
+	history.full = false
+}
+
+func (h *queryHistory) record(query string, duration time.Duration) {
+	normalized := NormalizeQuery(query)
+	rec := QueryRecord{
+		Connection:  ConnectionLabel(),
+		Query:       query,
+		Fingerprint: fingerprint(normalized),
+		Duration:    duration,
+		ExecutedAt:  time.Now(),
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.records[h.next] = rec
+	h.next = (h.next + 1) % len(h.records)
+	if h.next == 0 {
+		h.full = true
+	}
+}
+
+// snapshot returns the recorded queries, oldest first
+func (h *queryHistory) snapshot() []QueryRecord {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if !h.full {
+		return append([]QueryRecord(nil), h.records[:h.next]...)
+	}
+	out := make([]QueryRecord, 0, len(h.records))
+	out = append(out, h.records[h.next:]...)
+	return append(out, h.records[:h.next]...)
+}
+
+// recordQuery adds an executed query to the history buffer
+func recordQuery(query string, start time.Time) {
+	history.record(query, time.Since(start))
+}
+
+// fingerprint returns a short stable identifier for a normalized query
+func fingerprint(normalized string) string {
+	sum := sha1.Sum([]byte(normalized))
+	return hex.EncodeToString(sum[:8])
+}
+
+// NormalizeQuery reduces a query to its shape: literals become ?, comments are
+// dropped, whitespace is collapsed and unquoted text is lower-cased, so queries
+// that differ only in their constants share a fingerprint
+func NormalizeQuery(query string) string {
+	var b strings.Builder
+	runes := []rune(query)
+	n := len(runes)
+	space := false
+
+	writeSpace := func() {
+		if b.Len() > 0 {
+			space = true
+		}
+	}
+	write := func(s string) {
+		if space {
+			b.WriteByte(' ')
+			space = false
+		}
+		b.WriteString(s)
+	}
+
+	for i := 0; i < n; i++ {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			writeSpace()
+		case r == '-' && i+1 < n && runes[i+1] == '-':
+			for i < n && runes[i] != '\n' {
+				i++
+			}
+			writeSpace()
+		case r == '/' && i+1 < n && runes[i+1] == '*':
+			i += 2
+			for i+1 < n && !(runes[i] == '*' && runes[i+1] == '/') {
+				i++
+			}
+			i++
+			writeSpace()
+		case r == '\'':
+			i++
+			for i < n {
+				if runes[i] == '\'' {
+					if i+1 < n && runes[i+1] == '\'' {
+						i += 2
+						continue
+					}
+					break
+				}
+				i++
+			}
+			write("?")
+		case r == '"':
+			j := i + 1
+			for j < n && runes[j] != '"' {
+				j++
+			}
+			if j >= n {
+				j = n - 1
+			}
+			write(string(runes[i : j+1]))
+			i = j
+		case r == '$' && i+1 < n && unicode.IsDigit(runes[i+1]):
+			j := i + 1
+			for j < n && unicode.IsDigit(runes[j]) {
+				j++
+			}
+			write(string(runes[i:j]))
+			i = j - 1
+		case unicode.IsDigit(r):
+			j := i
+			for j < n && (unicode.IsDigit(runes[j]) || runes[j] == '.') {
+				j++
+			}
+			write("?")
+			i = j - 1
+		case unicode.IsLetter(r) || r == '_':
+			j := i
+			for j < n && (unicode.IsLetter(runes[j]) || unicode.IsDigit(runes[j]) || runes[j] == '_' || runes[j] == '$') {
+				j++
+			}
+			write(strings.ToLower(string(runes[i:j])))
+			i = j - 1
+		default:
+			write(string(r))
+		}
+	}
+
+	normalized := strings.TrimSuffix(strings.TrimSpace(b.String()), ";")
+	return inListPattern.ReplaceAllString(normalized, "(?)")
+}
+
+// SlowQueryReport groups recorded queries slower than threshold by connection
+// label and fingerprint, returning count, min/max/avg duration and a sample query per group, slowest first
+func SlowQueryReport(threshold time.Duration, limit int) []map[string]interface{} {
+	type group struct {
+		connection  string
+		fingerprint string
+		normalized  string
+		sample      string
+		count       int
+		total       time.Duration
+		min         time.Duration
+		max         time.Duration
+		lastSeen    time.Time
+	}
+
+	groups := map[string]*group{}
+	for _, rec := range history.snapshot() {
+		if rec.Duration < threshold {
+			continue
+		}
+		key := rec.Connection + "\x00" + rec.Fingerprint
+		g, ok := groups[key]
+		if !ok {
+			g = &group{
+				connection:  rec.Connection,
+				fingerprint: rec.Fingerprint,
+				normalized:  NormalizeQuery(rec.Query),
+				min:         rec.Duration,
+			}
+			groups[key] = g
+		}
+		g.count++
+		g.total += rec.Duration
+		if rec.Duration < g.min {
+			g.min = rec.Duration
+		}
+		if rec.Duration >= g.max {
+			g.max = rec.Duration
+			g.sample = rec.Query
+		}
+		if rec.ExecutedAt.After(g.lastSeen) {
+			g.lastSeen = rec.ExecutedAt
+		}
+	}
+
+	sorted := make([]*group, 0, len(groups))
+	for _, g := range groups {
+		sorted = append(sorted, g)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].total > sorted[j].total
+	})
+	if limit > 0 && len(sorted) > limit {
+		sorted = sorted[:limit]
+	}
+
+	report := make([]map[string]interface{}, 0, len(sorted))
+	for _, g := range sorted {
+		report = append(report, map[string]interface{}{
+			"connection":      g.connection,
+			"fingerprint":     g.fingerprint,
+			"normalized":      g.normalized,
+			"sample_query":    g.sample,
+			"count":           g.count,
+			"min_duration_ms": g.min.Milliseconds(),
+			"max_duration_ms": g.max.Milliseconds(),
+			"avg_duration_ms": (g.total / time.Duration(g.count)).Milliseconds(),
+			"last_seen":       g.lastSeen,
+		})
+	}
+	return report
+}
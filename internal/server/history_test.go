@@ -0,0 +1,99 @@
+package server
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// setTestConnectionLabel labels recorded queries for the test and starts it
+// with an empty query history
+func setTestConnectionLabel(t *testing.T, label string) {
+	t.Helper()
+	SetConnectionLabel(label)
+	SetQueryHistorySize(0)
+	t.Cleanup(func() {
+		SetConnectionLabel("")
+		SetQueryHistorySize(0)
+	})
+}
+
+func TestConnectionLabel(t *testing.T) {
+	setTestConnectionLabel(t, "")
+	if got := ConnectionLabel(); got != defaultConnectionLabel {
+		t.Errorf("unset label = %q, want %q", got, defaultConnectionLabel)
+	}
+	SetConnectionLabel("replica")
+	if got := ConnectionLabel(); got != "replica" {
+		t.Errorf("label = %q, want replica", got)
+	}
+}
+
+func TestSlowQueryReportByConnection(t *testing.T) {
+	setTestConnectionLabel(t, "primary")
+	history.record("SELECT * FROM orders WHERE id = 1", 2*time.Second)
+	history.record("SELECT * FROM orders WHERE id = 2", 3*time.Second)
+	history.record("SELECT 1", time.Millisecond)
+	SetConnectionLabel("replica")
+	history.record("SELECT * FROM orders WHERE id = 3", 4*time.Second)
+
+	report := SlowQueryReport(time.Second, 0)
+	if len(report) != 2 {
+		t.Fatalf("got %d groups, want one per connection: %v", len(report), report)
+	}
+	counts := map[string]int{}
+	for _, g := range report {
+		counts[g["connection"].(string)] = g["count"].(int)
+		if g["normalized"] != "select * from orders where id = ?" {
+			t.Errorf("normalized = %q", g["normalized"])
+		}
+	}
+	if counts["primary"] != 2 || counts["replica"] != 1 {
+		t.Errorf("counts by connection = %v, want primary 2 and replica 1", counts)
+	}
+	// The primary group has the larger total, so it comes first
+	if report[0]["connection"] != "primary" || report[0]["sample_query"] != "SELECT * FROM orders WHERE id = 2" {
+		t.Errorf("first group = %v", report[0])
+	}
+}
+
+func TestQueryCacheKeyIncludesConnection(t *testing.T) {
+	setTestConnectionLabel(t, "primary")
+	primary := queryCacheKey("public", "SELECT 1", nil, QueryOptions{})
+	SetConnectionLabel("replica")
+	if queryCacheKey("public", "SELECT 1", nil, QueryOptions{}) == primary {
+		t.Error("cache keys of two connections are equal")
+	}
+}
+
+func TestExecutedQueriesCarryConnectionLabel(t *testing.T) {
+	db := testDB(t)
+	setTestConnectionLabel(t, "tenant-a")
+
+	if _, err := ExecuteQueryWithOptions(context.Background(), db, "public", "SELECT 42", nil, QueryOptions{NoCache: true}); err != nil {
+		t.Fatalf("ExecuteQueryWithOptions: %v", err)
+	}
+	records := history.snapshot()
+	if len(records) != 1 || records[0].Connection != "tenant-a" || records[0].Query != "SELECT 42" {
+		t.Fatalf("history = %+v, want one SELECT 42 labelled tenant-a", records)
+	}
+	if report := SlowQueryReport(0, 0); len(report) != 1 || report[0]["connection"] != "tenant-a" {
+		t.Errorf("report = %v", report)
+	}
+}
+
+func TestNormalizeQuery(t *testing.T) {
+	tests := []struct {
+		query, want string
+	}{
+		{"SELECT * FROM t WHERE id = 1;", "select * from t where id = ?"},
+		{"select *\n  from t -- trailing\n where name = 'it''s'", "select * from t where name = ?"},
+		{"SELECT /* hint */ 1.5, $1", "select ?, $1"},
+		{`SELECT "MixedCase" FROM t WHERE id IN (1, 2, 3)`, `select "MixedCase" from t where id in (?)`},
+	}
+	for _, tt := range tests {
+		if got := NormalizeQuery(tt.query); got != tt.want {
+			t.Errorf("NormalizeQuery(%q) = %q, want %q", tt.query, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,203 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Masking strategies for sensitive columns
+const (
+	// MaskRedact replaces the value entirely
+	MaskRedact = "redact"
+	// MaskPartial keeps the first character (and an email's top-level domain)
+	MaskPartial = "partial"
+	// MaskHash replaces the value with a stable SHA-256 prefix so equal values stay comparable
+	MaskHash = "hash"
+)
+
+// redactedValue is what a fully redacted value is replaced with
+const redactedValue = "[REDACTED]"
+
+var (
+	maskPolicyMu sync.RWMutex
+	// maskPolicy maps column, table.column or schema.table.column to a strategy
+	maskPolicy = map[string]string{}
+)
+
+// SetMaskPolicy parses a comma-separated list of `column:strategy` entries, where
+// column may be qualified as table.column or schema.table.column, and installs it
+// as the column masking policy
+func SetMaskPolicy(spec string) error {
+	policy := map[string]string{}
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		column, strategy, found := strings.Cut(entry, ":")
+		if !found {
+			strategy = MaskRedact
+		}
+		strategy = strings.ToLower(strings.TrimSpace(strategy))
+		switch strategy {
+		case MaskRedact, MaskPartial, MaskHash:
+		default:
+			return fmt.Errorf("unknown masking strategy %q for column %s", strategy, column)
+		}
+		policy[strings.TrimSpace(column)] = strategy
+	}
+
+	maskPolicyMu.Lock()
+	maskPolicy = policy
+	maskPolicyMu.Unlock()
+	// Cached results were masked by the previous policy
+	results.reset()
+	return nil
+}
+
+// maskStrategy returns the strategy for a schema.table.column name, preferring
+// the most specific policy entry
+func maskStrategy(column string) (string, bool) {
+	maskPolicyMu.RLock()
+	defer maskPolicyMu.RUnlock()
+	return maskStrategyLocked(column)
+}
+
+// maskStrategyLocked is maskStrategy for callers already holding maskPolicyMu
+func maskStrategyLocked(column string) (string, bool) {
+	if len(maskPolicy) == 0 {
+		return "", false
+	}
+	for name := column; ; {
+		if strategy, ok := maskPolicy[name]; ok {
+			return strategy, true
+		}
+		_, rest, found := strings.Cut(name, ".")
+		if !found {
+			return "", false
+		}
+		name = rest
+	}
+}
+
+// maskValue masks val according to the policy for column, given as
+// schema.table.column; values of unlisted columns and NULLs are returned unchanged
+func maskValue(column string, val interface{}) interface{} {
+	if val == nil {
+		return nil
+	}
+	strategy, ok := maskStrategy(column)
+	if !ok {
+		return val
+	}
+
+	return applyMask(strategy, val)
+}
+
+// applyMask masks a non-NULL value with the given strategy
+func applyMask(strategy string, val interface{}) interface{} {
+	if val == nil {
+		return nil
+	}
+	str := fmt.Sprint(val)
+	switch strategy {
+	case MaskHash:
+		sum := sha256.Sum256([]byte(str))
+		return "sha256:" + hex.EncodeToString(sum[:8])
+	case MaskPartial:
+		return maskPartial(str)
+	default:
+		return redactedValue
+	}
+}
+
+// maskPartial keeps just enough of a value to recognise its shape, e.g. j***@***.com
+func maskPartial(str string) string {
+	if local, domain, found := strings.Cut(str, "@"); found && local != "" {
+		masked := string([]rune(local)[:1]) + "***@***"
+		if i := strings.LastIndex(domain, "."); i >= 0 {
+			masked += domain[i:]
+		}
+		return masked
+	}
+	runes := []rune(str)
+	if len(runes) < 3 {
+		return "***"
+	}
+	return string(runes[:1]) + "***"
+}
+
+// maskRow masks the sensitive columns of a row read from schema.table in place
+func maskRow(schema, table string, row map[string]interface{}) {
+	prefix := schema + "." + table + "."
+	for col, val := range row {
+		row[col] = maskValue(prefix+col, val)
+	}
+}
+
+// maskingEnabled reports whether any sensitive columns are configured
+func maskingEnabled() bool {
+	maskPolicyMu.RLock()
+	defer maskPolicyMu.RUnlock()
+	return len(maskPolicy) > 0
+}
+
+// maskStrength orders strategies so the one hiding the most wins when a result
+// column matches several policy entries
+var maskStrength = map[string]int{MaskPartial: 1, MaskHash: 2, MaskRedact: 3}
+
+// queryMask decides which columns of an arbitrary query's result to mask. A
+// result column carries no source table, so its name is matched against the
+// policy for every relation the query reads; when those relations are unknown,
+// any policy entry for a column of that name applies.
+type queryMask struct {
+	relations []string
+	known     bool
+}
+
+// newQueryMask returns the mask for a query reading relations (schema.table
+// names, nil when they could not be determined), or nil when masking is off
+func newQueryMask(relations []string) *queryMask {
+	if !maskingEnabled() {
+		return nil
+	}
+	return &queryMask{relations: relations, known: relations != nil}
+}
+
+// strategies returns the masking strategy for each result column that needs one
+func (m *queryMask) strategies(cols []string) map[string]string {
+	if m == nil {
+		return nil
+	}
+	maskPolicyMu.RLock()
+	defer maskPolicyMu.RUnlock()
+
+	out := map[string]string{}
+	for _, col := range cols {
+		var candidates []string
+		if m.known {
+			candidates = append(candidates, col)
+			for _, rel := range m.relations {
+				candidates = append(candidates, rel+"."+col)
+			}
+		} else {
+			for name := range maskPolicy {
+				if name == col || strings.HasSuffix(name, "."+col) {
+					candidates = append(candidates, name)
+				}
+			}
+		}
+		for _, name := range candidates {
+			if strategy, ok := maskStrategyLocked(name); ok && maskStrength[strategy] > maskStrength[out[col]] {
+				out[col] = strategy
+			}
+		}
+	}
+	if len(out) == 0 {
+		return nil
+	}
+	return out
+}
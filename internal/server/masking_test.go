@@ -0,0 +1,105 @@
+package server
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSetMaskPolicy(t *testing.T) {
+	t.Cleanup(func() { SetMaskPolicy("") })
+
+	if err := SetMaskPolicy("email:scramble"); err == nil {
+		t.Error("unknown strategy was accepted")
+	}
+	if err := SetMaskPolicy(" email , ssn:Hash, ,users.phone:partial"); err != nil {
+		t.Fatalf("SetMaskPolicy: %v", err)
+	}
+	tests := []struct {
+		column, want string
+	}{
+		{"public.users.email", MaskRedact},
+		{"public.users.ssn", MaskHash},
+		{"public.users.phone", MaskPartial},
+		{"public.accounts.phone", ""},
+		{"public.users.name", ""},
+	}
+	for _, tt := range tests {
+		if got, _ := maskStrategy(tt.column); got != tt.want {
+			t.Errorf("maskStrategy(%q) = %q, want %q", tt.column, got, tt.want)
+		}
+	}
+}
+
+func TestMaskStrategyPrefersSpecificEntries(t *testing.T) {
+	setTestMaskPolicy(t, "email:partial,users.email:hash,billing.users.email:redact")
+	tests := []struct {
+		column, want string
+	}{
+		{"billing.users.email", MaskRedact},
+		{"public.users.email", MaskHash},
+		{"public.accounts.email", MaskPartial},
+	}
+	for _, tt := range tests {
+		if got, _ := maskStrategy(tt.column); got != tt.want {
+			t.Errorf("maskStrategy(%q) = %q, want %q", tt.column, got, tt.want)
+		}
+	}
+}
+
+func TestMaskValue(t *testing.T) {
+	setTestMaskPolicy(t, "email:partial,ssn:hash,token:redact,nickname:partial")
+	tests := []struct {
+		column string
+		val    interface{}
+		want   interface{}
+	}{
+		{"public.users.email", "jane@example.com", "j***@***.com"},
+		{"public.users.email", "jane@localhost", "j***@***"},
+		{"public.users.nickname", "Bo", "***"},
+		{"public.users.nickname", "Bobby", "B***"},
+		{"public.users.token", "hunter2", redactedValue},
+		{"public.users.token", int64(42), redactedValue},
+		{"public.users.token", nil, nil},
+		{"public.users.name", "Jane", "Jane"},
+		{"public.users.id", int64(7), int64(7)},
+	}
+	for _, tt := range tests {
+		if got := maskValue(tt.column, tt.val); got != tt.want {
+			t.Errorf("maskValue(%q, %v) = %v, want %v", tt.column, tt.val, got, tt.want)
+		}
+	}
+
+	// Hashes are stable, so equal values stay comparable, and differ otherwise
+	a, b := maskValue("public.users.ssn", "123-45-6789"), maskValue("public.users.ssn", "123-45-6789")
+	c := maskValue("public.users.ssn", "987-65-4321")
+	if a != b || a == c || !strings.HasPrefix(a.(string), "sha256:") {
+		t.Errorf("hashes = %v, %v, %v", a, b, c)
+	}
+}
+
+func TestSampleRowsMasksSensitiveColumns(t *testing.T) {
+	db := testDB(t)
+	schema := testSchema(t, db,
+		"CREATE TABLE users (id int, name text, email text, ssn text)",
+		"INSERT INTO users VALUES (1, 'Jane', 'jane@example.com', '123-45-6789'), (2, 'Bo', NULL, NULL)",
+	)
+	setTestMaskPolicy(t, "email:partial,users.ssn:redact")
+
+	result, err := SampleRows(db, schema, "users", 5, 0, "id", "", nil)
+	if err != nil {
+		t.Fatalf("SampleRows: %v", err)
+	}
+	rows := result["rows"].([]map[string]interface{})
+	if len(rows) != 2 {
+		t.Fatalf("got %d rows, want 2", len(rows))
+	}
+	if rows[0]["email"] != "j***@***.com" || rows[0]["ssn"] != redactedValue {
+		t.Errorf("masked columns = %v, %v", rows[0]["email"], rows[0]["ssn"])
+	}
+	if rows[0]["name"] != "Jane" {
+		t.Errorf("unmasked name = %v, want Jane", rows[0]["name"])
+	}
+	if rows[1]["email"] != nil || rows[1]["ssn"] != nil {
+		t.Errorf("NULLs were masked: %v", rows[1])
+	}
+}
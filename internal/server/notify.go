@@ -0,0 +1,144 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// PgNotifyEventName is the name of the events NOTIFY messages are broadcast as
+const PgNotifyEventName = "pg_notify"
+
+// Reconnect backoff and keepalive interval of the LISTEN connection
+const (
+	listenerMinReconnect = 10 * time.Second
+	listenerMaxReconnect = time.Minute
+	listenerPingInterval = 90 * time.Second
+)
+
+// NotifyBridge LISTENs on Postgres channels and broadcasts every NOTIFY received
+// through the hub. Its dedicated connection is opened on the first subscription
+// and re-established by pq.Listener after failures, resubscribing all channels.
+type NotifyBridge struct {
+	dsn string
+	hub HubInterface
+
+	mu       sync.Mutex
+	listener *pq.Listener
+	channels map[string]bool
+	done     chan struct{}
+	stopped  chan struct{}
+}
+
+// NewNotifyBridge creates a bridge that connects with dsn and broadcasts to hub
+func NewNotifyBridge(dsn string, hub HubInterface) *NotifyBridge {
+	return &NotifyBridge{
+		dsn:      dsn,
+		hub:      hub,
+		channels: make(map[string]bool),
+	}
+}
+
+// Subscribe starts forwarding NOTIFY messages sent on channel
+func (b *NotifyBridge) Subscribe(channel string) error {
+	if channel == "" {
+		return fmt.Errorf("channel name is required")
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.listener == nil {
+		b.listener = pq.NewListener(b.dsn, listenerMinReconnect, listenerMaxReconnect, func(ev pq.ListenerEventType, err error) {
+			switch ev {
+			case pq.ListenerEventDisconnected, pq.ListenerEventConnectionAttemptFailed:
+				slog.Warn("LISTEN connection lost", "err", err)
+			case pq.ListenerEventReconnected:
+				slog.Info("LISTEN connection re-established")
+			}
+		})
+		b.done = make(chan struct{})
+		b.stopped = make(chan struct{})
+		go b.run(b.listener, b.done, b.stopped)
+	}
+
+	if err := b.listener.Listen(channel); err != nil && !errors.Is(err, pq.ErrChannelAlreadyOpen) {
+		return fmt.Errorf("listen error: %w", err)
+	}
+	b.channels[channel] = true
+	return nil
+}
+
+// Unsubscribe stops forwarding NOTIFY messages sent on channel
+func (b *NotifyBridge) Unsubscribe(channel string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !b.channels[channel] {
+		return fmt.Errorf("not subscribed to channel %q", channel)
+	}
+	if err := b.listener.Unlisten(channel); err != nil && !errors.Is(err, pq.ErrChannelNotOpen) {
+		return fmt.Errorf("unlisten error: %w", err)
+	}
+	delete(b.channels, channel)
+	return nil
+}
+
+// Channels returns the subscribed channel names in order
+func (b *NotifyBridge) Channels() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	channels := make([]string, 0, len(b.channels))
+	for channel := range b.channels {
+		channels = append(channels, channel)
+	}
+	sort.Strings(channels)
+	return channels
+}
+
+// Close stops forwarding and closes the LISTEN connection. Once it returns no
+// more events are sent to the hub, so the hub can be closed after it.
+func (b *NotifyBridge) Close() {
+	b.mu.Lock()
+	listener, done, stopped := b.listener, b.done, b.stopped
+	b.listener = nil
+	b.channels = make(map[string]bool)
+	b.mu.Unlock()
+
+	if listener == nil {
+		return
+	}
+	close(done)
+	<-stopped
+	listener.Close()
+}
+
+// run forwards notifications until done is closed, pinging the connection when
+// idle so a silently dropped connection is noticed and re-established
+func (b *NotifyBridge) run(listener *pq.Listener, done, stopped chan struct{}) {
+	defer close(stopped)
+	for {
+		select {
+		case n := <-listener.Notify:
+			// A nil notification signals a reconnect, after which messages may have been missed
+			if n == nil {
+				continue
+			}
+			select {
+			case b.hub.Broadcast() <- NewPgNotifyEvent(PgNotifyEventName, n.Channel, n.Extra, n.BePid):
+			case <-done:
+				return
+			}
+		case <-time.After(listenerPingInterval):
+			go listener.Ping()
+		case <-done:
+			return
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package server
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// coerceArgs converts JSON-decoded parameters that lib/pq cannot bind directly.
+// Objects are sent as JSON text; arrays are sent as JSON when the matching type
+// hint is json/jsonb or they contain nested objects or arrays without an array
+// type hint, and as Postgres array literals otherwise, so [[1,2],[3,4]] hinted
+// as int[] is a two-dimensional array. Postgres then parses the text as the
+// parameter's inferred type, e.g. a jsonb or int[] column.
+func coerceArgs(args []interface{}, types []string) ([]interface{}, error) {
+	if len(args) == 0 {
+		return args, nil
+	}
+
+	coerced := make([]interface{}, len(args))
+	for i, arg := range args {
+		hint := ""
+		if i < len(types) {
+			hint = strings.ToLower(strings.TrimSpace(types[i]))
+		}
+
+		switch v := arg.(type) {
+		case map[string]interface{}:
+			data, err := json.Marshal(v)
+			if err != nil {
+				return nil, fmt.Errorf("parameter $%d: %w", i+1, err)
+			}
+			coerced[i] = string(data)
+		case []interface{}:
+			if hint == "json" || hint == "jsonb" || (!strings.HasSuffix(hint, "[]") && hasNestedValues(v)) {
+				data, err := json.Marshal(v)
+				if err != nil {
+					return nil, fmt.Errorf("parameter $%d: %w", i+1, err)
+				}
+				coerced[i] = string(data)
+			} else if hasNestedValues(v) {
+				coerced[i] = nestedArray(v)
+			} else {
+				coerced[i] = pq.Array(v)
+			}
+		default:
+			if hint == "json" || hint == "jsonb" {
+				data, err := json.Marshal(v)
+				if err != nil {
+					return nil, fmt.Errorf("parameter $%d: %w", i+1, err)
+				}
+				coerced[i] = string(data)
+			} else {
+				coerced[i] = arg
+			}
+		}
+	}
+	return coerced, nil
+}
+
+// hasNestedValues reports whether an array holds objects or arrays, which only JSON can represent
+func hasNestedValues(values []interface{}) bool {
+	for _, val := range values {
+		switch val.(type) {
+		case map[string]interface{}, []interface{}:
+			return true
+		}
+	}
+	return false
+}
+
+// nestedArray binds a multi-dimensional array such as [[1,2],[3,4]], whose
+// inner arrays pq.Array cannot render, as a Postgres array literal
+type nestedArray []interface{}
+
+// Value implements driver.Valuer
+func (a nestedArray) Value() (driver.Value, error) {
+	if !hasNestedValues(a) {
+		return pq.Array([]interface{}(a)).Value()
+	}
+	parts := make([]string, len(a))
+	for i, elem := range a {
+		sub, ok := elem.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("array mixes nested arrays with other values")
+		}
+		val, err := nestedArray(sub).Value()
+		if err != nil {
+			return nil, err
+		}
+		parts[i], _ = val.(string)
+	}
+	return "{" + strings.Join(parts, ",") + "}", nil
+}
+
+// argLiteral renders a coerced parameter as text for statements such as
+// EXECUTE that take literals rather than bind parameters
+func argLiteral(arg interface{}) (string, bool, error) {
+	if valuer, ok := arg.(driver.Valuer); ok {
+		val, err := valuer.Value()
+		if err != nil {
+			return "", false, err
+		}
+		arg = val
+	}
+	switch v := arg.(type) {
+	case nil:
+		return "", false, nil
+	case []byte:
+		return string(v), true, nil
+	default:
+		return fmt.Sprint(v), true, nil
+	}
+}
@@ -0,0 +1,103 @@
+package server
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestCoerceArgs(t *testing.T) {
+	tests := []struct {
+		name  string
+		arg   interface{}
+		hint  string
+		want  string
+		valid bool
+	}{
+		{"object", map[string]interface{}{"a": float64(1)}, "", `{"a":1}`, true},
+		{"jsonb array", []interface{}{float64(1), "two"}, "jsonb", `[1,"two"]`, true},
+		{"nested array", []interface{}{map[string]interface{}{"a": true}}, "", `[{"a":true}]`, true},
+		{"int array", []interface{}{float64(1), float64(2), float64(3)}, "", "{1,2,3}", true},
+		{"int array hint", []interface{}{float64(1), float64(2)}, "int[]", "{1,2}", true},
+		{"nested int array", []interface{}{[]interface{}{float64(1), float64(2)}, []interface{}{float64(3), float64(4)}}, "int[]", "{{1,2},{3,4}}", true},
+		{"nested text array", []interface{}{[]interface{}{"a", nil}, []interface{}{"b", "c"}}, "text[]", `{{"a",NULL},{"b","c"}}`, true},
+		{"text array", []interface{}{"a", "b c", `q"uote`}, "text[]", `{"a","b c","q\"uote"}`, true},
+		{"jsonb scalar", "hello", "JSONB", `"hello"`, true},
+		{"plain scalar", float64(7), "", "7", true},
+		{"null", nil, "", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			coerced, err := coerceArgs([]interface{}{tt.arg}, []string{tt.hint})
+			if err != nil {
+				t.Fatalf("coerceArgs: %v", err)
+			}
+			got, valid, err := argLiteral(coerced[0])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want || valid != tt.valid {
+				t.Errorf("literal = %q (valid %v), want %q (valid %v)", got, valid, tt.want, tt.valid)
+			}
+		})
+	}
+
+	coerced, err := coerceArgs([]interface{}{[]interface{}{[]interface{}{float64(1)}, float64(2)}}, []string{"int[]"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := argLiteral(coerced[0]); err == nil {
+		t.Error("array mixing nested arrays and scalars was accepted")
+	}
+
+	if args, err := coerceArgs(nil, []string{"int"}); err != nil || args != nil {
+		t.Errorf("no args: %v, %v", args, err)
+	}
+}
+
+func TestJSONAndArrayParameters(t *testing.T) {
+	db := testDB(t)
+	schema := testSchema(t, db, "CREATE TABLE docs (id int, body jsonb, scores int[], tags text[])")
+	ctx := context.Background()
+
+	grid := []interface{}{[]interface{}{float64(1), float64(2)}, []interface{}{float64(3), float64(4)}}
+	result, err := ExecuteQueryWithOptions(ctx, db, schema, "SELECT $1::int[] AS grid", []interface{}{grid}, QueryOptions{ArgTypes: []string{"int[]"}, NoCache: true})
+	if err != nil {
+		t.Fatalf("multi-dimensional array: %v", err)
+	}
+	if got := result["rows"].([]map[string]interface{})[0]["grid"]; !reflect.DeepEqual(got, []interface{}{
+		[]interface{}{int64(1), int64(2)}, []interface{}{int64(3), int64(4)},
+	}) {
+		t.Errorf("grid = %#v", got)
+	}
+
+	doc := map[string]interface{}{"title": "plan", "steps": []interface{}{"a", "b"}, "meta": map[string]interface{}{"draft": true}}
+	_, err = ExecuteQueryWithOptions(ctx, db, schema, "INSERT INTO docs VALUES ($1, $2, $3, $4)",
+		[]interface{}{float64(1), doc, []interface{}{float64(3), float64(1), float64(2)}, []interface{}{"x", "y z"}},
+		QueryOptions{})
+	if err != nil {
+		t.Fatalf("insert: %v", err)
+	}
+
+	// Filtering binds the same way
+	result, err = ExecuteQueryWithOptions(ctx, db, schema,
+		"SELECT body, scores, tags FROM docs WHERE body @> $1 AND scores && $2",
+		[]interface{}{map[string]interface{}{"title": "plan"}, []interface{}{float64(2)}},
+		QueryOptions{ArgTypes: []string{"jsonb", "int[]"}, NoCache: true})
+	if err != nil {
+		t.Fatalf("select: %v", err)
+	}
+	rows := result["rows"].([]map[string]interface{})
+	if len(rows) != 1 {
+		t.Fatalf("got %d rows, want 1", len(rows))
+	}
+	if body := rows[0]["body"].(map[string]interface{}); body["title"] != "plan" || !reflect.DeepEqual(body["meta"], map[string]interface{}{"draft": true}) {
+		t.Errorf("body = %v", body)
+	}
+	if scores := rows[0]["scores"]; !reflect.DeepEqual(scores, []interface{}{int64(3), int64(1), int64(2)}) {
+		t.Errorf("scores = %#v", scores)
+	}
+	if tags := rows[0]["tags"]; !reflect.DeepEqual(tags, []interface{}{"x", "y z"}) {
+		t.Errorf("tags = %#v", tags)
+	}
+}
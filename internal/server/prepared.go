@@ -0,0 +1,244 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+
+	"github.com/lib/pq"
+)
+
+// ErrStatementNotFound is returned when executing or deallocating a statement the session never prepared
+var ErrStatementNotFound = errors.New("prepared statement not found in this session")
+
+// PrepareStatement creates a server-side prepared statement on the session's
+// pinned connection, replacing any statement of the same name, and returns the
+// parameter types Postgres inferred for it. The body must be a single statement,
+// and one reading tables the access rules deny is deallocated again.
+func PrepareStatement(ctx context.Context, sess *Session, schema, name, query string) (map[string]interface{}, error) {
+	var paramTypes []string
+	err := sess.Do(func(conn *sql.Conn) error {
+		created := false
+		err := inSnapshot(ctx, sess, conn, func() error {
+			if _, err := conn.ExecContext(ctx, fmt.Sprintf("SET search_path TO %s", pq.QuoteIdentifier(schema))); err != nil {
+				return fmt.Errorf("failed to set schema: %w", err)
+			}
+
+			if _, ok := sess.prepared[name]; ok {
+				if _, err := conn.ExecContext(ctx, "DEALLOCATE "+pq.QuoteIdentifier(name)); err != nil {
+					return fmt.Errorf("failed to replace statement: %w", err)
+				}
+				delete(sess.prepared, name)
+			}
+			// PREPARE is sent as a simple query, which would run any further statements
+			if err := requireSingleStatement(ctx, conn, query, nil); err != nil {
+				return err
+			}
+			if _, err := conn.ExecContext(ctx, fmt.Sprintf("PREPARE %s AS %s", pq.QuoteIdentifier(name), query)); err != nil {
+				return fmt.Errorf("prepare error: %w", err)
+			}
+			created = true
+
+			if err := conn.QueryRowContext(ctx,
+				"SELECT parameter_types::text[] FROM pg_catalog.pg_prepared_statements WHERE name = $1",
+				name,
+			).Scan(pq.Array(&paramTypes)); err != nil {
+				return err
+			}
+			return checkPreparedTables(ctx, conn, name, len(paramTypes))
+		})
+		if err != nil {
+			// Prepared statements are not transactional, so one that failed the
+			// checks is dropped once any snapshot savepoint has been rolled back
+			if created {
+				conn.ExecContext(context.Background(), "DEALLOCATE "+pq.QuoteIdentifier(name))
+			}
+			return err
+		}
+		sess.prepared[name] = query
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]interface{}{
+		"name":            name,
+		"parameter_types": paramTypes,
+	}, nil
+}
+
+var validateSeq uint64
+
+// ValidateQuery checks that a statement parses and type-checks by preparing it
+// on a dedicated connection without executing it, returning the parameter types
+// Postgres inferred and, on Postgres 16 and later, the result column types. A
+// statement that fails to prepare is reported with valid false and the reason.
+// The statement is deallocated and the transaction rolled back either way.
+func ValidateQuery(ctx context.Context, db *sql.DB, schema, query string) (map[string]interface{}, error) {
+	version, err := serverVersionNum(db)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read server version: %w", err)
+	}
+
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Close()
+	tx, err := conn.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, fmt.Sprintf("SET LOCAL search_path TO %s", pq.QuoteIdentifier(schema))); err != nil {
+		return nil, fmt.Errorf("failed to set schema: %w", err)
+	}
+	// PREPARE is sent as a simple query, which would run any further statements
+	if err := requireSingleStatement(ctx, tx, query, nil); err != nil {
+		msg := SanitizeError(err).Error()
+		if errors.Is(err, ErrMultipleStatements) {
+			msg = "only a single statement can be validated"
+		}
+		return map[string]interface{}{
+			"valid": false,
+			"error": msg,
+		}, nil
+	}
+
+	name := fmt.Sprintf("mcp_validate_%d", atomic.AddUint64(&validateSeq, 1))
+	if _, err := tx.ExecContext(ctx, fmt.Sprintf("PREPARE %s AS %s", pq.QuoteIdentifier(name), query)); err != nil {
+		return map[string]interface{}{
+			"valid": false,
+			"error": SanitizeError(err).Error(),
+		}, nil
+	}
+	// Prepared statements outlive the transaction, so the statement is deallocated
+	// on the connection after the rollback, even if reading its metadata failed
+	defer func() {
+		tx.Rollback()
+		conn.ExecContext(context.Background(), "DEALLOCATE "+pq.QuoteIdentifier(name))
+	}()
+
+	var paramTypes, resultTypes []string
+	if version >= 160000 {
+		err = tx.QueryRowContext(ctx,
+			"SELECT parameter_types::text[], COALESCE(result_types::text[], '{}') FROM pg_catalog.pg_prepared_statements WHERE name = $1",
+			name,
+		).Scan(pq.Array(&paramTypes), pq.Array(&resultTypes))
+	} else {
+		err = tx.QueryRowContext(ctx,
+			"SELECT parameter_types::text[] FROM pg_catalog.pg_prepared_statements WHERE name = $1",
+			name,
+		).Scan(pq.Array(&paramTypes))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read statement metadata: %w", err)
+	}
+	if paramTypes == nil {
+		paramTypes = []string{}
+	}
+	if resultTypes == nil {
+		resultTypes = []string{}
+	}
+
+	// The result types would describe the tables the statement reads
+	if err := checkPreparedTables(ctx, tx, name, len(paramTypes)); err != nil {
+		return nil, err
+	}
+
+	result := map[string]interface{}{
+		"valid":           true,
+		"parameter_types": paramTypes,
+	}
+	if version >= 160000 {
+		result["result_types"] = resultTypes
+	}
+	return result, nil
+}
+
+// checkPreparedTables checks the tables a prepared statement reads against the
+// access rules, explaining it with null parameters, while any are configured
+func checkPreparedTables(ctx context.Context, q queryRower, name string, numParams int) error {
+	if !tableAccessRestricted() {
+		return nil
+	}
+	stmt := "EXECUTE " + pq.QuoteIdentifier(name)
+	if numParams > 0 {
+		stmt += "(" + strings.TrimSuffix(strings.Repeat("NULL, ", numParams), ", ") + ")"
+	}
+	_, err := checkQueryTables(ctx, q, stmt, nil, true)
+	return err
+}
+
+// ExecutePrepared runs a statement prepared earlier in the same session with the
+// given parameters. Parameters are sent as quoted literals, so Postgres coerces
+// them to the statement's declared parameter types. It runs in the session's
+// snapshot when one is open.
+func ExecutePrepared(ctx context.Context, sess *Session, schema, name string, params []interface{}, opts QueryOptions) (map[string]interface{}, error) {
+	opts.Session = sess
+	params, err := coerceArgs(params, opts.ArgTypes)
+	if err != nil {
+		return nil, err
+	}
+	literals := make([]string, len(params))
+	for i, param := range params {
+		text, ok, err := argLiteral(param)
+		if err != nil {
+			return nil, fmt.Errorf("parameter $%d: %w", i+1, err)
+		}
+		if ok {
+			literals[i] = pq.QuoteLiteral(text)
+		} else {
+			literals[i] = "NULL"
+		}
+	}
+	stmt := "EXECUTE " + pq.QuoteIdentifier(name)
+	if len(literals) > 0 {
+		stmt += "(" + strings.Join(literals, ", ") + ")"
+	}
+
+	var result map[string]interface{}
+	err = sess.Do(func(conn *sql.Conn) error {
+		if _, ok := sess.prepared[name]; !ok {
+			return fmt.Errorf("%w: %s", ErrStatementNotFound, name)
+		}
+
+		return inSnapshot(ctx, sess, conn, func() error {
+			var err error
+			result, err = executeOnConn(ctx, conn, schema, stmt, nil, opts)
+			return err
+		})
+	})
+	return result, err
+}
+
+// DeallocateStatement drops a prepared statement from the session
+func DeallocateStatement(ctx context.Context, sess *Session, name string) error {
+	return sess.Do(func(conn *sql.Conn) error {
+		if _, ok := sess.prepared[name]; !ok {
+			return fmt.Errorf("%w: %s", ErrStatementNotFound, name)
+		}
+		if _, err := conn.ExecContext(ctx, "DEALLOCATE "+pq.QuoteIdentifier(name)); err != nil {
+			return fmt.Errorf("deallocate error: %w", err)
+		}
+		delete(sess.prepared, name)
+		return nil
+	})
+}
+
+// PreparedStatements lists the statements prepared in the session with their SQL
+func PreparedStatements(sess *Session) map[string]string {
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+
+	statements := make(map[string]string, len(sess.prepared))
+	for name, query := range sess.prepared {
+		statements[name] = query
+	}
+	return statements
+}
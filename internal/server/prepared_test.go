@@ -0,0 +1,175 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestPrepareStatement(t *testing.T) {
+	db := testDB(t)
+	schema := testSchema(t, db,
+		"CREATE TABLE orders (id int, total numeric)",
+		"INSERT INTO orders VALUES (1, 10), (2, 20)",
+	)
+	sess := testSession(t, db)
+	ctx := context.Background()
+
+	prepared, err := PrepareStatement(ctx, sess, schema, "by_id", "SELECT total FROM orders WHERE id = $1")
+	if err != nil {
+		t.Fatalf("PrepareStatement: %v", err)
+	}
+	if types := prepared["parameter_types"].([]string); len(types) != 1 || types[0] != "integer" {
+		t.Errorf("parameter_types = %v, want [integer]", types)
+	}
+
+	result, err := ExecutePrepared(ctx, sess, schema, "by_id", []interface{}{float64(2)}, QueryOptions{})
+	if err != nil {
+		t.Fatalf("ExecutePrepared: %v", err)
+	}
+	if result["row_count"] != 1 {
+		t.Errorf("row_count = %v, want 1", result["row_count"])
+	}
+
+	// Preparing again under the same name replaces the statement
+	if _, err := PrepareStatement(ctx, sess, schema, "by_id", "SELECT id FROM orders WHERE total = $1"); err != nil {
+		t.Fatalf("replacing statement: %v", err)
+	}
+	if got := PreparedStatements(sess)["by_id"]; got != "SELECT id FROM orders WHERE total = $1" {
+		t.Errorf("prepared SQL = %q", got)
+	}
+
+	if err := DeallocateStatement(ctx, sess, "by_id"); err != nil {
+		t.Fatalf("DeallocateStatement: %v", err)
+	}
+	if _, err := ExecutePrepared(ctx, sess, schema, "by_id", nil, QueryOptions{}); !errors.Is(err, ErrStatementNotFound) {
+		t.Errorf("after deallocate: err = %v, want ErrStatementNotFound", err)
+	}
+}
+
+func TestPrepareStatementChecks(t *testing.T) {
+	db := testDB(t)
+	schema := testSchema(t, db,
+		"CREATE TABLE secret (id int, token text)",
+		"INSERT INTO secret VALUES (1, 'hunter2')",
+	)
+	setTestTableAccess(t, "", schema+".secret")
+	sess := testSession(t, db)
+	ctx := context.Background()
+
+	tests := []struct {
+		name  string
+		query string
+		want  error
+	}{
+		{"denied table", "SELECT token FROM secret WHERE id = $1", ErrAccessDenied},
+		{"write to a denied table", "UPDATE secret SET token = 'leaked'", ErrAccessDenied},
+		{"trailing statement", "SELECT 1; UPDATE secret SET token = 'leaked'", ErrMultipleStatements},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := PrepareStatement(ctx, sess, schema, "stmt", tt.query); !errors.Is(err, tt.want) {
+				t.Fatalf("err = %v, want %v", err, tt.want)
+			}
+			if _, ok := PreparedStatements(sess)["stmt"]; ok {
+				t.Fatal("rejected statement is listed as prepared")
+			}
+			// The name is free again, so nothing was left prepared on the connection
+			if _, err := PrepareStatement(ctx, sess, schema, "stmt", "SELECT 1"); err != nil {
+				t.Fatalf("reusing the name: %v", err)
+			}
+			if err := DeallocateStatement(ctx, sess, "stmt"); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+
+	var token string
+	if err := db.QueryRow("SELECT token FROM " + schema + ".secret").Scan(&token); err != nil {
+		t.Fatal(err)
+	}
+	if token != "hunter2" {
+		t.Fatalf("denied table was modified: token = %q", token)
+	}
+}
+
+func TestValidateQuery(t *testing.T) {
+	db := testDB(t)
+	schema := testSchema(t, db,
+		"CREATE TABLE orders (id int)",
+		"INSERT INTO orders VALUES (1)",
+	)
+	ctx := context.Background()
+
+	result, err := ValidateQuery(ctx, db, schema, "SELECT id FROM orders WHERE id = $1")
+	if err != nil {
+		t.Fatalf("ValidateQuery: %v", err)
+	}
+	if result["valid"] != true {
+		t.Fatalf("result = %v, want valid", result)
+	}
+
+	for _, query := range []string{
+		"SELECT idd FROM orders",
+		"SELECT 1; COMMIT; DELETE FROM orders",
+		// A semicolon hidden from a client-side lexer by an escaped quote
+		"SELECT E'\\''; COMMIT; DELETE FROM orders; SELECT ''",
+	} {
+		result, err := ValidateQuery(ctx, db, schema, query)
+		if err != nil {
+			t.Fatalf("%q: %v", query, err)
+		}
+		if result["valid"] != false {
+			t.Errorf("%q: result = %v, want invalid", query, result)
+		}
+	}
+
+	var count int
+	if err := db.QueryRow("SELECT count(*) FROM " + schema + ".orders").Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 {
+		t.Fatalf("validation modified the table: orders has %d rows", count)
+	}
+}
+
+func TestExecutePreparedInSnapshot(t *testing.T) {
+	db := testDB(t)
+	schema := testSchema(t, db,
+		"CREATE TABLE orders (id int, total int)",
+		"INSERT INTO orders VALUES (1, 10)",
+	)
+	setTestQueryTimeouts(t, 10*time.Second, time.Minute)
+	sess := testSession(t, db)
+	ctx, cancel := WithQueryTimeout(context.Background(), 0)
+	defer cancel()
+
+	if _, err := PrepareStatement(ctx, sess, schema, "totals", "SELECT sum(total) AS total FROM orders"); err != nil {
+		t.Fatalf("PrepareStatement: %v", err)
+	}
+	if _, err := BeginSnapshot(ctx, sess, ""); err != nil {
+		t.Fatalf("BeginSnapshot: %v", err)
+	}
+	mustExec(t, db, "INSERT INTO "+schema+".orders VALUES (2, 20)")
+
+	result, err := ExecutePrepared(ctx, sess, schema, "totals", nil, QueryOptions{})
+	if err != nil {
+		t.Fatalf("ExecutePrepared in a snapshot: %v", err)
+	}
+	if total := result["rows"].([]map[string]interface{})[0]["total"]; total != int64(10) {
+		t.Errorf("prepared total = %v, want the snapshot's 10", total)
+	}
+
+	// The snapshot is still open for the next query
+	result, err = ExecuteQueryWithOptions(ctx, db, schema, "SELECT count(*) AS n FROM orders", nil, QueryOptions{Session: sess, NoCache: true})
+	if err != nil {
+		t.Fatalf("query after executePrepared: %v", err)
+	}
+	if n := result["rows"].([]map[string]interface{})[0]["n"]; n != int64(1) {
+		t.Errorf("count = %v, want the snapshot's 1", n)
+	}
+	if _, err := EndSnapshot(ctx, sess); err != nil {
+		t.Fatalf("EndSnapshot: %v", err)
+	}
+}
@@ -0,0 +1,241 @@
+package server
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Ranking of section severities in a database profile
+var severityRank = map[string]int{"ok": 0, SeverityInfo: 1, SeverityWarning: 2, SeverityCritical: 3}
+
+// GetTopStatements returns the statements with the highest total execution time
+// from pg_stat_statements, or an error if the extension is not installed
+func GetTopStatements(db *sql.DB, limit int) ([]map[string]interface{}, error) {
+	var installed bool
+	if err := db.QueryRow("SELECT EXISTS (SELECT 1 FROM pg_catalog.pg_extension WHERE extname = 'pg_stat_statements')").Scan(&installed); err != nil {
+		return nil, err
+	}
+	if !installed {
+		return nil, fmt.Errorf("pg_stat_statements is not installed")
+	}
+	version, err := serverVersionNum(db)
+	if err != nil {
+		return nil, err
+	}
+
+	// The timing columns were renamed in PostgreSQL 13
+	totalCol, meanCol := "total_exec_time", "mean_exec_time"
+	if version < 130000 {
+		totalCol, meanCol = "total_time", "mean_time"
+	}
+	rows, err := db.Query(fmt.Sprintf(`
+		SELECT query, calls, %s, %s, rows
+		FROM pg_stat_statements
+		WHERE dbid = (SELECT oid FROM pg_catalog.pg_database WHERE datname = current_database())
+		ORDER BY %s DESC
+		LIMIT $1;
+	`, totalCol, meanCol, totalCol), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	statements := []map[string]interface{}{}
+	for rows.Next() {
+		var query string
+		var calls, rowCount int64
+		var totalMs, meanMs float64
+		if err := rows.Scan(&query, &calls, &totalMs, &meanMs, &rowCount); err != nil {
+			return nil, err
+		}
+		statements = append(statements, map[string]interface{}{
+			"query":         query,
+			"calls":         calls,
+			"total_time_ms": totalMs,
+			"mean_time_ms":  meanMs,
+			"rows":          rowCount,
+		})
+	}
+	return statements, rows.Err()
+}
+
+// GetLockContention returns the sessions currently waiting on locks held by other sessions
+func GetLockContention(db *sql.DB, limit int) ([]map[string]interface{}, error) {
+	rows, err := db.Query(`
+		SELECT pid, pg_catalog.pg_blocking_pids(pid)::int[], wait_event_type, wait_event,
+			EXTRACT(EPOCH FROM now() - query_start) * 1000, query
+		FROM pg_catalog.pg_stat_activity
+		WHERE cardinality(pg_catalog.pg_blocking_pids(pid)) > 0
+		ORDER BY query_start
+		LIMIT $1;
+	`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	blocked := []map[string]interface{}{}
+	for rows.Next() {
+		var pid int64
+		var blockedBy []int64
+		var waitType, waitEvent, query sql.NullString
+		var waitingMs sql.NullFloat64
+		if err := rows.Scan(&pid, pq.Array(&blockedBy), &waitType, &waitEvent, &waitingMs, &query); err != nil {
+			return nil, err
+		}
+		blocked = append(blocked, map[string]interface{}{
+			"pid":             pid,
+			"blocked_by":      blockedBy,
+			"wait_event_type": waitType.String,
+			"wait_event":      waitEvent.String,
+			"waiting_ms":      int64(waitingMs.Float64),
+			"query":           query.String,
+		})
+	}
+	return blocked, rows.Err()
+}
+
+// GetDeadTupleTables returns the tables whose dead tuples exceed minRatio of all their tuples
+func GetDeadTupleTables(db *sql.DB, minRatio float64, limit int) ([]map[string]interface{}, error) {
+	rows, err := db.Query(`
+		SELECT schemaname, relname, n_live_tup, n_dead_tup,
+			n_dead_tup::float8 / NULLIF(n_live_tup + n_dead_tup, 0),
+			GREATEST(last_vacuum, last_autovacuum)
+		FROM pg_catalog.pg_stat_user_tables
+		WHERE n_dead_tup > 1000
+			AND n_dead_tup::float8 / NULLIF(n_live_tup + n_dead_tup, 0) >= $1
+		ORDER BY n_dead_tup DESC
+		LIMIT $2;
+	`, minRatio, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tables := []map[string]interface{}{}
+	for rows.Next() {
+		var schema, table string
+		var live, dead int64
+		var ratio float64
+		var lastVacuum sql.NullTime
+		if err := rows.Scan(&schema, &table, &live, &dead, &ratio, &lastVacuum); err != nil {
+			return nil, err
+		}
+		entry := map[string]interface{}{
+			"schema":           schema,
+			"table":            table,
+			"live_tuples":      live,
+			"dead_tuples":      dead,
+			"dead_tuple_ratio": ratio,
+		}
+		if lastVacuum.Valid {
+			entry["last_vacuum"] = lastVacuum.Time
+		}
+		tables = append(tables, entry)
+	}
+	return tables, rows.Err()
+}
+
+// GetConnectionSaturation compares the open connections with max_connections
+func GetConnectionSaturation(db *sql.DB) (map[string]interface{}, error) {
+	var total, active, idleInTx, maxConnections int64
+	err := db.QueryRow(`
+		SELECT count(*),
+			count(*) FILTER (WHERE state = 'active'),
+			count(*) FILTER (WHERE state LIKE 'idle in transaction%'),
+			current_setting('max_connections')::int
+		FROM pg_catalog.pg_stat_activity
+		WHERE backend_type = 'client backend';
+	`).Scan(&total, &active, &idleInTx, &maxConnections)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{
+		"connections":         total,
+		"active":              active,
+		"idle_in_transaction": idleInTx,
+		"max_connections":     maxConnections,
+		"utilization":         float64(total) / float64(maxConnections),
+	}, nil
+}
+
+// GetDatabaseProfile composes the slow query, lock contention, dead tuple and
+// connection diagnostics into one report. Each section carries its own severity
+// and degrades to an error note when its source is unavailable; the overall
+// severity is the worst of the sections.
+func GetDatabaseProfile(db *sql.DB) map[string]interface{} {
+	const limit = 10
+	sections := map[string]interface{}{}
+	overall := "ok"
+	addSection := func(name string, data interface{}, severity string, err error) {
+		section := map[string]interface{}{"severity": severity}
+		if err != nil {
+			section["available"] = false
+			section["error"] = err.Error()
+		} else {
+			section["available"] = true
+			section["data"] = data
+		}
+		sections[name] = section
+		if severityRank[severity] > severityRank[overall] {
+			overall = severity
+		}
+	}
+
+	// Slow queries fall back to this server's own history without pg_stat_statements
+	if statements, err := GetTopStatements(db, limit); err == nil {
+		addSection("slow_queries", map[string]interface{}{"source": "pg_stat_statements", "statements": statements}, "ok", nil)
+	} else {
+		report := SlowQueryReport(time.Second, limit)
+		severity := "ok"
+		if len(report) > 0 {
+			severity = SeverityInfo
+		}
+		addSection("slow_queries", map[string]interface{}{
+			"source":     "server query history",
+			"note":       err.Error(),
+			"statements": report,
+		}, severity, nil)
+	}
+
+	blocked, err := GetLockContention(db, limit)
+	severity := "ok"
+	switch {
+	case err != nil:
+		severity = SeverityInfo
+	case len(blocked) >= 5:
+		severity = SeverityCritical
+	case len(blocked) > 0:
+		severity = SeverityWarning
+	}
+	addSection("lock_contention", blocked, severity, err)
+
+	deadTables, err := GetDeadTupleTables(db, 0.2, limit)
+	severity = "ok"
+	if err != nil {
+		severity = SeverityInfo
+	} else if len(deadTables) > 0 {
+		severity = SeverityWarning
+	}
+	addSection("dead_tuples", deadTables, severity, err)
+
+	connections, err := GetConnectionSaturation(db)
+	severity = "ok"
+	if err != nil {
+		severity = SeverityInfo
+	} else if utilization := connections["utilization"].(float64); utilization >= 0.9 {
+		severity = SeverityCritical
+	} else if utilization >= 0.75 {
+		severity = SeverityWarning
+	}
+	addSection("connections", connections, severity, err)
+
+	return map[string]interface{}{
+		"severity":     overall,
+		"generated_at": time.Now(),
+		"sections":     sections,
+	}
+}
@@ -0,0 +1,207 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultQueryRunTTL is how long a stored run can serve as a diff baseline
+	defaultQueryRunTTL = 30 * time.Minute
+	// maxStoredQueryRuns bounds the memory held by stored runs; the oldest is evicted first
+	maxStoredQueryRuns = 100
+)
+
+// ErrRunNotFound is returned when a baseline run ID is unknown or expired
+var ErrRunNotFound = errors.New("query run not found or expired")
+
+// queryRun is one stored execution of a query, indexed by key column value
+type queryRun struct {
+	query     string
+	keyColumn string
+	rows      map[string]map[string]interface{}
+	storedAt  time.Time
+}
+
+// queryRunStore keeps recent query runs so later executions can be diffed against them
+type queryRunStore struct {
+	mu   sync.Mutex
+	ttl  time.Duration
+	runs map[string]*queryRun
+}
+
+var queryRuns = &queryRunStore{ttl: defaultQueryRunTTL, runs: make(map[string]*queryRun)}
+
+// SetQueryRunTTL changes how long stored query runs remain available as baselines
+func SetQueryRunTTL(ttl time.Duration) {
+	queryRuns.mu.Lock()
+	defer queryRuns.mu.Unlock()
+	if ttl > 0 {
+		queryRuns.ttl = ttl
+	}
+}
+
+func (s *queryRunStore) put(run *queryRun) string {
+	idBytes := make([]byte, 12)
+	rand.Read(idBytes)
+	id := hex.EncodeToString(idBytes)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var oldestID string
+	var oldest time.Time
+	for runID, r := range s.runs {
+		if time.Since(r.storedAt) > s.ttl {
+			delete(s.runs, runID)
+			continue
+		}
+		if oldestID == "" || r.storedAt.Before(oldest) {
+			oldestID, oldest = runID, r.storedAt
+		}
+	}
+	if len(s.runs) >= maxStoredQueryRuns {
+		delete(s.runs, oldestID)
+	}
+
+	run.storedAt = time.Now()
+	s.runs[id] = run
+	return id
+}
+
+func (s *queryRunStore) get(id string) (*queryRun, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	run, ok := s.runs[id]
+	if !ok || time.Since(run.storedAt) > s.ttl {
+		delete(s.runs, id)
+		return nil, false
+	}
+	return run, true
+}
+
+// DiffQueryRun executes query, stores the result under a new run ID and, when
+// baselineRunID is given, reports the rows added, removed and changed since that
+// run, matching rows by keyColumn. Without a baseline only the run ID is returned.
+func DiffQueryRun(ctx context.Context, db *sql.DB, schema, query, keyColumn, baselineRunID string, opts QueryOptions) (map[string]interface{}, error) {
+	var baseline *queryRun
+	if baselineRunID != "" {
+		var ok bool
+		if baseline, ok = queryRuns.get(baselineRunID); !ok {
+			return nil, fmt.Errorf("%w: %s", ErrRunNotFound, baselineRunID)
+		}
+		if baseline.query != query || baseline.keyColumn != keyColumn {
+			return nil, fmt.Errorf("run %s was for a different query or key column", baselineRunID)
+		}
+	}
+
+	result, err := ExecuteQueryWithOptions(ctx, db, schema, query, nil, opts)
+	if err != nil {
+		return nil, err
+	}
+	cols, _ := result["columns"].([]string)
+	rows, _ := result["rows"].([]map[string]interface{})
+
+	hasKey := false
+	for _, col := range cols {
+		hasKey = hasKey || col == keyColumn
+	}
+	if !hasKey {
+		return nil, fmt.Errorf("key column %q is not in the query result", keyColumn)
+	}
+
+	current := make(map[string]map[string]interface{}, len(rows))
+	for _, row := range rows {
+		key := fmt.Sprint(row[keyColumn])
+		if _, dup := current[key]; dup {
+			return nil, fmt.Errorf("key column %q is not unique in the query result (duplicate %s)", keyColumn, key)
+		}
+		current[key] = row
+	}
+
+	runID := queryRuns.put(&queryRun{query: query, keyColumn: keyColumn, rows: current})
+	diff := map[string]interface{}{
+		"run_id":    runID,
+		"row_count": len(rows),
+	}
+	if baseline == nil {
+		return diff, nil
+	}
+
+	added := []map[string]interface{}{}
+	removed := []map[string]interface{}{}
+	changed := []map[string]interface{}{}
+	unchanged := 0
+	for _, key := range sortedKeys(current) {
+		row := current[key]
+		before, ok := baseline.rows[key]
+		if !ok {
+			added = append(added, row)
+			continue
+		}
+		if changedCols := changedColumns(before, row); len(changedCols) > 0 {
+			changed = append(changed, map[string]interface{}{
+				"key":             row[keyColumn],
+				"changed_columns": changedCols,
+				"before":          before,
+				"after":           row,
+			})
+		} else {
+			unchanged++
+		}
+	}
+	for _, key := range sortedKeys(baseline.rows) {
+		if _, ok := current[key]; !ok {
+			removed = append(removed, baseline.rows[key])
+		}
+	}
+
+	diff["baseline_run_id"] = baselineRunID
+	diff["added"] = added
+	diff["removed"] = removed
+	diff["changed"] = changed
+	diff["unchanged_count"] = unchanged
+	return diff, nil
+}
+
+// changedColumns lists the columns whose values differ between two versions of a row
+func changedColumns(before, after map[string]interface{}) []string {
+	var cols []string
+	for col, val := range after {
+		if !sameValue(before[col], val) {
+			cols = append(cols, col)
+		}
+	}
+	for col := range before {
+		if _, ok := after[col]; !ok {
+			cols = append(cols, col)
+		}
+	}
+	sort.Strings(cols)
+	return cols
+}
+
+// sameValue compares two result values by their JSON encoding, which is how clients see them
+func sameValue(a, b interface{}) bool {
+	aJSON, errA := json.Marshal(a)
+	bJSON, errB := json.Marshal(b)
+	return errA == nil && errB == nil && string(aJSON) == string(bJSON)
+}
+
+func sortedKeys(rows map[string]map[string]interface{}) []string {
+	keys := make([]string, 0, len(rows))
+	for key := range rows {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,120 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestChangedColumns(t *testing.T) {
+	tests := []struct {
+		name          string
+		before, after map[string]interface{}
+		want          string
+	}{
+		{"identical", map[string]interface{}{"id": 1, "name": "a"}, map[string]interface{}{"id": 1, "name": "a"}, ""},
+		{"value changed", map[string]interface{}{"id": 1, "name": "a"}, map[string]interface{}{"id": 1, "name": "b"}, "name"},
+		{"became null", map[string]interface{}{"id": 1, "name": "a"}, map[string]interface{}{"id": 1, "name": nil}, "name"},
+		{"same json encoding", map[string]interface{}{"n": int64(1)}, map[string]interface{}{"n": float64(1)}, ""},
+		{"column added and removed", map[string]interface{}{"id": 1, "old": 1}, map[string]interface{}{"id": 1, "new": 1}, "new,old"},
+	}
+	for _, tt := range tests {
+		if got := strings.Join(changedColumns(tt.before, tt.after), ","); got != tt.want {
+			t.Errorf("%s: changedColumns = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestQueryRunStore(t *testing.T) {
+	s := &queryRunStore{ttl: time.Minute, runs: make(map[string]*queryRun)}
+	first := s.put(&queryRun{query: "SELECT 1"})
+	if _, ok := s.get(first); !ok {
+		t.Fatal("stored run was not found")
+	}
+
+	s.runs[first].storedAt = time.Now().Add(-2 * time.Minute)
+	if _, ok := s.get(first); ok {
+		t.Error("expired run was returned")
+	}
+
+	// The oldest run makes room once the store is full
+	oldest := s.put(&queryRun{query: "oldest"})
+	s.runs[oldest].storedAt = time.Now().Add(-time.Second)
+	for i := 1; i < maxStoredQueryRuns; i++ {
+		s.put(&queryRun{query: "SELECT 1"})
+	}
+	latest := s.put(&queryRun{query: "latest"})
+	if len(s.runs) != maxStoredQueryRuns {
+		t.Errorf("store holds %d runs, want %d", len(s.runs), maxStoredQueryRuns)
+	}
+	if _, ok := s.get(oldest); ok {
+		t.Error("oldest run was not evicted")
+	}
+	if _, ok := s.get(latest); !ok {
+		t.Error("latest run is missing")
+	}
+}
+
+func TestDiffQueryRun(t *testing.T) {
+	db := testDB(t)
+	schema := testSchema(t, db,
+		"CREATE TABLE jobs (id int, state text)",
+		"INSERT INTO jobs VALUES (1, 'queued'), (2, 'queued'), (3, 'done')",
+	)
+	ctx := context.Background()
+	query := "SELECT id, state FROM jobs ORDER BY id"
+	opts := QueryOptions{NoCache: true}
+
+	first, err := DiffQueryRun(ctx, db, schema, query, "id", "", opts)
+	if err != nil {
+		t.Fatalf("first run: %v", err)
+	}
+	runID, _ := first["run_id"].(string)
+	if runID == "" || first["added"] != nil {
+		t.Fatalf("first run = %v, want only a run ID and row count", first)
+	}
+
+	mustExec(t, db, "UPDATE "+schema+".jobs SET state = 'running' WHERE id = 1")
+	mustExec(t, db, "DELETE FROM "+schema+".jobs WHERE id = 3")
+	mustExec(t, db, "INSERT INTO "+schema+".jobs VALUES (4, 'queued')")
+
+	diff, err := DiffQueryRun(ctx, db, schema, query, "id", runID, opts)
+	if err != nil {
+		t.Fatalf("second run: %v", err)
+	}
+	keys := func(rows []map[string]interface{}, col string) []interface{} {
+		var out []interface{}
+		for _, row := range rows {
+			out = append(out, row[col])
+		}
+		return out
+	}
+	if got := keys(diff["added"].([]map[string]interface{}), "id"); len(got) != 1 || got[0] != int64(4) {
+		t.Errorf("added = %v, want [4]", got)
+	}
+	if got := keys(diff["removed"].([]map[string]interface{}), "id"); len(got) != 1 || got[0] != int64(3) {
+		t.Errorf("removed = %v, want [3]", got)
+	}
+	changed := diff["changed"].([]map[string]interface{})
+	if len(changed) != 1 || changed[0]["key"] != int64(1) || strings.Join(changed[0]["changed_columns"].([]string), ",") != "state" {
+		t.Errorf("changed = %v, want id 1 with state changed", changed)
+	}
+	if diff["unchanged_count"] != 1 || diff["baseline_run_id"] != runID {
+		t.Errorf("unchanged_count = %v, baseline_run_id = %v", diff["unchanged_count"], diff["baseline_run_id"])
+	}
+
+	if _, err := DiffQueryRun(ctx, db, schema, query, "id", "unknown", opts); !errors.Is(err, ErrRunNotFound) {
+		t.Errorf("unknown baseline: err = %v, want ErrRunNotFound", err)
+	}
+	if _, err := DiffQueryRun(ctx, db, schema, "SELECT id FROM jobs", "id", runID, opts); err == nil {
+		t.Error("baseline from a different query was accepted")
+	}
+	if _, err := DiffQueryRun(ctx, db, schema, query, "missing", "", opts); err == nil {
+		t.Error("key column missing from the result was accepted")
+	}
+	if _, err := DiffQueryRun(ctx, db, schema, "SELECT state FROM jobs", "state", "", opts); err == nil {
+		t.Error("non-unique key column was accepted")
+	}
+}
@@ -0,0 +1,67 @@
+package server
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrRateLimited is returned when a query is rejected by the rate limiter
+var ErrRateLimited = errors.New("rate limit exceeded")
+
+// tokenBucket refills at rate tokens per second up to burst tokens
+type tokenBucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// allow takes a token if one is available at now
+func (b *tokenBucket) allow(now time.Time) bool {
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+var (
+	rateLimitMu  sync.Mutex
+	queryLimiter *tokenBucket
+)
+
+// SetRateLimit limits query execution to rps queries per second with bursts of
+// up to burst queries; a non-positive rps disables the limit. The limit is
+// global for now; keying it per session would let one noisy client be throttled
+// without affecting the others.
+func SetRateLimit(rps float64, burst int) {
+	rateLimitMu.Lock()
+	defer rateLimitMu.Unlock()
+
+	if rps <= 0 {
+		queryLimiter = nil
+		return
+	}
+	if burst < 1 {
+		burst = 1
+	}
+	queryLimiter = &tokenBucket{rate: rps, burst: float64(burst), tokens: float64(burst), last: time.Now()}
+}
+
+// AllowQuery reports ErrRateLimited when the query rate limit is exhausted.
+// Callers reject the query rather than waiting for a token.
+func AllowQuery() error {
+	rateLimitMu.Lock()
+	defer rateLimitMu.Unlock()
+
+	if queryLimiter != nil && !queryLimiter.allow(time.Now()) {
+		return ErrRateLimited
+	}
+	return nil
+}
@@ -0,0 +1,172 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// readOnlyStartPattern matches statements that can only read, by their first keyword
+var readOnlyStartPattern = regexp.MustCompile(`^(select|with|values|table)\b`)
+
+// writePattern matches keywords and built-in functions with side effects. It is
+// applied to the normalized query, so string literals and comments cannot trigger it.
+var writePattern = regexp.MustCompile(`\b(insert|update|delete|merge|into|for update|for no key update|for share|for key share|nextval|setval|pg_advisory_\w*|pg_notify|set_config|pg_terminate_backend|pg_cancel_backend|lo_\w+|dblink\w*)\b`)
+
+// isReadOnlyQuery reports whether a query is a single statement that cannot
+// change data, judged from its text. User-defined functions are not inspected,
+// so a SELECT calling a function that writes is still treated as read-only;
+// isCacheableQuery is the stricter check.
+func isReadOnlyQuery(query string) bool {
+	normalized := strings.TrimSuffix(strings.TrimSpace(NormalizeQuery(query)), ";")
+	if strings.Contains(normalized, ";") {
+		return false
+	}
+	return readOnlyStartPattern.MatchString(normalized) && !writePattern.MatchString(normalized)
+}
+
+// callPattern matches a name or quoted identifier followed by an opening
+// parenthesis, which is either a function call or SQL syntax such as IN (...)
+var callPattern = regexp.MustCompile(`(::\s*)?("[^"]*"|[a-z_][a-z0-9_$.]*)\s*\(`)
+
+// nonCallWords precede a parenthesis without calling a function: keywords,
+// type modifiers such as varchar(10), and built-ins that neither write nor
+// depend on anything but their arguments and the rows read
+var nonCallWords = map[string]bool{
+	"select": true, "from": true, "join": true, "lateral": true, "where": true, "and": true, "or": true, "not": true,
+	"in": true, "exists": true, "any": true, "all": true, "some": true, "values": true, "as": true, "on": true,
+	"using": true, "by": true, "having": true, "when": true, "then": true, "else": true, "is": true, "like": true,
+	"ilike": true, "between": true, "union": true, "intersect": true, "except": true, "over": true, "filter": true,
+	"group": true, "row": true, "array": true, "cast": true, "distinct": true, "limit": true, "offset": true,
+	"varchar": true, "char": true, "character": true, "varying": true, "numeric": true, "decimal": true, "bit": true,
+	"count": true, "sum": true, "avg": true, "min": true, "max": true, "coalesce": true, "nullif": true,
+	"greatest": true, "least": true, "lower": true, "upper": true, "length": true, "abs": true, "round": true,
+}
+
+// isCacheableQuery reports whether a query's result may be served from the
+// result cache: a read-only statement that calls no functions other than the
+// built-ins in nonCallWords. Any other call may write, like a user-defined
+// function, or return something new each time, like now() or random().
+func isCacheableQuery(query string) bool {
+	if !isReadOnlyQuery(query) {
+		return false
+	}
+	for _, m := range callPattern.FindAllStringSubmatch(NormalizeQuery(query), -1) {
+		if m[1] == "" && !nonCallWords[m[2]] {
+			return false
+		}
+	}
+	return true
+}
+
+// resultCacheEntry holds a cached result and when it was stored
+type resultCacheEntry struct {
+	value    interface{}
+	storedAt time.Time
+}
+
+// resultCache is a concurrency-safe TTL cache of read-only query results and
+// schema introspection results; a ttl of zero disables it
+type resultCache struct {
+	mu      sync.RWMutex
+	ttl     time.Duration
+	entries map[string]resultCacheEntry
+}
+
+var results = &resultCache{entries: make(map[string]resultCacheEntry)}
+
+func (c *resultCache) enabled() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.ttl > 0
+}
+
+func (c *resultCache) get(key string) (interface{}, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	entry, ok := c.entries[key]
+	if !ok || time.Since(entry.storedAt) > c.ttl {
+		return nil, false
+	}
+	return entry.value, true
+}
+
+func (c *resultCache) set(key string, value interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.ttl <= 0 {
+		return
+	}
+	// Drop expired entries as new ones arrive so the cache cannot grow without bound
+	for k, entry := range c.entries {
+		if time.Since(entry.storedAt) > c.ttl {
+			delete(c.entries, k)
+		}
+	}
+	c.entries[key] = resultCacheEntry{value: value, storedAt: time.Now()}
+}
+
+func (c *resultCache) reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.entries) > 0 {
+		c.entries = make(map[string]resultCacheEntry)
+	}
+}
+
+// SetResultCacheTTL changes how long query and introspection results are
+// cached; zero, the default, disables the cache
+func SetResultCacheTTL(ttl time.Duration) {
+	results.mu.Lock()
+	defer results.mu.Unlock()
+	results.ttl = ttl
+	results.entries = make(map[string]resultCacheEntry)
+}
+
+// ResetResultCache drops every cached result
+func ResetResultCache() {
+	results.reset()
+}
+
+// queryCacheKey identifies a query result by connection, schema, whitespace
+// normalized query text, arguments and every option that shapes the result
+func queryCacheKey(schema, query string, args []interface{}, opts QueryOptions) string {
+	argsJSON, _ := json.Marshal(args)
+	return strings.Join([]string{
+		"query",
+		ConnectionLabel(),
+		schema,
+		opts.Role,
+		strings.Join(strings.Fields(query), " "),
+		string(argsJSON),
+		fmt.Sprint(opts.BinaryArtifacts, opts.FormattedMoney, MaxRows(opts.MaxRows), opts.TimeFormat),
+	}, "\x00")
+}
+
+// Cached returns the result of an introspection call from the result cache,
+// calling fetch and caching its result on a miss. noCache always calls fetch,
+// refreshing the cached result. The key is the tool name and its arguments.
+func Cached(noCache bool, fetch func() (interface{}, error), tool string, args ...string) (interface{}, error) {
+	if !results.enabled() {
+		return fetch()
+	}
+	key := strings.Join(append([]string{"tool", ConnectionLabel(), tool}, args...), "\x00")
+	if !noCache {
+		if value, ok := results.get(key); ok {
+			slog.Info("Cache hit", "tool", tool)
+			return value, nil
+		}
+	}
+	value, err := fetch()
+	if err != nil {
+		return nil, err
+	}
+	results.set(key, value)
+	return value, nil
+}
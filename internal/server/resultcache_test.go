@@ -0,0 +1,79 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// setTestResultCache enables the result cache for the duration of a test
+func setTestResultCache(t *testing.T, ttl time.Duration) {
+	t.Helper()
+	SetResultCacheTTL(ttl)
+	t.Cleanup(func() { SetResultCacheTTL(0) })
+}
+
+func TestIsCacheableQuery(t *testing.T) {
+	tests := []struct {
+		query string
+		want  bool
+	}{
+		{"SELECT * FROM orders WHERE id IN (1, 2)", true},
+		{"SELECT count(*), max(total) FROM orders GROUP BY status HAVING (sum(total) > 10)", true},
+		{"WITH recent AS (SELECT * FROM orders) SELECT coalesce(note, '') FROM recent", true},
+		{"SELECT CAST(total AS numeric(10, 2)), total::varchar(5) FROM orders", true},
+		{"SELECT 'now()' AS label", true},
+		{"SELECT now()", false},
+		{"SELECT random() FROM orders", false},
+		{"SELECT nextval('seq')", false},
+		{"SELECT archive_orders()", false},
+		{"SELECT app.touch(id) FROM orders", false},
+		{`SELECT "Audit"(id) FROM orders`, false},
+		{"SELECT * FROM generate_series(1, 3)", false},
+		{"UPDATE orders SET total = 0", false},
+		{"SELECT 1; SELECT 2", false},
+	}
+	for _, tt := range tests {
+		if got := isCacheableQuery(tt.query); got != tt.want {
+			t.Errorf("isCacheableQuery(%q) = %v, want %v", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestQueryResultCache(t *testing.T) {
+	db := testDB(t)
+	schema := testSchema(t, db,
+		"CREATE TABLE orders (id int, total int)",
+		"INSERT INTO orders VALUES (1, 10)",
+	)
+	setTestResultCache(t, time.Minute)
+	ctx := context.Background()
+
+	cached := func(query string) bool {
+		t.Helper()
+		result, err := ExecuteQueryWithOptions(ctx, db, schema, query, nil, QueryOptions{})
+		if err != nil {
+			t.Fatalf("%s: %v", query, err)
+		}
+		return result["meta"].(map[string]interface{})["cached"] == true
+	}
+
+	if cached("SELECT total FROM orders") {
+		t.Error("first run was served from the cache")
+	}
+	if !cached("SELECT total FROM orders") {
+		t.Error("second run was not served from the cache")
+	}
+	cached("SELECT now() AS ts")
+	if cached("SELECT now() AS ts") {
+		t.Error("a query calling now() was served from the cache")
+	}
+
+	// Access rules changed after caching apply to the cached result
+	cached("SELECT total FROM orders")
+	setTestTableAccess(t, "", schema+".orders")
+	if _, err := ExecuteQueryWithOptions(ctx, db, schema, "SELECT total FROM orders", nil, QueryOptions{}); !errors.Is(err, ErrAccessDenied) {
+		t.Errorf("cached query on a denied table: err = %v, want ErrAccessDenied", err)
+	}
+}
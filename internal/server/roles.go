@@ -0,0 +1,43 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// ErrRoleNotAllowed is returned when a requested role is not in the allowlist
+var ErrRoleNotAllowed = errors.New("role not allowed")
+
+var (
+	allowedRolesMu sync.RWMutex
+	allowedRoles   = map[string]bool{}
+)
+
+// SetAllowedRoles replaces the set of roles queries may switch to with SET ROLE.
+// An empty list disables role switching entirely.
+func SetAllowedRoles(roles []string) {
+	allowed := make(map[string]bool, len(roles))
+	for _, role := range roles {
+		role = strings.TrimSpace(role)
+		if role != "" {
+			allowed[role] = true
+		}
+	}
+
+	allowedRolesMu.Lock()
+	defer allowedRolesMu.Unlock()
+	allowedRoles = allowed
+}
+
+// ValidateRole checks a role against the allowlist
+func ValidateRole(role string) error {
+	allowedRolesMu.RLock()
+	defer allowedRolesMu.RUnlock()
+
+	if !allowedRoles[role] {
+		return fmt.Errorf("%w: %s", ErrRoleNotAllowed, role)
+	}
+	return nil
+}
@@ -0,0 +1,190 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+func TestValidateRole(t *testing.T) {
+	t.Cleanup(func() { SetAllowedRoles(nil) })
+
+	SetAllowedRoles(nil)
+	if err := ValidateRole("analyst"); !errors.Is(err, ErrRoleNotAllowed) {
+		t.Errorf("empty allowlist: err = %v, want ErrRoleNotAllowed", err)
+	}
+
+	SetAllowedRoles([]string{" analyst", "auditor ", ""})
+	for _, role := range []string{"analyst", "auditor"} {
+		if err := ValidateRole(role); err != nil {
+			t.Errorf("ValidateRole(%q) = %v", role, err)
+		}
+	}
+	for _, role := range []string{"", "postgres", "Analyst", "analyst "} {
+		if err := ValidateRole(role); !errors.Is(err, ErrRoleNotAllowed) {
+			t.Errorf("ValidateRole(%q) = %v, want ErrRoleNotAllowed", role, err)
+		}
+	}
+}
+
+// testRoles creates login-less roles with usage on schema, dropped when the
+// test finishes, and allows queries to switch to them
+func testRoles(t *testing.T, db *sql.DB, schema string, names ...string) {
+	t.Helper()
+	for _, name := range names {
+		role := pq.QuoteIdentifier(name)
+		mustExec(t, db, "CREATE ROLE "+role+" NOLOGIN")
+		t.Cleanup(func() {
+			db.Exec("DROP OWNED BY " + role)
+			db.Exec("DROP ROLE " + role)
+		})
+		mustExec(t, db, "GRANT USAGE ON SCHEMA "+pq.QuoteIdentifier(schema)+" TO "+role)
+	}
+	SetAllowedRoles(names)
+	t.Cleanup(func() { SetAllowedRoles(nil) })
+}
+
+func TestExecuteQueryAsRole(t *testing.T) {
+	db := testDB(t)
+	// A single connection shows whether the role leaks back into the pool
+	db.SetMaxOpenConns(1)
+	schema := testSchema(t, db,
+		"CREATE TABLE notes (owner text, body text)",
+		"CREATE TABLE payroll (amount int)",
+		"ALTER TABLE notes ENABLE ROW LEVEL SECURITY",
+		"CREATE POLICY own_notes ON notes USING (owner = current_user)",
+	)
+	reader, outsider := schema+"_reader", schema+"_outsider"
+	testRoles(t, db, schema, reader, outsider)
+	mustExec(t, db, "GRANT SELECT ON "+pq.QuoteIdentifier(schema)+".notes TO "+pq.QuoteIdentifier(reader)+", "+pq.QuoteIdentifier(outsider))
+	mustExec(t, db, "GRANT SELECT ON "+pq.QuoteIdentifier(schema)+".payroll TO "+pq.QuoteIdentifier(reader))
+	mustExec(t, db, "INSERT INTO "+pq.QuoteIdentifier(schema)+".notes VALUES ($1, 'mine'), ($2, 'theirs')", reader, outsider)
+
+	var self string
+	if err := db.QueryRow("SELECT current_user").Scan(&self); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	// Row-level security filters by the role the query runs as
+	result, err := ExecuteQueryAsRole(ctx, db, reader, schema, "SELECT body FROM notes", nil)
+	if err != nil {
+		t.Fatalf("notes as reader: %v", err)
+	}
+	rows := result["rows"].([]map[string]interface{})
+	if len(rows) != 1 || rows[0]["body"] != "mine" {
+		t.Errorf("notes as reader = %v, want only the reader's note", rows)
+	}
+
+	// Table privileges differ between the roles
+	if _, err := ExecuteQueryAsRole(ctx, db, reader, schema, "SELECT amount FROM payroll", nil); err != nil {
+		t.Errorf("payroll as reader: %v", err)
+	}
+	_, err = ExecuteQueryAsRole(ctx, db, outsider, schema, "SELECT amount FROM payroll", nil)
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) || pqErr.Code.Name() != "insufficient_privilege" {
+		t.Errorf("payroll as outsider: err = %v, want insufficient_privilege", err)
+	}
+
+	if _, err := ExecuteQueryAsRole(ctx, db, "postgres", schema, "SELECT 1", nil); !errors.Is(err, ErrRoleNotAllowed) {
+		t.Errorf("role outside the allowlist: err = %v, want ErrRoleNotAllowed", err)
+	}
+
+	// A second statement could otherwise drop or change the role before the query
+	for _, query := range []string{
+		"RESET ROLE; SELECT amount FROM payroll",
+		"SET ROLE " + pq.QuoteIdentifier(reader) + "; SELECT amount FROM payroll",
+		"SELECT 1; RESET ROLE",
+	} {
+		if _, err := ExecuteQueryAsRole(ctx, db, outsider, schema, query, nil); !errors.Is(err, ErrMultipleStatements) {
+			t.Errorf("%q as outsider: err = %v, want ErrMultipleStatements", query, err)
+		}
+	}
+
+	// The pooled connection is back to the original role afterwards
+	var current string
+	if err := db.QueryRow("SELECT current_user").Scan(&current); err != nil {
+		t.Fatal(err)
+	}
+	if current != self {
+		t.Errorf("current_user after role queries = %q, want %q", current, self)
+	}
+}
+
+func TestCursorAndMaterializeAsRole(t *testing.T) {
+	db := testDB(t)
+	schema := testSchema(t, db,
+		"CREATE TABLE notes (owner text, body text)",
+		"CREATE TABLE payroll (amount int)",
+		"ALTER TABLE notes ENABLE ROW LEVEL SECURITY",
+		"CREATE POLICY own_notes ON notes USING (owner = current_user)",
+	)
+	reader, outsider := schema+"_reader", schema+"_outsider"
+	testRoles(t, db, schema, reader, outsider)
+	mustExec(t, db, "GRANT SELECT ON "+pq.QuoteIdentifier(schema)+".notes TO "+pq.QuoteIdentifier(reader)+", "+pq.QuoteIdentifier(outsider))
+	mustExec(t, db, "INSERT INTO "+pq.QuoteIdentifier(schema)+".notes VALUES ($1, 'mine'), ($2, 'theirs')", reader, outsider)
+	streams := NewStreamRegistry(db, time.Minute)
+	t.Cleanup(streams.CloseAll)
+	sess := testSession(t, db)
+	ctx := context.Background()
+
+	// Cursor pages see what the role sees
+	id, err := streams.OpenCursor(ctx, "test", schema, "SELECT body FROM notes", nil, QueryOptions{Role: reader})
+	if err != nil {
+		t.Fatalf("OpenCursor as reader: %v", err)
+	}
+	page, err := streams.FetchCursor(ctx, "test", id, 10)
+	if err != nil {
+		t.Fatalf("FetchCursor: %v", err)
+	}
+	if len(page.Rows) != 1 || page.Rows[0]["body"] != "mine" {
+		t.Errorf("cursor rows as reader = %v, want only the reader's note", page.Rows)
+	}
+	_, err = streams.OpenCursor(ctx, "test", schema, "SELECT amount FROM payroll", nil, QueryOptions{Role: outsider})
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) || pqErr.Code.Name() != "insufficient_privilege" {
+		t.Errorf("payroll cursor as outsider: err = %v, want insufficient_privilege", err)
+	}
+
+	// So does a materialized result, and the session is back to its own role afterwards
+	result, err := MaterializeQuery(ctx, sess, schema, "my_notes", "SELECT body FROM notes", nil, QueryOptions{Role: reader})
+	if err != nil {
+		t.Fatalf("MaterializeQuery as reader: %v", err)
+	}
+	if result["row_count"] != int64(1) {
+		t.Errorf("materialized row_count = %v, want 1", result["row_count"])
+	}
+	_, err = MaterializeQuery(ctx, sess, schema, "pay", "SELECT amount FROM payroll", nil, QueryOptions{Role: outsider})
+	if !errors.As(err, &pqErr) || pqErr.Code.Name() != "insufficient_privilege" {
+		t.Errorf("payroll materialized as outsider: err = %v, want insufficient_privilege", err)
+	}
+	var current, self string
+	if err := db.QueryRow("SELECT current_user").Scan(&self); err != nil {
+		t.Fatal(err)
+	}
+	err = sess.Do(func(conn *sql.Conn) error {
+		return conn.QueryRowContext(ctx, "SELECT current_user").Scan(&current)
+	})
+	if err != nil || current != self {
+		t.Errorf("session current_user = %q (%v), want %q", current, err, self)
+	}
+
+	for name, run := range map[string]func() error{
+		"OpenCursor": func() error {
+			_, err := streams.OpenCursor(ctx, "test", schema, "SELECT 1", nil, QueryOptions{Role: "postgres"})
+			return err
+		},
+		"MaterializeQuery": func() error {
+			_, err := MaterializeQuery(ctx, sess, schema, "one", "SELECT 1", nil, QueryOptions{Role: "postgres"})
+			return err
+		},
+	} {
+		if err := run(); !errors.Is(err, ErrRoleNotAllowed) {
+			t.Errorf("%s with a role outside the allowlist: err = %v, want ErrRoleNotAllowed", name, err)
+		}
+	}
+}
@@ -0,0 +1,30 @@
+package server
+
+import "sync"
+
+// defaultMaxRows is the number of rows a query result may hold unless configured otherwise
+const defaultMaxRows = 1000
+
+var (
+	rowLimitMu sync.RWMutex
+	maxRows    = defaultMaxRows
+)
+
+// SetMaxRows caps how many rows a query result may hold; zero disables the cap
+func SetMaxRows(n int) {
+	rowLimitMu.Lock()
+	defer rowLimitMu.Unlock()
+	maxRows = n
+}
+
+// MaxRows returns the effective row cap for a call that requested the given cap
+// (zero meaning the configured one), never exceeding the configured cap
+func MaxRows(requested int) int {
+	rowLimitMu.RLock()
+	defer rowLimitMu.RUnlock()
+
+	if requested > 0 && (maxRows <= 0 || requested < maxRows) {
+		return requested
+	}
+	return maxRows
+}
@@ -0,0 +1,247 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// ErrNoSession is returned when a session-scoped operation has no client session to attach to
+var ErrNoSession = errors.New("operation requires a client session")
+
+// Session is a database connection pinned to one MCP client session, so
+// session-level state such as temp tables survives across tool calls
+type Session struct {
+	mu   sync.Mutex
+	conn *sql.Conn
+	// prepared maps statement names created with PrepareStatement to their SQL
+	prepared map[string]string
+	// snapshot is the isolation level of the open BeginSnapshot transaction, if any
+	snapshot      string
+	snapshotStart time.Time
+}
+
+// SessionManager hands out pinned connections keyed by MCP session ID
+type SessionManager struct {
+	db       *sql.DB
+	mu       sync.Mutex
+	sessions map[string]*Session
+	// inflight holds the cancel functions of running calls per session
+	inflight   map[string]map[uint64]context.CancelFunc
+	nextCallID uint64
+}
+
+// NewSessionManager creates a session manager drawing connections from db
+func NewSessionManager(db *sql.DB) *SessionManager {
+	return &SessionManager{
+		db:       db,
+		sessions: make(map[string]*Session),
+		inflight: make(map[string]map[uint64]context.CancelFunc),
+	}
+}
+
+// Track derives a context for a call made by session id that is cancelled when
+// the session is released, so a client disconnect cancels its running queries.
+// The returned cancel function must be called once the call finishes.
+func (m *SessionManager) Track(ctx context.Context, id string) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(ctx)
+	if id == "" {
+		return ctx, cancel
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.nextCallID++
+	callID := m.nextCallID
+	if m.inflight[id] == nil {
+		m.inflight[id] = make(map[uint64]context.CancelFunc)
+	}
+	m.inflight[id][callID] = cancel
+
+	return ctx, func() {
+		cancel()
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		delete(m.inflight[id], callID)
+		if len(m.inflight[id]) == 0 {
+			delete(m.inflight, id)
+		}
+	}
+}
+
+// Acquire returns the session's pinned connection, pinning a new one on first use
+func (m *SessionManager) Acquire(ctx context.Context, id string) (*Session, error) {
+	if id == "" {
+		return nil, ErrNoSession
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if sess, ok := m.sessions[id]; ok {
+		return sess, nil
+	}
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	sess := &Session{conn: conn, prepared: make(map[string]string)}
+	m.sessions[id] = sess
+	return sess, nil
+}
+
+// Get returns the session's pinned connection, or nil if it has none
+func (m *SessionManager) Get(id string) *Session {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.sessions[id]
+}
+
+// Release cancels the session's running calls, discards all session state on
+// the pinned connection and returns it to the pool
+func (m *SessionManager) Release(id string) {
+	m.mu.Lock()
+	sess, ok := m.sessions[id]
+	delete(m.sessions, id)
+	calls := m.inflight[id]
+	delete(m.inflight, id)
+	m.mu.Unlock()
+
+	for _, cancel := range calls {
+		cancel()
+	}
+	if ok {
+		sess.close()
+	}
+}
+
+// CloseAll releases every pinned connection
+func (m *SessionManager) CloseAll() {
+	m.mu.Lock()
+	sessions := m.sessions
+	m.sessions = make(map[string]*Session)
+	m.mu.Unlock()
+
+	for _, sess := range sessions {
+		sess.close()
+	}
+}
+
+// Do runs fn with exclusive use of the session's connection
+func (s *Session) Do(fn func(conn *sql.Conn) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return fn(s.conn)
+}
+
+func (s *Session) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// DISCARD ALL cannot run inside a transaction, so end any open snapshot first
+	if s.snapshot != "" {
+		s.conn.ExecContext(context.Background(), "ROLLBACK")
+		s.snapshot = ""
+	}
+
+	// DISCARD ALL drops temp tables, prepared statements and session settings;
+	// if it fails the connection is thrown away rather than reused
+	if _, err := s.conn.ExecContext(context.Background(), "DISCARD ALL"); err != nil {
+		s.conn.Raw(func(interface{}) error { return driver.ErrBadConn })
+	}
+	s.conn.Close()
+}
+
+// MaterializeQuery stores the result of query in a temporary table on the
+// session's connection and returns the table name and row count, so follow-up
+// queries in the same session can reference it. The query goes through the
+// same statement and table access checks as executeQuery, and a result with
+// columns the masking policy covers is dropped again rather than kept
+// unmasked. With opts.Role set the query runs as that role, like executeQuery;
+// only ArgTypes and Role of opts apply.
+func MaterializeQuery(ctx context.Context, sess *Session, schema, name, query string, args []interface{}, opts QueryOptions) (map[string]interface{}, error) {
+	args, err := coerceArgs(args, opts.ArgTypes)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Role != "" {
+		if err := ValidateRole(opts.Role); err != nil {
+			return nil, err
+		}
+	}
+
+	var rowCount int64
+	err = sess.Do(func(conn *sql.Conn) error {
+		if opts.Role != "" {
+			if _, err := conn.ExecContext(ctx, fmt.Sprintf("SET ROLE %s", pq.QuoteIdentifier(opts.Role))); err != nil {
+				return fmt.Errorf("failed to set role: %w", err)
+			}
+			defer resetRole(conn)
+		}
+		if _, err := conn.ExecContext(ctx, fmt.Sprintf("SET search_path TO %s", pq.QuoteIdentifier(schema))); err != nil {
+			return fmt.Errorf("failed to set schema: %w", err)
+		}
+		relations, err := checkQueryTables(ctx, conn, query, args, false)
+		if err != nil {
+			return err
+		}
+
+		start := time.Now()
+		defer recordQuery(query, start)
+		table := pq.QuoteIdentifier(name)
+		res, err := conn.ExecContext(ctx, fmt.Sprintf("CREATE TEMP TABLE %s AS %s", table, query), args...)
+		if err != nil {
+			return fmt.Errorf("query error: %w", err)
+		}
+		rowCount, _ = res.RowsAffected()
+
+		if mask := newQueryMask(relations); mask != nil {
+			cols, err := tempTableColumns(ctx, conn, table)
+			if err == nil && mask.strategies(cols) != nil {
+				err = fmt.Errorf("%w: the result has masked columns and cannot be materialized", ErrAccessDenied)
+			}
+			if err != nil {
+				conn.ExecContext(context.Background(), "DROP TABLE IF EXISTS pg_temp."+table)
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]interface{}{
+		"temp_table": name,
+		"row_count":  rowCount,
+	}, nil
+}
+
+// tempTableColumns returns the column names of a session temp table
+func tempTableColumns(ctx context.Context, conn *sql.Conn, table string) ([]string, error) {
+	rows, err := conn.QueryContext(ctx, `
+		SELECT attname FROM pg_catalog.pg_attribute
+		WHERE attrelid = ('pg_temp.' || $1)::regclass AND attnum > 0 AND NOT attisdropped
+		ORDER BY attnum;
+	`, table)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read temp table columns: %w", err)
+	}
+	defer rows.Close()
+
+	var cols []string
+	for rows.Next() {
+		var col string
+		if err := rows.Scan(&col); err != nil {
+			return nil, err
+		}
+		cols = append(cols, col)
+	}
+	return cols, rows.Err()
+}
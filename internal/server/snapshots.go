@@ -0,0 +1,100 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrSnapshotActive is returned when beginning a snapshot in a session that already has one
+	ErrSnapshotActive = errors.New("a snapshot is already active in this session")
+	// ErrNoSnapshot is returned when ending a snapshot in a session without one
+	ErrNoSnapshot = errors.New("no snapshot is active in this session")
+)
+
+// snapshotIsolationLevels maps the accepted isolation names to their SQL
+var snapshotIsolationLevels = map[string]string{
+	"repeatable read": "REPEATABLE READ",
+	"serializable":    "SERIALIZABLE",
+}
+
+// BeginSnapshot opens a read-only transaction at the given isolation level on
+// the session's pinned connection. Until EndSnapshot, every query run through
+// the session sees the same consistent snapshot of the database.
+func BeginSnapshot(ctx context.Context, sess *Session, isolation string) (map[string]interface{}, error) {
+	if isolation == "" {
+		isolation = "repeatable read"
+	}
+	level, ok := snapshotIsolationLevels[strings.ToLower(isolation)]
+	if !ok {
+		return nil, fmt.Errorf("unsupported isolation level %q (use repeatable read or serializable)", isolation)
+	}
+
+	var snapshot string
+	err := sess.Do(func(conn *sql.Conn) error {
+		if sess.snapshot != "" {
+			return ErrSnapshotActive
+		}
+		if _, err := conn.ExecContext(ctx, "BEGIN ISOLATION LEVEL "+level+" READ ONLY"); err != nil {
+			return fmt.Errorf("failed to begin snapshot: %w", err)
+		}
+		// The snapshot is taken by the first query, so take it now rather than at the client's first read
+		if err := conn.QueryRowContext(ctx, "SELECT pg_catalog.txid_current_snapshot()::text").Scan(&snapshot); err != nil {
+			conn.ExecContext(context.Background(), "ROLLBACK")
+			return fmt.Errorf("failed to take snapshot: %w", err)
+		}
+		sess.snapshot = level
+		sess.snapshotStart = time.Now()
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]interface{}{
+		"isolation": level,
+		"snapshot":  snapshot,
+	}, nil
+}
+
+// EndSnapshot closes the session's snapshot transaction
+func EndSnapshot(ctx context.Context, sess *Session) (map[string]interface{}, error) {
+	var result map[string]interface{}
+	err := sess.Do(func(conn *sql.Conn) error {
+		if sess.snapshot == "" {
+			return ErrNoSnapshot
+		}
+		if _, err := conn.ExecContext(ctx, "COMMIT"); err != nil {
+			return fmt.Errorf("failed to end snapshot: %w", err)
+		}
+		result = map[string]interface{}{
+			"isolation":   sess.snapshot,
+			"duration_ms": time.Since(sess.snapshotStart).Milliseconds(),
+		}
+		sess.snapshot = ""
+		return nil
+	})
+	return result, err
+}
+
+// inSnapshot runs fn on the session's connection, wrapping it in a savepoint
+// while a snapshot is active so a failing query does not abort the snapshot
+func inSnapshot(ctx context.Context, sess *Session, conn *sql.Conn, fn func() error) error {
+	if sess.snapshot == "" {
+		return fn()
+	}
+
+	if _, err := conn.ExecContext(ctx, "SAVEPOINT snapshot_query"); err != nil {
+		return fmt.Errorf("snapshot is no longer usable: %w", err)
+	}
+	if err := fn(); err != nil {
+		conn.ExecContext(context.Background(), "ROLLBACK TO SAVEPOINT snapshot_query")
+		return err
+	}
+	_, err := conn.ExecContext(ctx, "RELEASE SAVEPOINT snapshot_query")
+	return err
+}
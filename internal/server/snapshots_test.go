@@ -0,0 +1,78 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+)
+
+func TestSnapshotConsistency(t *testing.T) {
+	db := testDB(t)
+	schema := testSchema(t, db,
+		"CREATE TABLE accounts (id int, balance int)",
+		"INSERT INTO accounts VALUES (1, 100), (2, 100)",
+	)
+	sess := testSession(t, db)
+	ctx := context.Background()
+
+	// sum reads the accounts through the session
+	sum := func() int64 {
+		t.Helper()
+		result, err := ExecuteQueryWithOptions(ctx, db, schema, "SELECT sum(balance) AS total FROM accounts", nil, QueryOptions{Session: sess, NoCache: true})
+		if err != nil {
+			t.Fatalf("query in session: %v", err)
+		}
+		return result["rows"].([]map[string]interface{})[0]["total"].(int64)
+	}
+
+	if _, err := BeginSnapshot(ctx, sess, "sideways"); err == nil {
+		t.Fatal("unsupported isolation level was accepted")
+	}
+	if _, err := EndSnapshot(ctx, sess); !errors.Is(err, ErrNoSnapshot) {
+		t.Fatalf("EndSnapshot without a snapshot: err = %v, want ErrNoSnapshot", err)
+	}
+	begun, err := BeginSnapshot(ctx, sess, "")
+	if err != nil {
+		t.Fatalf("BeginSnapshot: %v", err)
+	}
+	if begun["isolation"] != "REPEATABLE READ" {
+		t.Errorf("isolation = %v, want REPEATABLE READ", begun["isolation"])
+	}
+	if _, err := BeginSnapshot(ctx, sess, "serializable"); !errors.Is(err, ErrSnapshotActive) {
+		t.Errorf("second BeginSnapshot: err = %v, want ErrSnapshotActive", err)
+	}
+
+	// Writers committing alongside the snapshot are not seen by it
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := db.Exec("UPDATE " + schema + ".accounts SET balance = balance + 10 WHERE id = 1"); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	mustExec(t, db, "INSERT INTO "+schema+".accounts VALUES (3, 1000)")
+
+	if got := sum(); got != 200 {
+		t.Errorf("sum in snapshot = %d, want 200", got)
+	}
+
+	// A failing query leaves the snapshot usable
+	if _, err := ExecuteQueryWithOptions(ctx, db, schema, "SELECT missing FROM accounts", nil, QueryOptions{Session: sess, NoCache: true}); err == nil {
+		t.Fatal("query on a missing column succeeded")
+	}
+	if got := sum(); got != 200 {
+		t.Errorf("sum after a failed query = %d, want 200", got)
+	}
+
+	if _, err := EndSnapshot(ctx, sess); err != nil {
+		t.Fatalf("EndSnapshot: %v", err)
+	}
+	if got := sum(); got != 1250 {
+		t.Errorf("sum after the snapshot = %d, want 1250", got)
+	}
+}
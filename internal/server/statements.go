@@ -0,0 +1,48 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// ErrMultipleStatements is returned when SQL that must be a single statement holds several
+var ErrMultipleStatements = errors.New("only a single SQL statement is allowed")
+
+// statementPreparer is satisfied by *sql.DB, *sql.Conn and *sql.Tx
+type statementPreparer interface {
+	PrepareContext(ctx context.Context, query string) (*sql.Stmt, error)
+}
+
+// requireSingleStatement rejects SQL holding more than one statement. lib/pq
+// sends a query without arguments over the simple protocol, which runs every
+// statement in the string, so a check or wrapper around the first statement
+// (EXPLAIN, SET ROLE, a read-only transaction) would not cover the rest. The
+// statement is parsed by Postgres through the extended protocol, which refuses
+// more than one command, so no quoting or comment trick can hide a semicolon.
+// Queries with arguments already travel over the extended protocol and are
+// not prepared again.
+func requireSingleStatement(ctx context.Context, p statementPreparer, query string, args []interface{}) error {
+	if len(args) > 0 {
+		return nil
+	}
+	stmt, err := p.PrepareContext(ctx, query)
+	if err != nil {
+		if isMultipleCommandsError(err) {
+			return ErrMultipleStatements
+		}
+		return fmt.Errorf("query error: %w", err)
+	}
+	return stmt.Close()
+}
+
+// isMultipleCommandsError reports whether err is Postgres refusing to prepare
+// more than one command
+func isMultipleCommandsError(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "42601" && strings.Contains(pqErr.Message, "multiple commands")
+}
@@ -0,0 +1,292 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// defaultStreamIdleTimeout is how long an unacknowledged stream stays open
+const defaultStreamIdleTimeout = 5 * time.Minute
+
+// ErrStreamNotFound is returned for unknown, finished or expired stream IDs
+var ErrStreamNotFound = errors.New("stream not found or expired")
+
+// StreamBatch is one batch of rows sent to a client for an open stream
+type StreamBatch struct {
+	StreamID string                   `json:"stream_id"`
+	Seq      int                      `json:"seq"`
+	Columns  []string                 `json:"columns"`
+	Rows     []map[string]interface{} `json:"rows"`
+	RowsSent int                      `json:"rows_sent"`
+	Done     bool                     `json:"done"`
+}
+
+// resultStream is an open cursor waiting for the client to ask for its next batch
+type resultStream struct {
+	mu        sync.Mutex
+	tx        *sql.Tx
+	cursor    string
+	batchSize int
+	seq       int
+	rowsSent  int
+	opts      QueryOptions
+	lastUsed  time.Time
+	// paged marks cursors opened by executeQuery, read a page at a time with
+	// FetchCursor rather than streamed in batches
+	paged bool
+	// owner is the client session that opened the stream or cursor; only it
+	// may read or close it
+	owner string
+}
+
+// StreamRegistry tracks open result streams and query cursors keyed by ID and
+// closes those the client stops reading
+type StreamRegistry struct {
+	db          *sql.DB
+	idleTimeout time.Duration
+	mu          sync.Mutex
+	streams     map[string]*resultStream
+}
+
+// NewStreamRegistry creates a stream registry and starts its idle-stream cleanup loop
+func NewStreamRegistry(db *sql.DB, idleTimeout time.Duration) *StreamRegistry {
+	if idleTimeout <= 0 {
+		idleTimeout = defaultStreamIdleTimeout
+	}
+	r := &StreamRegistry{
+		db:          db,
+		idleTimeout: idleTimeout,
+		streams:     make(map[string]*resultStream),
+	}
+	go r.cleanupLoop()
+	return r
+}
+
+// Open declares a server-side cursor for query and registers it as a new stream
+// of the session owner
+func (r *StreamRegistry) Open(ctx context.Context, owner, schema, query string, args []interface{}, batchSize int) (string, error) {
+	if batchSize <= 0 {
+		batchSize = defaultFetchSize
+	}
+
+	stream, err := r.declare(ctx, "", schema, query, args)
+	if err != nil {
+		return "", err
+	}
+	stream.batchSize = batchSize
+	stream.owner = owner
+	return r.add(stream)
+}
+
+// declare opens a read-only transaction and declares a cursor for query in it,
+// after the statement and table access checks. With role set, the whole
+// transaction, including later fetches, runs as that role.
+func (r *StreamRegistry) declare(ctx context.Context, role, schema, query string, args []interface{}) (*resultStream, error) {
+	if role != "" {
+		if err := ValidateRole(role); err != nil {
+			return nil, err
+		}
+	}
+	// The transaction outlives this call, so it must not be bound to the request context
+	tx, err := r.db.BeginTx(context.Background(), &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	if role != "" {
+		if _, err := tx.ExecContext(ctx, fmt.Sprintf("SET LOCAL ROLE %s", pq.QuoteIdentifier(role))); err != nil {
+			tx.Rollback()
+			return nil, fmt.Errorf("failed to set role: %w", err)
+		}
+	}
+	if _, err := tx.ExecContext(ctx, fmt.Sprintf("SET LOCAL search_path TO %s", pq.QuoteIdentifier(schema))); err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("failed to set schema: %w", err)
+	}
+	relations, err := checkQueryTables(ctx, tx, query, args, true)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	start := time.Now()
+	cursor := pq.QuoteIdentifier(nextCursorName())
+	_, err = tx.ExecContext(ctx, fmt.Sprintf("DECLARE %s NO SCROLL CURSOR FOR %s", cursor, query), args...)
+	recordQuery(query, start)
+	if err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("query error: %w", err)
+	}
+
+	return &resultStream{
+		tx:       tx,
+		cursor:   cursor,
+		opts:     QueryOptions{mask: newQueryMask(relations)},
+		lastUsed: time.Now(),
+	}, nil
+}
+
+// add registers a declared stream under a new random ID. A cursor is refused
+// when its owner already holds maxSessionCursors, counted under the same lock
+// as the insert so concurrent opens cannot exceed the limit; the stream's
+// transaction is rolled back whenever it is not registered.
+func (r *StreamRegistry) add(stream *resultStream) (string, error) {
+	id, err := newStreamID()
+	if err != nil {
+		stream.tx.Rollback()
+		return "", err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if stream.paged {
+		open := 0
+		for _, s := range r.streams {
+			if s.paged && s.owner == stream.owner {
+				open++
+			}
+		}
+		if open >= maxSessionCursors {
+			stream.tx.Rollback()
+			return "", ErrTooManyCursors
+		}
+	}
+	r.streams[id] = stream
+	return id, nil
+}
+
+// newStreamID returns a random ID for a stream or cursor
+func newStreamID() (string, error) {
+	idBytes := make([]byte, 12)
+	if _, err := rand.Read(idBytes); err != nil {
+		return "", fmt.Errorf("failed to generate stream ID: %w", err)
+	}
+	return hex.EncodeToString(idBytes), nil
+}
+
+// lookup returns the stream or, with paged set, the cursor of owner with the given ID
+func (r *StreamRegistry) lookup(id, owner string, paged bool) *resultStream {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stream, ok := r.streams[id]
+	if !ok || stream.paged != paged || stream.owner != owner {
+		return nil
+	}
+	return stream
+}
+
+// Next fetches the next batch of a stream the owner opened; the stream is
+// closed once a short batch signals the end
+func (r *StreamRegistry) Next(ctx context.Context, owner, id string) (*StreamBatch, error) {
+	stream := r.lookup(id, owner, false)
+	if stream == nil {
+		return nil, ErrStreamNotFound
+	}
+
+	stream.mu.Lock()
+	defer stream.mu.Unlock()
+	stream.lastUsed = time.Now()
+
+	rows, err := stream.tx.QueryContext(ctx, fmt.Sprintf("FETCH FORWARD %d FROM %s", stream.batchSize, stream.cursor))
+	if err != nil {
+		r.closeStream(id)
+		return nil, fmt.Errorf("fetch error: %w", err)
+	}
+	cols, batch, err := scanRows(rows, stream.opts)
+	rows.Close()
+	if err != nil {
+		r.closeStream(id)
+		return nil, err
+	}
+
+	stream.seq++
+	stream.rowsSent += len(batch)
+	done := len(batch) < stream.batchSize
+	if done {
+		r.remove(id)
+		stream.tx.Rollback()
+	}
+
+	return &StreamBatch{
+		StreamID: id,
+		Seq:      stream.seq,
+		Columns:  cols,
+		Rows:     batch,
+		RowsSent: stream.rowsSent,
+		Done:     done,
+	}, nil
+}
+
+// Close abandons a stream the owner opened and releases its cursor and connection
+func (r *StreamRegistry) Close(owner, id string) error {
+	if r.lookup(id, owner, false) == nil {
+		return ErrStreamNotFound
+	}
+	return r.closeStream(id)
+}
+
+// closeStream removes a stream or cursor and rolls back its transaction
+func (r *StreamRegistry) closeStream(id string) error {
+	stream := r.remove(id)
+	if stream == nil {
+		return ErrStreamNotFound
+	}
+	return stream.tx.Rollback()
+}
+
+// CloseAll abandons every open stream and cursor
+func (r *StreamRegistry) CloseAll() {
+	r.mu.Lock()
+	streams := r.streams
+	r.streams = make(map[string]*resultStream)
+	r.mu.Unlock()
+
+	for _, stream := range streams {
+		stream.tx.Rollback()
+	}
+}
+
+func (r *StreamRegistry) remove(id string) *resultStream {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stream, ok := r.streams[id]
+	if !ok {
+		return nil
+	}
+	delete(r.streams, id)
+	return stream
+}
+
+// cleanupLoop closes streams and cursors that have not been read from within
+// the idle timeout
+func (r *StreamRegistry) cleanupLoop() {
+	ticker := time.NewTicker(r.idleTimeout / 2)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		r.mu.Lock()
+		var expired []string
+		for id, stream := range r.streams {
+			if stream.mu.TryLock() {
+				if time.Since(stream.lastUsed) > r.idleTimeout {
+					expired = append(expired, id)
+				}
+				stream.mu.Unlock()
+			}
+		}
+		r.mu.Unlock()
+
+		for _, id := range expired {
+			r.closeStream(id)
+		}
+	}
+}
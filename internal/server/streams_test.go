@@ -0,0 +1,153 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testStreams creates a stream registry closed when the test finishes
+func testStreams(t *testing.T) (*StreamRegistry, string) {
+	t.Helper()
+	db := testDB(t)
+	schema := testSchema(t, db)
+	r := NewStreamRegistry(db, time.Minute)
+	t.Cleanup(r.CloseAll)
+	return r, schema
+}
+
+func TestStreamBatches(t *testing.T) {
+	r, schema := testStreams(t)
+	ctx := context.Background()
+
+	id, err := r.Open(ctx, "session-a", schema, "SELECT generate_series(1, 25) AS n", nil, 10)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	var sent []int
+	for {
+		batch, err := r.Next(ctx, "session-a", id)
+		if err != nil {
+			t.Fatalf("Next: %v", err)
+		}
+		sent = append(sent, batch.RowsSent)
+		if batch.Done {
+			break
+		}
+	}
+	if len(sent) != 3 || sent[2] != 25 {
+		t.Errorf("rows sent per batch = %v, want [10 20 25]", sent)
+	}
+	if _, err := r.Next(ctx, "session-a", id); !errors.Is(err, ErrStreamNotFound) {
+		t.Errorf("Next after done: err = %v, want ErrStreamNotFound", err)
+	}
+}
+
+func TestStreamOwner(t *testing.T) {
+	r, schema := testStreams(t)
+	ctx := context.Background()
+
+	id, err := r.Open(ctx, "session-a", schema, "SELECT generate_series(1, 25) AS n", nil, 10)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	if _, err := r.Next(ctx, "session-b", id); !errors.Is(err, ErrStreamNotFound) {
+		t.Errorf("read from another session: err = %v, want ErrStreamNotFound", err)
+	}
+	if err := r.Close("session-b", id); !errors.Is(err, ErrStreamNotFound) {
+		t.Errorf("close from another session: err = %v, want ErrStreamNotFound", err)
+	}
+	if _, err := r.FetchCursor(ctx, "session-a", id, 10); !errors.Is(err, ErrCursorNotFound) {
+		t.Errorf("stream read as a cursor: err = %v, want ErrCursorNotFound", err)
+	}
+	if batch, err := r.Next(ctx, "session-a", id); err != nil || batch.RowsSent != 10 {
+		t.Fatalf("Next by the owner: %v, %v", batch, err)
+	}
+
+	// Ending the session closes its streams
+	r.CloseSession("session-a")
+	if _, err := r.Next(ctx, "session-a", id); !errors.Is(err, ErrStreamNotFound) {
+		t.Errorf("Next after CloseSession: err = %v, want ErrStreamNotFound", err)
+	}
+}
+
+func TestCursorPages(t *testing.T) {
+	r, schema := testStreams(t)
+	ctx := context.Background()
+
+	id, err := r.OpenCursor(ctx, "session-a", schema, "SELECT generate_series(1, $1::int) AS n", []interface{}{15}, QueryOptions{})
+	if err != nil {
+		t.Fatalf("OpenCursor: %v", err)
+	}
+
+	// Cursors belong to their session and are not streams
+	if _, err := r.FetchCursor(ctx, "session-b", id, 10); !errors.Is(err, ErrCursorNotFound) {
+		t.Errorf("fetch from another session: err = %v, want ErrCursorNotFound", err)
+	}
+	if err := r.CloseCursor("session-b", id); !errors.Is(err, ErrCursorNotFound) {
+		t.Errorf("close from another session: err = %v, want ErrCursorNotFound", err)
+	}
+	if _, err := r.Next(ctx, "session-a", id); !errors.Is(err, ErrStreamNotFound) {
+		t.Errorf("cursor read as a stream: err = %v, want ErrStreamNotFound", err)
+	}
+
+	page, err := r.FetchCursor(ctx, "session-a", id, 10)
+	if err != nil {
+		t.Fatalf("FetchCursor: %v", err)
+	}
+	if len(page.Rows) != 10 || page.Done {
+		t.Fatalf("first page: %d rows, done %v", len(page.Rows), page.Done)
+	}
+	page, err = r.FetchCursor(ctx, "session-a", id, 10)
+	if err != nil {
+		t.Fatalf("FetchCursor: %v", err)
+	}
+	if len(page.Rows) != 5 || !page.Done || page.RowsFetched != 15 {
+		t.Fatalf("last page: %d rows, done %v, rows fetched %d", len(page.Rows), page.Done, page.RowsFetched)
+	}
+	if _, err := r.FetchCursor(ctx, "session-a", id, 10); !errors.Is(err, ErrCursorNotFound) {
+		t.Errorf("fetch after done: err = %v, want ErrCursorNotFound", err)
+	}
+}
+
+func TestCursorSessionLimit(t *testing.T) {
+	r, schema := testStreams(t)
+	ctx := context.Background()
+
+	// Opens racing each other must not exceed the limit between them
+	attempts := maxSessionCursors + 4
+	var wg sync.WaitGroup
+	errs := make([]error, attempts)
+	for i := 0; i < attempts; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, errs[i] = r.OpenCursor(ctx, "session-a", schema, "SELECT 1", nil, QueryOptions{})
+		}(i)
+	}
+	wg.Wait()
+
+	opened := 0
+	for _, err := range errs {
+		switch {
+		case err == nil:
+			opened++
+		case !errors.Is(err, ErrTooManyCursors):
+			t.Errorf("OpenCursor: %v", err)
+		}
+	}
+	if opened != maxSessionCursors {
+		t.Fatalf("opened %d cursors, want %d", opened, maxSessionCursors)
+	}
+
+	// Other sessions have limits of their own, and closing the session frees its slots
+	if _, err := r.OpenCursor(ctx, "session-b", schema, "SELECT 1", nil, QueryOptions{}); err != nil {
+		t.Fatalf("cursor for another session: %v", err)
+	}
+	r.CloseSession("session-a")
+	if _, err := r.OpenCursor(ctx, "session-a", schema, "SELECT 1", nil, QueryOptions{}); err != nil {
+		t.Fatalf("cursor after CloseSession: %v", err)
+	}
+}
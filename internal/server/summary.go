@@ -0,0 +1,123 @@
+package server
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// columnSummary accumulates statistics for one result column
+type columnSummary struct {
+	kind     string
+	nulls    int
+	count    int
+	min, max float64
+	sum      float64
+	distinct map[string]bool
+}
+
+// valueKind classifies a converted result value for summarizing
+func valueKind(val interface{}) string {
+	switch val.(type) {
+	case int64, float64:
+		return "number"
+	case string:
+		return "text"
+	case bool:
+		return "boolean"
+	case time.Time:
+		return "timestamp"
+	default:
+		return "other"
+	}
+}
+
+// SummarizeResult computes a compact description of a query result: the row
+// count and, per column, its inferred type and null count, min/max/avg for
+// numeric columns and the distinct value count for text columns
+func SummarizeResult(columns []string, rows []map[string]interface{}) map[string]interface{} {
+	stats := make([]*columnSummary, len(columns))
+	for i := range columns {
+		stats[i] = &columnSummary{distinct: map[string]bool{}}
+	}
+
+	for _, row := range rows {
+		for i, col := range columns {
+			s := stats[i]
+			val := row[col]
+			if val == nil {
+				s.nulls++
+				continue
+			}
+
+			kind := valueKind(val)
+			if s.kind == "" {
+				s.kind = kind
+			} else if s.kind != kind {
+				s.kind = "mixed"
+			}
+
+			switch v := val.(type) {
+			case int64:
+				s.addNumber(float64(v))
+			case float64:
+				s.addNumber(v)
+			case string:
+				s.distinct[v] = true
+			}
+		}
+	}
+
+	summaries := make([]map[string]interface{}, len(columns))
+	descriptions := make([]string, len(columns))
+	for i, col := range columns {
+		s := stats[i]
+		if s.kind == "" {
+			s.kind = "null"
+		}
+		summary := map[string]interface{}{
+			"name":  col,
+			"type":  s.kind,
+			"nulls": s.nulls,
+		}
+		desc := fmt.Sprintf("%s (%s", col, s.kind)
+		switch s.kind {
+		case "number":
+			avg := s.sum / float64(s.count)
+			summary["min"] = s.min
+			summary["max"] = s.max
+			summary["avg"] = avg
+			desc += fmt.Sprintf(", min %g, max %g, avg %.4g", s.min, s.max, avg)
+		case "text":
+			summary["distinct"] = len(s.distinct)
+			desc += fmt.Sprintf(", %d distinct", len(s.distinct))
+		}
+		if s.nulls > 0 {
+			desc += fmt.Sprintf(", %d null", s.nulls)
+		}
+		summaries[i] = summary
+		descriptions[i] = desc + ")"
+	}
+
+	description := fmt.Sprintf("%d rows", len(rows))
+	if len(columns) > 0 {
+		description += "; columns: " + strings.Join(descriptions, ", ")
+	}
+
+	return map[string]interface{}{
+		"row_count":   len(rows),
+		"columns":     summaries,
+		"description": description,
+	}
+}
+
+func (s *columnSummary) addNumber(v float64) {
+	if s.count == 0 {
+		s.min, s.max = math.Inf(1), math.Inf(-1)
+	}
+	s.count++
+	s.sum += v
+	s.min = math.Min(s.min, v)
+	s.max = math.Max(s.max, v)
+}
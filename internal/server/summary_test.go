@@ -0,0 +1,52 @@
+package server
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSummarizeResult(t *testing.T) {
+	columns := []string{"id", "price", "city", "active", "created", "note", "misc"}
+	rows := []map[string]interface{}{
+		{"id": int64(1), "price": 2.5, "city": "Oslo", "active": true, "created": time.Now(), "note": nil, "misc": int64(1)},
+		{"id": int64(2), "price": nil, "city": "Rome", "active": false, "created": time.Now(), "note": nil, "misc": "one"},
+		{"id": int64(6), "price": 7.5, "city": "Oslo", "active": true, "created": nil, "note": nil, "misc": nil},
+	}
+
+	summary := SummarizeResult(columns, rows)
+	if summary["row_count"] != 3 {
+		t.Errorf("row_count = %v, want 3", summary["row_count"])
+	}
+	want := []map[string]interface{}{
+		{"name": "id", "type": "number", "nulls": 0, "min": 1.0, "max": 6.0, "avg": 3.0},
+		{"name": "price", "type": "number", "nulls": 1, "min": 2.5, "max": 7.5, "avg": 5.0},
+		{"name": "city", "type": "text", "nulls": 0, "distinct": 2},
+		{"name": "active", "type": "boolean", "nulls": 0},
+		{"name": "created", "type": "timestamp", "nulls": 1},
+		{"name": "note", "type": "null", "nulls": 3},
+		{"name": "misc", "type": "mixed", "nulls": 1},
+	}
+	got := summary["columns"].([]map[string]interface{})
+	for i := range want {
+		if !reflect.DeepEqual(got[i], want[i]) {
+			t.Errorf("column %s = %v, want %v", columns[i], got[i], want[i])
+		}
+	}
+
+	wantDesc := "3 rows; columns: id (number, min 1, max 6, avg 3), price (number, min 2.5, max 7.5, avg 5, 1 null), " +
+		"city (text, 2 distinct), active (boolean), created (timestamp, 1 null), note (null, 3 null), misc (mixed, 1 null)"
+	if summary["description"] != wantDesc {
+		t.Errorf("description = %q\nwant %q", summary["description"], wantDesc)
+	}
+}
+
+func TestSummarizeResultEmpty(t *testing.T) {
+	summary := SummarizeResult([]string{"id"}, nil)
+	if summary["row_count"] != 0 || summary["description"] != "0 rows; columns: id (null)" {
+		t.Errorf("summary = %v", summary)
+	}
+	if summary := SummarizeResult(nil, nil); summary["description"] != "0 rows" {
+		t.Errorf("description without columns = %q", summary["description"])
+	}
+}
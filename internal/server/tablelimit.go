@@ -0,0 +1,105 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync/atomic"
+)
+
+// ErrTooManyTables is returned when a query references more tables than MAX_TABLES_PER_QUERY allows
+var ErrTooManyTables = errors.New("query references too many tables")
+
+// maxTablesPerQuery is the table limit per query; zero means unlimited
+var maxTablesPerQuery atomic.Int64
+
+// SetMaxTablesPerQuery limits how many distinct tables a single query may scan; zero disables the limit
+func SetMaxTablesPerQuery(n int) {
+	maxTablesPerQuery.Store(int64(n))
+}
+
+// queryRower is satisfied by *sql.DB, *sql.Conn and *sql.Tx
+type queryRower interface {
+	statementPreparer
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// checkQueryTables rejects SQL holding more than one statement, which would
+// otherwise run unchecked after the first, and then a query whose plan reads a
+// table denied by the table access rules, or scans more distinct relations than
+// the configured limit. Every caller runs the query after this check, so the
+// single-statement rule applies even when no limits are configured. The
+// relations come from EXPLAIN rather than parsing the SQL, so views, CTEs and
+// subqueries are checked by what they actually read. Statements that cannot be
+// explained (DDL, utility commands) are not limited unless requireExplain is
+// set, which cursor callers use because a failed EXPLAIN aborts their
+// transaction and the query could not have run anyway; while access rules are
+// configured they are always rejected, since what they read cannot be checked.
+// The relations read are returned when the plan was needed, for result masking.
+func checkQueryTables(ctx context.Context, q queryRower, query string, args []interface{}, requireExplain bool) ([]string, error) {
+	if err := requireSingleStatement(ctx, q, query, args); err != nil {
+		return nil, err
+	}
+
+	limit := int(maxTablesPerQuery.Load())
+	restricted := tableAccessRestricted()
+	if limit <= 0 && !restricted && !maskingEnabled() {
+		return nil, nil
+	}
+
+	var planJSON []byte
+	if err := q.QueryRowContext(ctx, "EXPLAIN (VERBOSE, FORMAT JSON) "+query, args...).Scan(&planJSON); err != nil {
+		if restricted {
+			return nil, fmt.Errorf("%w: cannot determine the tables this query reads: %v", ErrAccessDenied, err)
+		}
+		if requireExplain {
+			return nil, fmt.Errorf("query error: %w", err)
+		}
+		return nil, nil
+	}
+	var plans []struct {
+		Plan map[string]interface{} `json:"Plan"`
+	}
+	if err := json.Unmarshal(planJSON, &plans); err != nil {
+		return nil, fmt.Errorf("failed to parse query plan: %w", err)
+	}
+
+	relations := map[string]bool{}
+	for _, p := range plans {
+		collectPlanRelations(p.Plan, relations)
+	}
+	names := make([]string, 0, len(relations))
+	for name := range relations {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if !tableAllowed(name) {
+			return nil, fmt.Errorf("%w: %s", ErrAccessDenied, name)
+		}
+	}
+	if limit > 0 && len(relations) > limit {
+		return nil, fmt.Errorf("%w: %d tables (%v) exceeds the limit of %d", ErrTooManyTables, len(relations), names, limit)
+	}
+	return names, nil
+}
+
+// collectPlanRelations adds every relation scanned by a plan node and its children
+func collectPlanRelations(node map[string]interface{}, relations map[string]bool) {
+	if name, ok := node["Relation Name"].(string); ok {
+		if schema, ok := node["Schema"].(string); ok {
+			name = schema + "." + name
+		}
+		relations[name] = true
+	}
+	children, _ := node["Plans"].([]interface{})
+	for _, child := range children {
+		if childNode, ok := child.(map[string]interface{}); ok {
+			collectPlanRelations(childNode, relations)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestCollectPlanRelations(t *testing.T) {
+	planJSON := `{
+		"Node Type": "Hash Join",
+		"Plans": [
+			{"Node Type": "Seq Scan", "Relation Name": "orders", "Schema": "public"},
+			{"Node Type": "Hash", "Plans": [
+				{"Node Type": "Index Scan", "Relation Name": "customers", "Schema": "crm"},
+				{"Node Type": "Seq Scan", "Relation Name": "orders", "Schema": "public"}
+			]}
+		]
+	}`
+	var plan map[string]interface{}
+	if err := json.Unmarshal([]byte(planJSON), &plan); err != nil {
+		t.Fatal(err)
+	}
+
+	relations := map[string]bool{}
+	collectPlanRelations(plan, relations)
+	var got []string
+	for name := range relations {
+		got = append(got, name)
+	}
+	sort.Strings(got)
+	if want := []string{"crm.customers", "public.orders"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("relations = %v, want %v", got, want)
+	}
+}
+
+func setTestMaxTables(t *testing.T, n int) {
+	t.Helper()
+	SetMaxTablesPerQuery(n)
+	t.Cleanup(func() { SetMaxTablesPerQuery(0) })
+}
+
+func TestMaxTablesPerQuery(t *testing.T) {
+	db := testDB(t)
+	schema := testSchema(t, db,
+		"CREATE TABLE a (id int)",
+		"CREATE TABLE b (id int)",
+		"CREATE TABLE c (id int)",
+	)
+	setTestMaxTables(t, 2)
+
+	ctx := context.Background()
+	for _, query := range []string{
+		"SELECT * FROM a",
+		"SELECT * FROM a JOIN b USING (id)",
+		// A table scanned twice counts once
+		"SELECT * FROM a x JOIN a y USING (id)",
+	} {
+		if _, err := ExecuteQueryWithOptions(ctx, db, schema, query, nil, QueryOptions{}); err != nil {
+			t.Errorf("%q: %v", query, err)
+		}
+	}
+
+	_, err := ExecuteQueryWithOptions(ctx, db, schema, "SELECT * FROM a JOIN b USING (id) JOIN c USING (id)", nil, QueryOptions{})
+	if !errors.Is(err, ErrTooManyTables) {
+		t.Fatalf("three-way join: err = %v, want ErrTooManyTables", err)
+	}
+	// Subqueries count by what they scan
+	_, err = ExecuteQueryWithOptions(ctx, db, schema, "SELECT * FROM a WHERE id IN (SELECT id FROM b) AND id IN (SELECT id FROM c)", nil, QueryOptions{})
+	if !errors.Is(err, ErrTooManyTables) {
+		t.Fatalf("subqueries over three tables: err = %v, want ErrTooManyTables", err)
+	}
+
+	// Unlimited once unset
+	SetMaxTablesPerQuery(0)
+	if _, err := ExecuteQueryWithOptions(ctx, db, schema, "SELECT * FROM a JOIN b USING (id) JOIN c USING (id)", nil, QueryOptions{}); err != nil {
+		t.Fatalf("unlimited three-way join: %v", err)
+	}
+}
+
+// TestMaxTablesPerQueryMultipleStatements checks that statements after the
+// first are neither run by the check nor left uncounted
+func TestMaxTablesPerQueryMultipleStatements(t *testing.T) {
+	db := testDB(t)
+	schema := testSchema(t, db,
+		"CREATE TABLE a (id int)",
+		"CREATE TABLE b (id int)",
+		"CREATE TABLE c (id int)",
+	)
+	setTestMaxTables(t, 1)
+
+	query := "SELECT * FROM a; INSERT INTO b VALUES (1); SELECT * FROM a JOIN b USING (id) JOIN c USING (id)"
+	_, err := ExecuteQueryWithOptions(context.Background(), db, schema, query, nil, QueryOptions{})
+	if !errors.Is(err, ErrMultipleStatements) {
+		t.Fatalf("err = %v, want ErrMultipleStatements", err)
+	}
+
+	var count int
+	if err := db.QueryRow("SELECT count(*) FROM " + schema + ".b").Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+	if count != 0 {
+		t.Fatalf("trailing INSERT ran during the check: b has %d rows", count)
+	}
+}
@@ -0,0 +1,113 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const (
+	// defaultQueryTimeoutValue bounds queries whose caller did not request a timeout
+	defaultQueryTimeoutValue = 30 * time.Second
+	// defaultMaxQueryTimeout is the ceiling applied to every query unless configured otherwise
+	defaultMaxQueryTimeout = 5 * time.Minute
+)
+
+var (
+	timeoutsMu          sync.RWMutex
+	defaultQueryTimeout = defaultQueryTimeoutValue
+	maxQueryTimeout     = defaultMaxQueryTimeout
+)
+
+// SetQueryTimeouts configures the timeout used when a call does not request one
+// and the ceiling that requested timeouts are clamped to. Zero disables either.
+func SetQueryTimeouts(defaultTimeout, maxTimeout time.Duration) {
+	timeoutsMu.Lock()
+	defer timeoutsMu.Unlock()
+	defaultQueryTimeout = defaultTimeout
+	maxQueryTimeout = maxTimeout
+}
+
+// QueryTimeout returns the effective timeout for a call that requested the given
+// timeout (zero meaning the default), clamped to the configured ceiling
+func QueryTimeout(requested time.Duration) time.Duration {
+	timeoutsMu.RLock()
+	defer timeoutsMu.RUnlock()
+
+	timeout := defaultQueryTimeout
+	if requested > 0 {
+		timeout = requested
+	}
+	if maxQueryTimeout > 0 && (timeout <= 0 || timeout > maxQueryTimeout) {
+		timeout = maxQueryTimeout
+	}
+	return timeout
+}
+
+// WithQueryTimeout derives a context that is cancelled once the effective timeout elapses
+func WithQueryTimeout(ctx context.Context, requested time.Duration) (context.Context, context.CancelFunc) {
+	if timeout := QueryTimeout(requested); timeout > 0 {
+		return context.WithTimeout(ctx, timeout)
+	}
+	return context.WithCancel(ctx)
+}
+
+// noTransactionPattern matches statements that cannot run inside a transaction block
+var noTransactionPattern = regexp.MustCompile(`^(vacuum|create database|drop database|alter system|create tablespace|drop tablespace|reindex (database|system)|(create|drop) index concurrently|reindex .*concurrently|begin|start transaction|commit|end|rollback|abort|savepoint|release)\b`)
+
+// rowsQueryer is satisfied by *sql.Conn and *sql.Tx
+type rowsQueryer interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// withStatementTimeout runs fn with the time left until ctx's deadline also
+// enforced by Postgres, via SET LOCAL statement_timeout in a transaction around
+// the query, so the server stops the statement even if the client goes away.
+// When the connection is already inside a transaction the setting is applied
+// to it directly. Statements that cannot run in a transaction are bounded by
+// the context alone.
+func withStatementTimeout(ctx context.Context, conn *sql.Conn, inTx bool, query string, fn func(q rowsQueryer) error) error {
+	deadline, ok := ctx.Deadline()
+	if !ok || noTransactionPattern.MatchString(NormalizeQuery(query)) {
+		return fn(conn)
+	}
+	setTimeout := fmt.Sprintf("SET LOCAL statement_timeout = %d", time.Until(deadline).Milliseconds()+1)
+
+	if inTx {
+		if _, err := conn.ExecContext(ctx, setTimeout); err != nil {
+			return fmt.Errorf("failed to set statement timeout: %w", err)
+		}
+		return fn(conn)
+	}
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, setTimeout); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to set statement timeout: %w", err)
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// IsQueryTimeout reports whether err means the query ran out of time, either
+// because ctx's deadline passed or because Postgres cancelled it on statement_timeout
+func IsQueryTimeout(ctx context.Context, err error) bool {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return true
+	}
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "57014" && strings.Contains(pqErr.Message, "statement timeout")
+}
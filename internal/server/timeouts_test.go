@@ -0,0 +1,82 @@
+package server
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// setTestQueryTimeouts configures the query timeouts for the test
+func setTestQueryTimeouts(t *testing.T, defaultTimeout, maxTimeout time.Duration) {
+	t.Helper()
+	SetQueryTimeouts(defaultTimeout, maxTimeout)
+	t.Cleanup(func() { SetQueryTimeouts(defaultQueryTimeoutValue, defaultMaxQueryTimeout) })
+}
+
+func TestQueryTimeout(t *testing.T) {
+	tests := []struct {
+		name                    string
+		defaultTimeout, maximum time.Duration
+		requested, want         time.Duration
+	}{
+		{"default", 30 * time.Second, 5 * time.Minute, 0, 30 * time.Second},
+		{"requested under the ceiling", 30 * time.Second, 5 * time.Minute, 2 * time.Minute, 2 * time.Minute},
+		{"requested over the ceiling", 30 * time.Second, 5 * time.Minute, time.Hour, 5 * time.Minute},
+		{"default over the ceiling", 10 * time.Minute, 5 * time.Minute, 0, 5 * time.Minute},
+		{"no default", 0, 5 * time.Minute, 0, 5 * time.Minute},
+		{"no ceiling", 30 * time.Second, 0, time.Hour, time.Hour},
+		{"no timeouts at all", 0, 0, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setTestQueryTimeouts(t, tt.defaultTimeout, tt.maximum)
+			if got := QueryTimeout(tt.requested); got != tt.want {
+				t.Errorf("QueryTimeout(%v) = %v, want %v", tt.requested, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWithQueryTimeout(t *testing.T) {
+	setTestQueryTimeouts(t, 30*time.Second, time.Minute)
+
+	ctx, cancel := WithQueryTimeout(context.Background(), time.Hour)
+	defer cancel()
+	deadline, ok := ctx.Deadline()
+	if !ok || time.Until(deadline) > time.Minute {
+		t.Errorf("deadline = %v, want at most a minute away", deadline)
+	}
+
+	setTestQueryTimeouts(t, 0, 0)
+	ctx, cancel = WithQueryTimeout(context.Background(), 0)
+	defer cancel()
+	if _, ok := ctx.Deadline(); ok {
+		t.Error("a context without timeouts has a deadline")
+	}
+}
+
+func TestQueryTimeoutFires(t *testing.T) {
+	db := testDB(t)
+
+	ctx, cancel := WithQueryTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := ExecuteQueryWithOptions(ctx, db, "public", "SELECT pg_sleep(5)", nil, QueryOptions{NoCache: true})
+	if err == nil {
+		t.Fatal("query outlived its timeout")
+	}
+	if !IsQueryTimeout(ctx, err) {
+		t.Errorf("IsQueryTimeout = false for %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Errorf("query was cancelled after %v", elapsed)
+	}
+
+	// The ceiling shortens a longer requested timeout
+	setTestQueryTimeouts(t, 30*time.Second, 100*time.Millisecond)
+	ctx, cancel = WithQueryTimeout(context.Background(), time.Minute)
+	defer cancel()
+	if _, err := ExecuteQueryWithOptions(ctx, db, "public", "SELECT pg_sleep(5)", nil, QueryOptions{NoCache: true}); !IsQueryTimeout(ctx, err) {
+		t.Errorf("clamped timeout: err = %v, want a query timeout", err)
+	}
+}
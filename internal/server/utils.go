@@ -1,6 +1,12 @@
 package server
 
-import "strconv"
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+)
 
 // convertValue converts []byte values to appropriate types for JSON marshaling
 func convertValue(val interface{}) interface{} {
@@ -12,7 +18,11 @@ func convertValue(val interface{}) interface{} {
 	if bytes, ok := val.([]byte); ok {
 		str := string(bytes)
 		
-		// Try to parse as float first (handles both integers and decimals)
+		// Integers are parsed exactly; only values with a fraction or exponent
+		// go through float64
+		if n, err := strconv.ParseInt(str, 10, 64); err == nil {
+			return n
+		}
 		if f, err := strconv.ParseFloat(str, 64); err == nil {
 			// If it's a whole number, return as int64 for smaller JSON representation
 			if f == float64(int64(f)) {
@@ -26,4 +36,119 @@ func convertValue(val interface{}) interface{} {
 	}
 	
 	return val
-}
\ No newline at end of file
+}
+// convertColumnValue converts a scanned value using the column's database type.
+// NUMERIC and MONEY values are kept as exact decimal strings so currency amounts
+// never pass through float64, json/jsonb documents are embedded as nested JSON
+// and arrays become JSON arrays; other types fall back to convertValue.
+func convertColumnValue(val interface{}, dbType string, opts QueryOptions) interface{} {
+	if val == nil {
+		// SQL NULL is JSON null whatever the column type
+		return nil
+	}
+	if t, ok := val.(time.Time); ok {
+		return formatTime(t, opts.TimeFormat)
+	}
+	bytes, ok := val.([]byte)
+	if !ok {
+		return convertValue(val)
+	}
+
+	if isArrayType(dbType) {
+		return convertArray(string(bytes), dbType, opts)
+	}
+
+	switch dbType {
+	case "JSON", "JSONB":
+		return decodeJSONColumn(bytes)
+	case "NUMERIC":
+		return string(bytes)
+	case "MONEY":
+		formatted := string(bytes)
+		amount := moneyToDecimal(formatted)
+		if opts.FormattedMoney {
+			return map[string]interface{}{
+				"amount":    amount,
+				"formatted": formatted,
+			}
+		}
+		return amount
+	}
+	return convertValue(val)
+}
+
+// Time formats accepted by QueryOptions.TimeFormat besides a Go layout string
+const (
+	TimeFormatRFC3339   = "rfc3339"
+	TimeFormatUnix      = "unix"
+	TimeFormatUnixMilli = "unixmilli"
+)
+
+// formatTime renders a date/time value in the requested format, keeping the
+// offset the driver reported. The default is RFC 3339 with nanoseconds, as
+// time.Time marshals to JSON.
+func formatTime(t time.Time, format string) interface{} {
+	switch strings.ToLower(format) {
+	case "", TimeFormatRFC3339:
+		return t
+	case TimeFormatUnix:
+		return t.Unix()
+	case TimeFormatUnixMilli:
+		return t.UnixMilli()
+	}
+	return t.Format(format)
+}
+
+// moneyToDecimal turns PostgreSQL's locale-formatted money output (e.g.
+// "-$1,234.56", "($1,234.56)" or "1.234,56 €") into a plain decimal string
+// such as "-1234.56"
+func moneyToDecimal(formatted string) string {
+	negative := strings.ContainsAny(formatted, "-(")
+
+	// The decimal separator is the last '.' or ',' unless it is followed by
+	// exactly three digits and is the only kind of separator, in which case
+	// it groups thousands of a currency without fractional digits
+	decimalSep := -1
+	if i := strings.LastIndexAny(formatted, ".,"); i >= 0 {
+		digitsAfter := 0
+		for _, r := range formatted[i+1:] {
+			if r >= '0' && r <= '9' {
+				digitsAfter++
+			}
+		}
+		other := "."
+		if formatted[i] == '.' {
+			other = ","
+		}
+		if digitsAfter != 3 || strings.Contains(formatted[:i], other) {
+			decimalSep = i
+		}
+	}
+
+	var b strings.Builder
+	if negative {
+		b.WriteByte('-')
+	}
+	for i, r := range formatted {
+		switch {
+		case r >= '0' && r <= '9':
+			b.WriteRune(r)
+		case i == decimalSep:
+			b.WriteByte('.')
+		}
+	}
+	return b.String()
+}
+
+// decodeJSONColumn parses a json/jsonb value so it is emitted as a nested
+// document rather than an escaped string. Numbers are kept as json.Number to
+// preserve their exact digits; a JSON null becomes nil.
+func decodeJSONColumn(data []byte) interface{} {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return string(data)
+	}
+	return v
+}
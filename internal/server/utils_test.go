@@ -0,0 +1,204 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestMoneyToDecimal(t *testing.T) {
+	tests := []struct {
+		formatted, want string
+	}{
+		{"$1,234.56", "1234.56"},
+		{"-$1,234.56", "-1234.56"},
+		{"($1,234.56)", "-1234.56"},
+		{"$0.07", "0.07"},
+		{"1.234,56 €", "1234.56"},
+		{"-1.234,56 €", "-1234.56"},
+		{"¥1,234", "1234"},
+		{"1.234 kr", "1234"},
+		{"$92,233,720,368,547,758.07", "92233720368547758.07"},
+	}
+	for _, tt := range tests {
+		if got := moneyToDecimal(tt.formatted); got != tt.want {
+			t.Errorf("moneyToDecimal(%q) = %q, want %q", tt.formatted, got, tt.want)
+		}
+	}
+}
+
+func TestConvertColumnValueDecimals(t *testing.T) {
+	tests := []struct {
+		name   string
+		val    string
+		dbType string
+		opts   QueryOptions
+		want   interface{}
+	}{
+		{"numeric", "12345678901234567890.99", "NUMERIC", QueryOptions{}, "12345678901234567890.99"},
+		{"numeric keeps trailing zeros", "10.50", "NUMERIC", QueryOptions{}, "10.50"},
+		{"numeric nan", "NaN", "NUMERIC", QueryOptions{}, "NaN"},
+		{"money", "$1,234.56", "MONEY", QueryOptions{}, "1234.56"},
+		{"formatted money", "-$0.10", "MONEY", QueryOptions{FormattedMoney: true}, map[string]interface{}{
+			"amount":    "-0.10",
+			"formatted": "-$0.10",
+		}},
+		{"money array", `{"$1.00","$2,000.25"}`, "_MONEY", QueryOptions{}, []interface{}{"1.00", "2000.25"}},
+		{"float stays a number", "1.5", "FLOAT8", QueryOptions{}, 1.5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := convertColumnValue([]byte(tt.val), tt.dbType, tt.opts)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("convertColumnValue(%q, %s) = %#v, want %#v", tt.val, tt.dbType, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConvertValue(t *testing.T) {
+	tests := []struct {
+		val  interface{}
+		want interface{}
+	}{
+		{nil, nil},
+		{[]byte("42"), int64(42)},
+		{[]byte("-9223372036854775808"), int64(-9223372036854775808)},
+		{[]byte("1.5"), 1.5},
+		{[]byte("2.0"), int64(2)},
+		{[]byte("1e3"), int64(1000)},
+		{[]byte("abc"), "abc"},
+		{"already text", "already text"},
+		{true, true},
+	}
+	for _, tt := range tests {
+		if got := convertValue(tt.val); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("convertValue(%#v) = %#v, want %#v", tt.val, got, tt.want)
+		}
+	}
+}
+
+func TestQueryDecimalAndFloatColumns(t *testing.T) {
+	db := testDB(t)
+	schema := testSchema(t, db,
+		"CREATE TABLE amounts (exact numeric, scaled decimal(30, 2), approx float8, small real)",
+		"INSERT INTO amounts VALUES (12345678901234567890.99, 0.10, 0.5, 2.25)",
+	)
+
+	result, err := ExecuteQueryWithOptions(context.Background(), db, schema, "SELECT * FROM amounts", nil, QueryOptions{NoCache: true})
+	if err != nil {
+		t.Fatalf("ExecuteQueryWithOptions: %v", err)
+	}
+	row := result["rows"].([]map[string]interface{})[0]
+	want := map[string]interface{}{
+		"exact":  "12345678901234567890.99",
+		"scaled": "0.10",
+		"approx": 0.5,
+		"small":  2.25,
+	}
+	if !reflect.DeepEqual(row, want) {
+		t.Errorf("row = %#v, want %#v", row, want)
+	}
+
+	// The exact value survives JSON encoding, where a float64 would round
+	data, err := json.Marshal(row["exact"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `"12345678901234567890.99"` {
+		t.Errorf("encoded exact = %s", data)
+	}
+}
+
+func TestExecuteQueryExactDecimals(t *testing.T) {
+	db := testDB(t)
+	ctx := context.Background()
+
+	result, err := ExecuteQueryWithOptions(ctx, db, "public", `
+		SELECT 12345678901234567890.99::numeric AS big,
+			0.1::numeric(10, 4) AS scaled,
+			'1234.56'::money AS price,
+			'-0.99'::money AS refund`, nil, QueryOptions{NoCache: true})
+	if err != nil {
+		t.Fatalf("ExecuteQueryWithOptions: %v", err)
+	}
+	row := result["rows"].([]map[string]interface{})[0]
+	want := map[string]interface{}{
+		"big":    "12345678901234567890.99",
+		"scaled": "0.1000",
+		"price":  "1234.56",
+		"refund": "-0.99",
+	}
+	if !reflect.DeepEqual(row, want) {
+		t.Errorf("row = %#v, want %#v", row, want)
+	}
+
+	result, err = ExecuteQueryWithOptions(ctx, db, "public", "SELECT '1234.56'::money AS price", nil, QueryOptions{FormattedMoney: true, NoCache: true})
+	if err != nil {
+		t.Fatalf("formatted money: %v", err)
+	}
+	price, ok := result["rows"].([]map[string]interface{})[0]["price"].(map[string]interface{})
+	if !ok || price["amount"] != "1234.56" || price["formatted"] == "" {
+		t.Errorf("formatted price = %#v", price)
+	}
+}
+
+func TestDecodeJSONColumn(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want interface{}
+	}{
+		{"object", `{"a": 1, "b": [true, null]}`, map[string]interface{}{"a": json.Number("1"), "b": []interface{}{true, nil}}},
+		{"array", `[1, "two"]`, []interface{}{json.Number("1"), "two"}},
+		{"json null", "null", nil},
+		{"string", `"text"`, "text"},
+		{"exact number", "12345678901234567890.123", json.Number("12345678901234567890.123")},
+		{"invalid json stays text", "{oops", "{oops"},
+	}
+	for _, tt := range tests {
+		if got := decodeJSONColumn([]byte(tt.data)); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: decodeJSONColumn(%q) = %#v, want %#v", tt.name, tt.data, got, tt.want)
+		}
+	}
+}
+
+func TestQueryJSONColumns(t *testing.T) {
+	db := testDB(t)
+	schema := testSchema(t, db,
+		"CREATE TABLE docs (id int, body jsonb, raw json)",
+		`INSERT INTO docs VALUES
+			(1, '{"title": "plan", "steps": [{"n": 1, "done": true}, {"n": 2, "done": false}], "meta": {"tags": ["a", "b"], "owner": null}}', '{"b": 1, "a": 2}'),
+			(2, 'null', 'null'),
+			(3, NULL, NULL)`,
+	)
+
+	result, err := ExecuteQueryWithOptions(context.Background(), db, schema, "SELECT body, raw FROM docs ORDER BY id", nil, QueryOptions{NoCache: true})
+	if err != nil {
+		t.Fatalf("ExecuteQueryWithOptions: %v", err)
+	}
+	rows := result["rows"].([]map[string]interface{})
+
+	// The nested document marshals back to the same JSON rather than an escaped string
+	data, err := json.Marshal(rows[0]["body"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc, want interface{}
+	json.Unmarshal(data, &doc)
+	json.Unmarshal([]byte(`{"title": "plan", "steps": [{"n": 1, "done": true}, {"n": 2, "done": false}], "meta": {"tags": ["a", "b"], "owner": null}}`), &want)
+	if !reflect.DeepEqual(doc, want) {
+		t.Errorf("body = %s", data)
+	}
+	if raw, ok := rows[0]["raw"].(map[string]interface{}); !ok || raw["a"] != json.Number("2") {
+		t.Errorf("raw = %#v, want a nested object", rows[0]["raw"])
+	}
+
+	// A JSON null and an SQL NULL are both null
+	for _, i := range []int{1, 2} {
+		if rows[i]["body"] != nil || rows[i]["raw"] != nil {
+			t.Errorf("row %d = %v, want null documents", i+1, rows[i])
+		}
+	}
+}
@@ -0,0 +1,191 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// ErrTooManyRows is returned when an update matches more rows than allowed
+var ErrTooManyRows = errors.New("update matches more than one row")
+
+// writeColumnTypes validates that every named column exists in the table, using
+// the column cache, and returns the argument type hints for the columns so JSON
+// values bind as json, jsonb or arrays as intended
+func writeColumnTypes(db *sql.DB, schema, table string, names []string) (map[string]string, error) {
+	if err := requireTable(db, schema, table); err != nil {
+		return nil, err
+	}
+	types, err := TableColumnTypes(db, schema, table)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load columns: %w", err)
+	}
+	for name, dataType := range types {
+		if dataType == "ARRAY" {
+			types[name] = "[]"
+		}
+	}
+	for _, name := range names {
+		if _, ok := types[name]; !ok {
+			return nil, fmt.Errorf("unknown column %q in table %s.%s", name, schema, table)
+		}
+	}
+	return types, nil
+}
+
+// sortedColumns returns the keys of m in order, so generated statements are deterministic
+func sortedColumns(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// InsertRow inserts one row from a column-to-value object with a parameterized
+// INSERT and returns the inserted row, including defaults, from RETURNING *
+func InsertRow(ctx context.Context, db *sql.DB, schema, table string, values map[string]interface{}) (map[string]interface{}, error) {
+	if len(values) == 0 {
+		return nil, fmt.Errorf("values must name at least one column")
+	}
+	cols := sortedColumns(values)
+	types, err := writeColumnTypes(db, schema, table, cols)
+	if err != nil {
+		return nil, err
+	}
+
+	quoted := make([]string, len(cols))
+	placeholders := make([]string, len(cols))
+	args := make([]interface{}, len(cols))
+	hints := make([]string, len(cols))
+	for i, col := range cols {
+		quoted[i] = pq.QuoteIdentifier(col)
+		placeholders[i] = fmt.Sprintf("$%d", i+1)
+		args[i] = values[col]
+		hints[i] = types[col]
+	}
+	stmt := fmt.Sprintf("INSERT INTO %s.%s (%s) VALUES (%s) RETURNING *",
+		pq.QuoteIdentifier(schema), pq.QuoteIdentifier(table), strings.Join(quoted, ", "), strings.Join(placeholders, ", "))
+
+	rows, err := writeReturning(ctx, db, schema, table, stmt, args, hints, 0)
+	if err != nil {
+		return nil, err
+	}
+	result := map[string]interface{}{
+		"table": schema + "." + table,
+		"row":   nil,
+	}
+	// A BEFORE INSERT trigger returning NULL skips the row
+	if len(rows) > 0 {
+		result["row"] = rows[0]
+	}
+	return result, nil
+}
+
+// UpdateRows sets the columns in set on the rows whose columns equal every value
+// in where (a null value matches NULL), returning the updated rows. where must
+// not be empty, and unless allowMultiple is set an update matching more than one
+// row is rolled back with ErrTooManyRows.
+func UpdateRows(ctx context.Context, db *sql.DB, schema, table string, set, where map[string]interface{}, allowMultiple bool) (map[string]interface{}, error) {
+	if len(set) == 0 {
+		return nil, fmt.Errorf("set must name at least one column")
+	}
+	if len(where) == 0 {
+		return nil, fmt.Errorf("where must name at least one column; updating every row is not allowed")
+	}
+	setCols, whereCols := sortedColumns(set), sortedColumns(where)
+	types, err := writeColumnTypes(db, schema, table, append(append([]string{}, setCols...), whereCols...))
+	if err != nil {
+		return nil, err
+	}
+
+	var args []interface{}
+	var hints []string
+	assignments := make([]string, len(setCols))
+	for i, col := range setCols {
+		args = append(args, set[col])
+		hints = append(hints, types[col])
+		assignments[i] = fmt.Sprintf("%s = $%d", pq.QuoteIdentifier(col), len(args))
+	}
+	conditions := make([]string, len(whereCols))
+	for i, col := range whereCols {
+		if where[col] == nil {
+			conditions[i] = pq.QuoteIdentifier(col) + " IS NULL"
+			continue
+		}
+		args = append(args, where[col])
+		hints = append(hints, types[col])
+		conditions[i] = fmt.Sprintf("%s = $%d", pq.QuoteIdentifier(col), len(args))
+	}
+	stmt := fmt.Sprintf("UPDATE %s.%s SET %s WHERE %s RETURNING *",
+		pq.QuoteIdentifier(schema), pq.QuoteIdentifier(table), strings.Join(assignments, ", "), strings.Join(conditions, " AND "))
+
+	maxRows := 1
+	if allowMultiple {
+		maxRows = 0
+	}
+	rows, err := writeReturning(ctx, db, schema, table, stmt, args, hints, maxRows)
+	if err != nil {
+		return nil, err
+	}
+	if rows == nil {
+		rows = []map[string]interface{}{}
+	}
+	return map[string]interface{}{
+		"table":        schema + "." + table,
+		"rows":         rows,
+		"rows_updated": len(rows),
+	}, nil
+}
+
+// writeReturning runs a data-modifying statement with RETURNING in a transaction
+// and commits it, unless maxRows is positive and more rows were affected. The
+// returned rows are masked like sampled rows of the table.
+func writeReturning(ctx context.Context, db *sql.DB, schema, table, stmt string, args []interface{}, hints []string, maxRows int) ([]map[string]interface{}, error) {
+	args, err := coerceArgs(args, hints)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = WithQueryTimeout(ctx, 0)
+		defer cancel()
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	start := time.Now()
+	defer recordQuery(stmt, start)
+	rows, err := tx.QueryContext(ctx, stmt, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query error: %w", err)
+	}
+	_, written, err := scanRows(rows, QueryOptions{})
+	rows.Close()
+	if err != nil {
+		return nil, err
+	}
+	if maxRows > 0 && len(written) > maxRows {
+		return nil, fmt.Errorf("%w: %d rows matched; set allowMultiple to update them all", ErrTooManyRows, len(written))
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("commit error: %w", err)
+	}
+	results.reset()
+
+	for _, row := range written {
+		maskRow(schema, table, row)
+	}
+	return written, nil
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	mcpserver "github.com/mark3labs/mcp-go/server"
+
+	"github.com/tendant/postgres-mcp-sse/internal/server"
+)
+
+// testClientSession is an initialized MCP client session whose notifications
+// are buffered for the test to read
+type testClientSession struct {
+	id            string
+	notifications chan mcp.JSONRPCNotification
+}
+
+func (s *testClientSession) SessionID() string {
+	if s.id == "" {
+		return "test-session"
+	}
+	return s.id
+}
+func (s *testClientSession) Initialize()       {}
+func (s *testClientSession) Initialized() bool { return true }
+func (s *testClientSession) NotificationChannel() chan<- mcp.JSONRPCNotification {
+	return s.notifications
+}
+
+// testMCPServer registers the tools against the test database, skipping the
+// test when TEST_DATABASE_URL is unset
+func testMCPServer(t *testing.T) *mcpserver.MCPServer {
+	t.Helper()
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL not set; skipping integration test")
+	}
+	dbConn, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatalf("open test database: %v", err)
+	}
+	t.Cleanup(func() { dbConn.Close() })
+
+	mcpServer := mcpserver.NewMCPServer("test", "1.0.0", mcpserver.WithToolCapabilities(true))
+	sessions := server.NewSessionManager(dbConn)
+	t.Cleanup(sessions.CloseAll)
+	streams := server.NewStreamRegistry(dbConn, time.Minute)
+	t.Cleanup(streams.CloseAll)
+	registerMCPTools(mcpServer, dbConn, NewCustomHub(mcpServer), sessions, streams, nil)
+	return mcpServer
+}
+
+// testClient registers a client session with the server and returns it with
+// the context its requests are handled in
+func testClient(t *testing.T, mcpServer *mcpserver.MCPServer, id string) (*testClientSession, context.Context) {
+	t.Helper()
+	session := &testClientSession{id: id, notifications: make(chan mcp.JSONRPCNotification, 100)}
+	if err := mcpServer.RegisterSession(context.Background(), session); err != nil {
+		t.Fatalf("RegisterSession: %v", err)
+	}
+	t.Cleanup(func() { mcpServer.UnregisterSession(context.Background(), session.SessionID()) })
+	return session, mcpServer.WithContext(context.Background(), session)
+}
+
+// callTool calls a tool as the client of ctx and returns its result
+func callTool(t *testing.T, mcpServer *mcpserver.MCPServer, ctx context.Context, name string, args map[string]interface{}) mcp.CallToolResult {
+	t.Helper()
+	request, err := json.Marshal(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"id":      1,
+		"method":  "tools/call",
+		"params":  map[string]interface{}{"name": name, "arguments": args},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	response := mcpServer.HandleMessage(ctx, request)
+	if rpcErr, ok := response.(mcp.JSONRPCError); ok {
+		t.Fatalf("tools/call %s: %v", name, rpcErr.Error.Message)
+	}
+	return response.(mcp.JSONRPCResponse).Result.(mcp.CallToolResult)
+}
+
+// streamBatches drains a session's notifications and returns the stream batches among them
+func streamBatches(session *testClientSession) []map[string]interface{} {
+	var batches []map[string]interface{}
+	for len(session.notifications) > 0 {
+		n := <-session.notifications
+		if n.Method != eventNotificationMethod {
+			continue
+		}
+		data, _ := json.Marshal(n.Params.AdditionalFields["data"])
+		var batch map[string]interface{}
+		json.Unmarshal(data, &batch)
+		if _, ok := batch["stream_id"]; ok {
+			batches = append(batches, batch)
+		}
+	}
+	return batches
+}
+
+func TestStreamBatchesGoToTheOwner(t *testing.T) {
+	mcpServer := testMCPServer(t)
+	owner, ownerCtx := testClient(t, mcpServer, "owner")
+	other, otherCtx := testClient(t, mcpServer, "other")
+
+	result := callTool(t, mcpServer, ownerCtx, "openStream", map[string]interface{}{"query": "SELECT generate_series(1, 25) AS n", "batchSize": 10})
+	if result.IsError {
+		t.Fatalf("openStream failed: %v", result.Content)
+	}
+	var opened map[string]interface{}
+	json.Unmarshal([]byte(result.Content[0].(mcp.TextContent).Text), &opened)
+	streamID := opened["stream_id"].(string)
+
+	if batches := streamBatches(owner); len(batches) != 1 || len(batches[0]["rows"].([]interface{})) != 10 {
+		t.Fatalf("owner received %v, want the first batch of 10 rows", batches)
+	}
+	if batches := streamBatches(other); len(batches) != 0 {
+		t.Fatalf("another session received stream batches: %v", batches)
+	}
+
+	// Another session can neither advance nor close the stream
+	if result := callTool(t, mcpServer, otherCtx, "requestNextBatch", map[string]interface{}{"streamId": streamID}); !result.IsError {
+		t.Error("requestNextBatch from another session succeeded")
+	}
+	if result := callTool(t, mcpServer, otherCtx, "closeStream", map[string]interface{}{"streamId": streamID}); !result.IsError {
+		t.Error("closeStream from another session succeeded")
+	}
+	if batches := streamBatches(other); len(batches) != 0 {
+		t.Fatalf("another session received stream batches: %v", batches)
+	}
+
+	if result := callTool(t, mcpServer, ownerCtx, "requestNextBatch", map[string]interface{}{"streamId": streamID}); result.IsError {
+		t.Fatalf("requestNextBatch failed: %v", result.Content)
+	}
+	if batches := streamBatches(owner); len(batches) != 1 || batches[0]["rows_sent"] != float64(20) {
+		t.Fatalf("owner received %v, want the second batch", batches)
+	}
+}
+
+func TestExecuteQuerySendsProgressNotifications(t *testing.T) {
+	mcpServer := testMCPServer(t)
+	session, ctx := testClient(t, mcpServer, "")
+
+	request := `{
+		"jsonrpc": "2.0",
+		"id": 1,
+		"method": "tools/call",
+		"params": {
+			"name": "executeQuery",
+			"arguments": {"query": "SELECT generate_series(1, 25) AS n", "progressEvery": 10, "noCache": true},
+			"_meta": {"progressToken": "tok"}
+		}
+	}`
+	response := mcpServer.HandleMessage(ctx, json.RawMessage(request))
+	if rpcErr, ok := response.(mcp.JSONRPCError); ok {
+		t.Fatalf("tools/call: %v", rpcErr.Error.Message)
+	}
+	if result := response.(mcp.JSONRPCResponse).Result.(mcp.CallToolResult); result.IsError {
+		t.Fatalf("executeQuery failed: %v", result.Content)
+	}
+
+	var progress []float64
+	for len(session.notifications) > 0 {
+		n := <-session.notifications
+		if n.Method != "notifications/progress" {
+			continue
+		}
+		fields := n.Params.AdditionalFields
+		if fields["progressToken"] != "tok" {
+			t.Errorf("progressToken = %v, want tok", fields["progressToken"])
+		}
+		value, _ := json.Marshal(fields["progress"])
+		var p float64
+		json.Unmarshal(value, &p)
+		progress = append(progress, p)
+	}
+	want := []float64{10, 20, 25}
+	if len(progress) != len(want) {
+		t.Fatalf("progress = %v, want %v", progress, want)
+	}
+	for i := range want {
+		if progress[i] != want[i] {
+			t.Fatalf("progress = %v, want %v", progress, want)
+		}
+	}
+}
@@ -9,43 +9,54 @@ import (
 	"log"
 	"time"
 
+	"github.com/mark3labs/mcp-go/client"
 	"github.com/mark3labs/mcp-go/mcp"
-	"github.com/mark3labs/mcp-go/transport/http"
 )
 
 func main() {
-	// Create HTTP transport
-	transport := http.NewHTTPClientTransport("/mcp")
-	transport.WithBaseURL("http://localhost:8080")
-	transport.WithEventsEndpoint("/events")
-	
-	// Create a new MCP client
-	mcpClient := mcp.NewClient(transport)
+	// Create an SSE client
+	mcpClient, err := client.NewSSEMCPClient("http://localhost:8080/sse")
+	if err != nil {
+		log.Fatalf("Failed to create MCP client: %v", err)
+	}
+	defer mcpClient.Close()
+
+	if err := mcpClient.Start(context.Background()); err != nil {
+		log.Fatalf("Failed to start MCP client: %v", err)
+	}
+
+	// Listen for events, which the server delivers as notifications/event messages
+	events := make(chan mcp.JSONRPCNotification, 16)
+	mcpClient.OnNotification(func(notification mcp.JSONRPCNotification) {
+		events <- notification
+	})
 
 	// Initialize the client
-	err = mcpClient.Initialize(context.Background())
-	if err != nil {
+	initRequest := mcp.InitializeRequest{}
+	initRequest.Params.ProtocolVersion = mcp.LATEST_PROTOCOL_VERSION
+	initRequest.Params.ClientInfo = mcp.Implementation{Name: "test-client", Version: "1.0.0"}
+	if _, err := mcpClient.Initialize(context.Background(), initRequest); err != nil {
 		log.Fatalf("Failed to initialize MCP client: %v", err)
 	}
 
 	// List available tools
-	tools, err := mcpClient.ListTools(context.Background())
+	tools, err := mcpClient.ListTools(context.Background(), mcp.ListToolsRequest{})
 	if err != nil {
 		log.Fatalf("Failed to list tools: %v", err)
 	}
 
 	fmt.Println("Available tools:")
-	for _, tool := range tools {
+	for _, tool := range tools.Tools {
 		fmt.Printf("- %s: %s\n", tool.Name, tool.Description)
 	}
 
 	// Test listSchemas tool
 	fmt.Println("\nTesting listSchemas tool...")
-	result, err := mcpClient.CallTool(context.Background(), "listSchemas", nil)
+	result, err := callTool(mcpClient, "listSchemas", nil)
 	if err != nil {
 		log.Fatalf("Failed to call listSchemas tool: %v", err)
 	}
-	fmt.Printf("Result: %s\n", result.Content[0].Text)
+	fmt.Printf("Result: %s\n", result)
 
 	// Test executeQuery tool with broadcast
 	fmt.Println("\nTesting executeQuery tool with broadcast...")
@@ -55,30 +66,40 @@ func main() {
 		"broadcast": true,
 		"eventName": "test_query_result",
 	}
-	result, err = mcpClient.CallTool(context.Background(), "executeQuery", args)
+	result, err = callTool(mcpClient, "executeQuery", args)
 	if err != nil {
 		log.Fatalf("Failed to call executeQuery tool: %v", err)
 	}
-	fmt.Printf("Result: %s\n", result.Content[0].Text)
+	fmt.Printf("Result: %s\n", result)
 
-	// Listen for events
+	// Print the events received within 5 seconds
 	fmt.Println("\nListening for events (for 5 seconds)...")
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-
-	events := mcpClient.Events()
-	go func() {
-		for {
-			select {
-			case event := <-events:
-				fmt.Printf("Received event: %s - %v\n", event.Name, event.Data)
-			case <-ctx.Done():
-				return
-			}
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case event := <-events:
+			fmt.Printf("Received event: %s - %v\n", event.Method, event.Params.AdditionalFields)
+		case <-timeout:
+			fmt.Println("Test complete!")
+			return
 		}
-	}()
+	}
+}
 
-	// Wait for events to be received
-	time.Sleep(5 * time.Second)
-	fmt.Println("Test complete!")
+// callTool calls a tool and returns the text of its first content item
+func callTool(mcpClient *client.Client, name string, args map[string]interface{}) (string, error) {
+	request := mcp.CallToolRequest{}
+	request.Params.Name = name
+	request.Params.Arguments = args
+	result, err := mcpClient.CallTool(context.Background(), request)
+	if err != nil {
+		return "", err
+	}
+	if len(result.Content) == 0 {
+		return "", nil
+	}
+	if text, ok := result.Content[0].(mcp.TextContent); ok {
+		return text.Text, nil
+	}
+	return fmt.Sprintf("%v", result.Content[0]), nil
 }